@@ -10,8 +10,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/hasura/go-graphql-client"
-
 	"database/sql"
 	// MySQL driver needed for sql module
 	_ "github.com/go-sql-driver/mysql"
@@ -21,6 +19,7 @@ import (
 
 const SqliteDriver string = "sqlite"
 const MysqlDriver string = "mysql"
+const PostgresDriver string = "postgres"
 
 const loggingTableName string = "userLogs"
 const userSetTableName string = "userSettings"
@@ -34,10 +33,12 @@ const ForgetInputConfigMagicNumber string = "0"
 const ActionFetchFromSource string = "fetching from source completed"
 const ActionChangeUserLog string = "changing user log completed"
 const ActionAddToInfoTable string = "adding to info table completed"
+const ActionUpsertInfoTable string = "upserting info table completed"
 const ActionFetchFromPsychonautWiki string = "fetching from psychonautwiki completed"
 const ActionAddToDoseTable string = "adding to dose table completed"
 const ActionRemoveLogs string = "removing logs from dose table completed"
 const ActionRemoveSingleDrugInfo string = "removing single drug info completed"
+const ActionCleanInfoTable string = "cleaning info table completed"
 const ActionSetUserSettings string = "user settings change completed"
 const ActionRememberDosing string = "dosing remember completed"
 const ActionForgetDosing string = "dosing forgetting completed"
@@ -123,6 +124,7 @@ func checkColIsInvalid(validCols []string, gotCol string, printN string) error {
 }
 
 type UserLog struct {
+	ID           int64
 	StartTime    int64
 	Username     string
 	EndTime      int64
@@ -170,10 +172,47 @@ type AllUsersError struct {
 	Err      error
 }
 
+// The status of a single route after calling UpsertInfoTable().
+const InfoRouteInserted string = "inserted"
+const InfoRouteUpdated string = "updated"
+const InfoRouteUnchanged string = "unchanged"
+
+// Only used by UpdateFromSource() and RefreshInfo(), when the source doesn't
+// have the route anymore.
+const InfoRouteRemoved string = "removed"
+
+// InfoFieldDiff is a single changed field of a route in the info table.
+// The values are formatted as strings, so that all fields can be compared
+// the same way.
+type InfoFieldDiff struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// InfoRouteDiff contains what happened to a single route of a drug in the
+// info table after calling UpsertInfoTable(). Fields is only filled when
+// the Status is InfoRouteUpdated.
+type InfoRouteDiff struct {
+	DrugName  string
+	DrugRoute string
+	Status    string
+	Fields    []InfoFieldDiff
+}
+
+type InfoDiffError struct {
+	InfoDiff []InfoRouteDiff
+	Username string
+	Err      error
+}
+
 type ErrorInfo struct {
 	Err      error
 	Action   string
 	Username string
+	// Problems which didn't stop the action, for example the class of
+	// a logged dose, checkout AddToDoseTable()
+	Warnings []error
 }
 
 type DrugInfo struct {
@@ -205,10 +244,41 @@ type DrugInfo struct {
 	TimeOfFetch   int64
 }
 
+// SyncTimestamps is shared between AddToDoseTable() goroutines, so that
+// they don't go over MaxLogsPerUser when adding logs at the same time and
+// logs of the same user don't get the same start time.
 type SyncTimestamps struct {
+	// Deprecated: only kept for compatibility, the start times of all users
+	// are tracked instead. Still set to the start time and user of the last
+	// added log.
 	LastTimestamp int64
-	LastUser      string
-	Lock          sync.Mutex
+	// Deprecated: checkout LastTimestamp.
+	LastUser string
+	Lock     sync.Mutex
+	// All start times used for every user.
+	usedTimes map[string]map[int64]bool
+}
+
+// Returns the start time to use for a new log of the user. If another log
+// added using the same SyncTimestamps already has it, it's moved forward by
+// one second until it's unique. Lock has to be held while calling it.
+func (synct *SyncTimestamps) uniqueStartTime(user string, startTime int64) int64 {
+	if synct.usedTimes == nil {
+		synct.usedTimes = map[string]map[int64]bool{}
+	}
+
+	if synct.usedTimes[user] == nil {
+		synct.usedTimes[user] = map[int64]bool{}
+	}
+
+	for synct.usedTimes[user][startTime] {
+		startTime++
+	}
+	synct.usedTimes[user][startTime] = true
+	synct.LastTimestamp = startTime
+	synct.LastUser = user
+
+	return startTime
 }
 
 func xtrastmt(col string, logical string) string {
@@ -284,9 +354,16 @@ func (cfg *Config) OpenDBConnection(ctx context.Context) *sql.DB {
 		finalPath = finalPath + cfg.DBSettings[cfg.DBDriver].Parameters
 	}
 
-	db, err := sql.Open(cfg.DBDriver, finalPath)
-	if err != nil {
-		errorCantOpenDB(finalPath, err, printN)
+	var db *sql.DB
+	var err error
+	if cfg.dbIsEncrypted() {
+		// The database is decrypted when the first connection is made.
+		db = sql.OpenDB(cfg.newEncSqliteConnector())
+	} else {
+		db, err = sql.Open(cfg.sqlDriverName(), finalPath)
+		if err != nil {
+			errorCantOpenDB(finalPath, err, printN)
+		}
 	}
 
 	cfg.PingDB(db, ctx)
@@ -319,7 +396,10 @@ func (cfg *Config) getTableNamesQuery(tableName string) string {
 		if tableName != "" {
 			andTable = " AND name = '" + tableName + "'"
 		}
-		queryStr = "SELECT name FROM sqlite_schema WHERE type='table'" + andTable
+		// The internal tables, like sqlite_sequence used for the automatically
+		// incremented IDs, can't be dropped and aren't a part of this module.
+		queryStr = "SELECT name FROM sqlite_schema WHERE type='table'" +
+			" AND name NOT LIKE 'sqlite_%'" + andTable
 	} else if cfg.DBDriver == MysqlDriver {
 		if tableName != "" {
 			andTable = " AND table_name = '" + tableName + "'"
@@ -327,6 +407,13 @@ func (cfg *Config) getTableNamesQuery(tableName string) string {
 		dbName := strings.Split(cfg.DBSettings[cfg.DBDriver].Path, "/")
 		queryStr = "SELECT table_name FROM information_schema.tables WHERE table_schema = '" +
 			dbName[1] + "'" + andTable
+	} else if cfg.DBDriver == PostgresDriver {
+		// PostgreSQL stores all unquoted names in lower case.
+		if tableName != "" {
+			andTable = " AND table_name = lower('" + tableName + "')"
+		}
+		queryStr = "SELECT table_name FROM information_schema.tables WHERE " +
+			"table_schema = current_schema() AND table_type = 'BASE TABLE'" + andTable
 	}
 	return queryStr
 }
@@ -365,9 +452,10 @@ func (cfg *Config) CheckTables(db *sql.DB, ctx context.Context, tableName string
 	return len(tableList) != 0
 }
 
-// FetchFromSource goes through all source names and picks the proper
-// function for fetching drug information. The information is automatically
-// added to the proper info table depending on the Config struct.
+// FetchFromSource uses the given source to fetch drug information.
+// The information is automatically added to the proper info table depending
+// on the Config struct. If the drug is already present in the info table
+// nothing is fetched.
 //
 // db - open database connection
 //
@@ -380,15 +468,11 @@ func (cfg *Config) CheckTables(db *sql.DB, ctx context.Context, tableName string
 //
 // username - the user requesting the fetch
 //
-// xtraNeeded - these are values dependent on the configured source, the order
-// in which they're given also matters, the order in which every source is
-// described, is the one in which the values should be given
-//
-// for psychonautwiki: the initialised structure for the graphql client,
-// best done using InitGraphqlClient(), but can be done manually if needed
+// src - the source to fetch the information from, best done using
+// InitSource(), which picks the source configured with UseSource
 func (cfg *Config) FetchFromSource(db *sql.DB, ctx context.Context,
 	errChannel chan<- ErrorInfo, drugname string, username string,
-	xtraNeeded ...any) ErrorInfo {
+	src Source) ErrorInfo {
 
 	const printN string = "FetchFromSource()"
 
@@ -398,24 +482,15 @@ func (cfg *Config) FetchFromSource(db *sql.DB, ctx context.Context,
 		Username: username,
 	}
 
-	gotsrcData := GetSourceData()
-	printNameVerbose(cfg.VerbosePrinting,
-		printN, "Using API from settings.toml:", cfg.UseSource)
-	printNameVerbose(cfg.VerbosePrinting,
-		printN, "Got API URL from sources.toml:", gotsrcData[cfg.UseSource].API_ADDRESS)
-
-	if cfg.UseSource == "psychonautwiki" {
-		gotErrInfo := cfg.FetchPsyWiki(db, ctx, nil, drugname, xtraNeeded[0].(graphql.Client), username)
-		if gotErrInfo.Err != nil {
-			tempErrInfo.Err = fmt.Errorf("%s%w",
-				sprintName(printN, "While fetching from: ", cfg.UseSource, " ; error: "),
-				gotErrInfo.Err)
-			if errChannel != nil {
-				errChannel <- tempErrInfo
-			}
-			return tempErrInfo
+	if !cfg.AutoFetch {
+		printNameVerbose(cfg.VerbosePrinting, printN, "Automatic fetching is disabled, returning.")
+		if errChannel != nil {
+			errChannel <- tempErrInfo
 		}
-	} else {
+		return tempErrInfo
+	}
+
+	if src == nil {
 		tempErrInfo.Err = fmt.Errorf("%s%w: %s", sprintName(printN), NoValidSourceSel, cfg.UseSource)
 		if errChannel != nil {
 			errChannel <- tempErrInfo
@@ -423,13 +498,68 @@ func (cfg *Config) FetchFromSource(db *sql.DB, ctx context.Context,
 		return tempErrInfo
 	}
 
+	drugname = cfg.MatchAndReplace(db, ctx, drugname, NameTypeSubstance)
+
+	ret := checkIfExistsDB(db, ctx,
+		"drugName",
+		cfg.UseSource,
+		cfg.DBDriver,
+		cfg.DBSettings[cfg.DBDriver].Path,
+		nil,
+		drugname)
+	if ret {
+		printNameVerbose(cfg.VerbosePrinting, printN, "Drug already in DB, returning. "+
+			"No need to fetch anything from source:", cfg.UseSource)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	xtraTxt := ""
+	if cfg.ProxyURL != "" && cfg.ProxyURL != "none" {
+		xtraTxt += " ; configured proxy: " + fmt.Sprintf("%q", cfg.ProxyURL)
+	}
+	printNameF(printN, "Fetching from source: %q ; substance: %q%s\n", cfg.UseSource, drugname, xtraTxt)
+	printNameVerbose(cfg.VerbosePrinting, printN, "Source description:", src.Describe())
+
+	err, infoDrug := src.FetchSubstance(ctx, drugname)
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w",
+			sprintName(printN, "While fetching from: ", cfg.UseSource, " ; error: "), err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	if len(infoDrug) == 0 {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), StructSliceEmpty)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, infoDrug, username)
+	if gotErrInfo.Err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), gotErrInfo.Err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	cfg.fetchSourceInteractions(db, ctx, src, drugname)
+
 	if errChannel != nil {
 		errChannel <- tempErrInfo
 	}
 	return tempErrInfo
 }
 
-// ChangeUserLog can be used to modify log data of a single log.
+// ChangeUserLog can be used to modify log data of a single log. The log
+// before the change is kept in the history, checkout UndoLogChanges().
 //
 // db - open database connection
 //
@@ -446,7 +576,8 @@ func (cfg *Config) FetchFromSource(db *sql.DB, ctx context.Context,
 //
 // username - the user who's log we're changing
 //
-// setValue - the new value to set
+// setValue - the new value to set, for the start and end times every input
+// accepted by ParseTimeInput() can be used
 func (cfg *Config) ChangeUserLog(db *sql.DB, ctx context.Context, errChannel chan<- ErrorInfo,
 	set string, id int64, username string, setValue string) ErrorInfo {
 	const printN string = "ChangeUserLog()"
@@ -466,18 +597,16 @@ func (cfg *Config) ChangeUserLog(db *sql.DB, ctx context.Context, errChannel cha
 		return tempErrInfo
 	}
 
-	if setValue == "now" && set == LogStartTimeCol || setValue == "now" && set == LogEndTimeCol {
-		setValue = strconv.FormatInt(time.Now().Unix(), 10)
-	}
-
 	if set == LogStartTimeCol || set == LogEndTimeCol {
-		if _, err := strconv.ParseInt(setValue, 10, 64); err != nil {
-			tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN, "strconv.ParseInt(): "), err)
+		err, gotTime := cfg.ParseTimeInput(setValue)
+		if err != nil {
+			tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), err)
 			if errChannel != nil {
 				errChannel <- tempErrInfo
 			}
 			return tempErrInfo
 		}
+		setValue = strconv.FormatInt(gotTime, 10)
 	}
 
 	if set == "dose" {
@@ -504,9 +633,9 @@ func (cfg *Config) ChangeUserLog(db *sql.DB, ctx context.Context, errChannel cha
 	}
 
 	gotLogs = gotUserLogsErr.UserLogs
-	id = gotLogs[0].StartTime
+	id = gotLogs[0].ID
 
-	stmtStr := fmt.Sprintf("update "+loggingTableName+" set %s = ? where timeOfDoseStart = ?", set)
+	stmtStr := fmt.Sprintf("update "+loggingTableName+" set %s = ? where "+LogIDCol+" = ?", set)
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN, "db.Begin(): "), err)
@@ -516,6 +645,21 @@ func (cfg *Config) ChangeUserLog(db *sql.DB, ctx context.Context, errChannel cha
 		return tempErrInfo
 	}
 
+	err, changedLogs := cfg.saveLogHistory(ctx, tx, HistoryChange, username, LogIDCol+" = ?", id)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
+	var before any
+	if len(changedLogs) != 0 {
+		before = changedLogs[0]
+	}
+	err = cfg.addAuditEntry(ctx, tx, ActionChangeUserLog, username, []int64{id},
+		before, map[string]string{set: setValue})
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
 	stmt, err := tx.Prepare(stmtStr)
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Prepare(): ") {
 		return tempErrInfo
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"time"
 
 	"database/sql"
@@ -13,6 +14,60 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// Prepares the statement for inserting a single route of a drug in the
+// currently configured info table. Checkout execInfoInsert().
+func (cfg *Config) prepareInfoInsert(tx *sql.Tx) (*sql.Stmt, error) {
+	return tx.Prepare("insert into " + cfg.UseSource +
+		" (drugName, drugRoute, " +
+		"threshold, " +
+		"lowDoseMin, lowDoseMax, " +
+		"mediumDoseMin, mediumDoseMax, " +
+		"highDoseMin, highDoseMax, " +
+		"doseUnits, " +
+		"onsetMin, onsetMax, onsetUnits, " +
+		"comeUpMin, comeUpMax, comeUpUnits, " +
+		"peakMin, peakMax, peakUnits, " +
+		"offsetMin, offsetMax, offsetUnits, " +
+		"totalDurMin, totalDurMax, totalDurUnits, " +
+		"timeOfFetch) " +
+		"values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+}
+
+// Uses the statement from prepareInfoInsert() to add a single route of a drug.
+// The dose units are replaced with the local name before adding them.
+func (cfg *Config) execInfoInsert(db *sql.DB, ctx context.Context,
+	stmt *sql.Stmt, sub *DrugInfo, timeOfFetch int64) error {
+	sub.DoseUnits = cfg.MatchAndReplace(db, ctx, sub.DoseUnits, NameTypeUnits)
+	sub.TimeOfFetch = timeOfFetch
+	_, err := stmt.Exec(sub.DrugName,
+		sub.DrugRoute,
+		sub.Threshold,
+		sub.LowDoseMin,
+		sub.LowDoseMax,
+		sub.MediumDoseMin,
+		sub.MediumDoseMax,
+		sub.HighDoseMin,
+		sub.HighDoseMax,
+		sub.DoseUnits,
+		sub.OnsetMin,
+		sub.OnsetMax,
+		sub.OnsetUnits,
+		sub.ComeUpMin,
+		sub.ComeUpMax,
+		sub.ComeUpUnits,
+		sub.PeakMin,
+		sub.PeakMax,
+		sub.PeakUnits,
+		sub.OffsetMin,
+		sub.OffsetMax,
+		sub.OffsetUnits,
+		sub.TotalDurMin,
+		sub.TotalDurMax,
+		sub.TotalDurUnits,
+		sub.TimeOfFetch)
+	return err
+}
+
 // AddToInfoTable uses subs[] to fill up the currently configured source table
 // in the database. subs[] has to be filled prior to calling the function.
 // This is usually achieved by fetching data from a source using it's API.
@@ -46,30 +101,184 @@ func (cfg *Config) AddToInfoTable(db *sql.DB, ctx context.Context,
 		return tempErrInfo
 	}
 
-	stmt, err := tx.Prepare("insert into " + cfg.UseSource +
-		" (drugName, drugRoute, " +
-		"threshold, " +
-		"lowDoseMin, lowDoseMax, " +
-		"mediumDoseMin, mediumDoseMax, " +
-		"highDoseMin, highDoseMax, " +
-		"doseUnits, " +
-		"onsetMin, onsetMax, onsetUnits, " +
-		"comeUpMin, comeUpMax, comeUpUnits, " +
-		"peakMin, peakMax, peakUnits, " +
-		"offsetMin, offsetMax, offsetUnits, " +
-		"totalDurMin, totalDurMax, totalDurUnits, " +
-		"timeOfFetch) " +
-		"values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	stmt, err := cfg.prepareInfoInsert(tx)
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Prepare(): ") {
 		return tempErrInfo
 	}
-
 	defer stmt.Close()
+
+	timeOfFetch := time.Now().Unix()
+	for i := 0; i < len(subs); i++ {
+		err = cfg.execInfoInsert(db, ctx, stmt, &subs[i], timeOfFetch)
+		if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "stmt.Exec(): ") {
+			return tempErrInfo
+		}
+	}
+
+	err = cfg.addAuditEntry(ctx, tx, ActionAddToInfoTable, username, nil, nil, subs)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
+	err = tx.Commit()
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
+		return tempErrInfo
+	}
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+// Returns all fields which differ between two routes of a drug in the
+// info table. The name, route and time of fetch aren't compared.
+func diffDrugInfo(oldInfo DrugInfo, newInfo DrugInfo) []InfoFieldDiff {
+	var fields []InfoFieldDiff
+
+	oldVal := reflect.ValueOf(oldInfo)
+	newVal := reflect.ValueOf(newInfo)
+	infoType := oldVal.Type()
+	for i := 0; i < infoType.NumField(); i++ {
+		name := infoType.Field(i).Name
+		if name == "DrugName" || name == "DrugRoute" || name == "TimeOfFetch" {
+			continue
+		}
+
+		oldStr := fmt.Sprint(oldVal.Field(i).Interface())
+		newStr := fmt.Sprint(newVal.Field(i).Interface())
+		if oldStr != newStr {
+			fields = append(fields, InfoFieldDiff{
+				Field: name,
+				Old:   oldStr,
+				New:   newStr,
+			})
+		}
+	}
+
+	return fields
+}
+
+// UpsertInfoTable is like AddToInfoTable(), but routes which are already
+// present in the info table are updated instead of returning an error.
+// All routes are handled in a single transaction and the time of fetch
+// is set for all of them, even the unchanged ones.
+// Works the same way for all drivers, since it doesn't rely on
+// driver specific upsert syntax.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// infoDiffErrChan - the goroutine channel used to return what happened to
+// every route and the error
+// (set to nil if function doesn't need to be concurrent)
+//
+// subs - all substances of type DrugInfo to insert or update
+//
+// username - user requesting the upsert
+func (cfg *Config) UpsertInfoTable(db *sql.DB, ctx context.Context,
+	infoDiffErrChan chan<- InfoDiffError, subs []DrugInfo, username string) InfoDiffError {
+	const printN string = "UpsertInfoTable()"
+
+	tempInfoDiffErr := InfoDiffError{
+		InfoDiff: nil,
+		Username: username,
+		Err:      nil,
+	}
+
+	err, infoDiff := cfg.upsertInfoTx(db, ctx, subs, username, ActionUpsertInfoTable, false)
+	if err != nil {
+		tempInfoDiffErr.Err = fmt.Errorf("%s%w", sprintName(printN), err)
+		if infoDiffErrChan != nil {
+			infoDiffErrChan <- tempInfoDiffErr
+		}
+		return tempInfoDiffErr
+	}
+
+	tempInfoDiffErr.InfoDiff = infoDiff
+	if infoDiffErrChan != nil {
+		infoDiffErrChan <- tempInfoDiffErr
+	}
+	return tempInfoDiffErr
+}
+
+// Inserts or updates all routes in subs in a single transaction, the change
+// is recorded in the audit log using action. If replace is true, the routes
+// of the same drugs, which aren't in subs, are removed.
+func (cfg *Config) upsertInfoTx(db *sql.DB, ctx context.Context,
+	subs []DrugInfo, username string, action string, replace bool) (error, []InfoRouteDiff) {
+	const printN string = "upsertInfoTx()"
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err), nil
+	}
+
+	insStmt, err := cfg.prepareInfoInsert(tx)
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Prepare(): ")
+	if err != nil {
+		return err, nil
+	}
+	defer insStmt.Close()
+
+	updStmt, err := tx.Prepare("update " + cfg.UseSource + " set " +
+		"threshold = ?, " +
+		"lowDoseMin = ?, lowDoseMax = ?, " +
+		"mediumDoseMin = ?, mediumDoseMax = ?, " +
+		"highDoseMin = ?, highDoseMax = ?, " +
+		"doseUnits = ?, " +
+		"onsetMin = ?, onsetMax = ?, onsetUnits = ?, " +
+		"comeUpMin = ?, comeUpMax = ?, comeUpUnits = ?, " +
+		"peakMin = ?, peakMax = ?, peakUnits = ?, " +
+		"offsetMin = ?, offsetMax = ?, offsetUnits = ?, " +
+		"totalDurMin = ?, totalDurMax = ?, totalDurUnits = ?, " +
+		"timeOfFetch = ? " +
+		"where drugName = ? AND drugRoute = ?")
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Prepare(): ")
+	if err != nil {
+		return err, nil
+	}
+	defer updStmt.Close()
+
+	var infoDiff []InfoRouteDiff
+	timeOfFetch := time.Now().Unix()
 	for i := 0; i < len(subs); i++ {
 		subs[i].DoseUnits = cfg.MatchAndReplace(db, ctx, subs[i].DoseUnits, NameTypeUnits)
-		_, err = stmt.Exec(subs[i].DrugName,
-			subs[i].DrugRoute,
-			subs[i].Threshold,
+		subs[i].TimeOfFetch = timeOfFetch
+
+		routeDiff := InfoRouteDiff{
+			DrugName:  subs[i].DrugName,
+			DrugRoute: subs[i].DrugRoute,
+			Status:    InfoRouteUnchanged,
+			Fields:    nil,
+		}
+
+		oldInfo := DrugInfo{}
+		row := tx.QueryRow("select * from "+cfg.UseSource+
+			" where drugName = ? AND drugRoute = ?", subs[i].DrugName, subs[i].DrugRoute)
+		err = scanDrugInfo(row, &oldInfo)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = cfg.execInfoInsert(db, ctx, insStmt, &subs[i], timeOfFetch)
+			err = handleErrRollbackSeq(err, tx, printN, "insStmt.Exec(): ")
+			if err != nil {
+				return err, nil
+			}
+			routeDiff.Status = InfoRouteInserted
+			infoDiff = append(infoDiff, routeDiff)
+			continue
+		}
+		err = handleErrRollbackSeq(err, tx, printN, "row.Scan(): ")
+		if err != nil {
+			return err, nil
+		}
+
+		routeDiff.Fields = diffDrugInfo(oldInfo, subs[i])
+		if len(routeDiff.Fields) != 0 {
+			routeDiff.Status = InfoRouteUpdated
+		}
+
+		_, err = updStmt.Exec(subs[i].Threshold,
 			subs[i].LowDoseMin,
 			subs[i].LowDoseMax,
 			subs[i].MediumDoseMin,
@@ -92,23 +301,204 @@ func (cfg *Config) AddToInfoTable(db *sql.DB, ctx context.Context,
 			subs[i].TotalDurMin,
 			subs[i].TotalDurMax,
 			subs[i].TotalDurUnits,
-			time.Now().Unix())
-		if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "stmt.Exec(): ") {
-			return tempErrInfo
+			subs[i].TimeOfFetch,
+			subs[i].DrugName,
+			subs[i].DrugRoute)
+		err = handleErrRollbackSeq(err, tx, printN, "updStmt.Exec(): ")
+		if err != nil {
+			return err, nil
+		}
+
+		infoDiff = append(infoDiff, routeDiff)
+	}
+
+	if replace {
+		err, removed := cfg.removeMissingRoutesTx(ctx, tx, subs)
+		err = handleErrRollbackSeq(err, tx, printN, "")
+		if err != nil {
+			return err, nil
 		}
+		infoDiff = append(infoDiff, removed...)
+	}
+
+	err = cfg.addAuditEntry(ctx, tx, action, username, nil, nil, infoDiff)
+	err = handleErrRollbackSeq(err, tx, printN, "")
+	if err != nil {
+		return err, nil
 	}
+
 	err = tx.Commit()
-	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
-		return tempErrInfo
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+	if err != nil {
+		return err, nil
 	}
 
-	if errChannel != nil {
-		errChannel <- tempErrInfo
+	return nil, infoDiff
+}
+
+// Removes the routes of the drugs in subs from the info table, which
+// aren't in subs.
+func (cfg *Config) removeMissingRoutesTx(ctx context.Context, tx *sql.Tx,
+	subs []DrugInfo) (error, []InfoRouteDiff) {
+	const printN string = "removeMissingRoutesTx()"
+
+	keep := map[string]map[string]bool{}
+	for _, elem := range subs {
+		if keep[elem.DrugName] == nil {
+			keep[elem.DrugName] = map[string]bool{}
+		}
+		keep[elem.DrugName][elem.DrugRoute] = true
+	}
+
+	var removed []InfoRouteDiff
+	for drug, routes := range keep {
+		err, oldInfo := cfg.drugInfoTx(ctx, tx, drug)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err), nil
+		}
+
+		for _, elem := range oldInfo {
+			if routes[elem.DrugRoute] {
+				continue
+			}
+
+			_, err = tx.ExecContext(ctx, "delete from "+cfg.UseSource+
+				" where drugName = ? AND drugRoute = ?", elem.DrugName, elem.DrugRoute)
+			if err != nil {
+				return fmt.Errorf("%s%w", sprintName(printN, "tx.ExecContext(): "), err), nil
+			}
+
+			removed = append(removed, InfoRouteDiff{
+				DrugName:  elem.DrugName,
+				DrugRoute: elem.DrugRoute,
+				Status:    InfoRouteRemoved,
+				Fields:    nil,
+			})
+		}
+	}
+
+	return nil, removed
+}
+
+// UpdateFromSource fetches a drug from the given source and adds it to the
+// info table like UpsertInfoTable(), routes which the source doesn't have
+// anymore are removed. Unlike FetchFromSource(), the fetch is done even if
+// the drug is already present in the info table and AutoFetch doesn't need
+// to be enabled, since the update is requested explicitly. If the fetch
+// fails, the info table isn't changed.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// infoDiffErrChan - the goroutine channel used to return what happened to
+// every route and the error
+// (set to nil if function doesn't need to be concurrent)
+//
+// drugname - the name of the substance to update
+//
+// username - the user requesting the update
+//
+// src - the source to fetch the information from, best done using
+// InitSource(), which picks the source configured with UseSource
+func (cfg *Config) UpdateFromSource(db *sql.DB, ctx context.Context,
+	infoDiffErrChan chan<- InfoDiffError, drugname string, username string,
+	src Source) InfoDiffError {
+	const printN string = "UpdateFromSource()"
+
+	tempInfoDiffErr := InfoDiffError{
+		InfoDiff: nil,
+		Username: username,
+		Err:      nil,
+	}
+
+	err, infoDiff := cfg.updateFromSource(db, ctx, drugname, username, src, ActionUpsertInfoTable)
+	if err != nil {
+		tempInfoDiffErr.Err = fmt.Errorf("%s%w", sprintName(printN), err)
+		if infoDiffErrChan != nil {
+			infoDiffErrChan <- tempInfoDiffErr
+		}
+		return tempInfoDiffErr
+	}
+
+	tempInfoDiffErr.InfoDiff = infoDiff
+	if infoDiffErrChan != nil {
+		infoDiffErrChan <- tempInfoDiffErr
+	}
+	return tempInfoDiffErr
+}
+
+// Used by UpdateFromSource() and RefreshInfo(), the change is recorded in
+// the audit log using action.
+func (cfg *Config) updateFromSource(db *sql.DB, ctx context.Context, drugname string,
+	username string, src Source, action string) (error, []InfoRouteDiff) {
+	const printN string = "updateFromSource()"
+
+	if src == nil {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), NoValidSourceSel, cfg.UseSource), nil
+	}
+
+	drugname = cfg.MatchAndReplace(db, ctx, drugname, NameTypeSubstance)
+
+	printNameF(printN, "Updating from source: %q ; substance: %q\n", cfg.UseSource, drugname)
+
+	err, infoDrug := src.FetchSubstance(ctx, drugname)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "While fetching from: ", cfg.UseSource,
+			" ; keeping old data ; error: "), err), nil
+	}
+
+	if len(infoDrug) == 0 {
+		return fmt.Errorf("%s%w", sprintName(printN), StructSliceEmpty), nil
+	}
+
+	err, infoDiff := cfg.upsertInfoTx(db, ctx, infoDrug, username, action, true)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	cfg.fetchSourceInteractions(db, ctx, src, drugname)
+
+	return nil, infoDiff
+}
+
+// PrintInfoDiff prints the routes returned by UpsertInfoTable() and all
+// fields which were changed.
+//
+// infoDiff - the slice returned by UpsertInfoTable()
+//
+// prefix - whether to add the function name to console output
+func (cfg *Config) PrintInfoDiff(infoDiff []InfoRouteDiff, prefix bool) {
+	var printN string
+	if prefix == true {
+		printN = "PrintInfoDiff()"
+	} else {
+		printN = ""
+	}
+
+	for _, elem := range infoDiff {
+		printNameF(printN, "Drug: %q ; Route: %q ; %s\n", elem.DrugName, elem.DrugRoute, elem.Status)
+		for _, field := range elem.Fields {
+			printNameF(printN, "\t%s: %q -> %q\n", field.Field, field.Old, field.New)
+		}
 	}
-	return tempErrInfo
 }
 
 // AddToDoseTable adds a new logged dose to the local database.
+// When the source has ranges for the drug and route, the class of the dose
+// is returned in ErrorInfo.Warnings, wrapping DoseClassWarning,
+// HeavyDoseWarning or DoseBelowThresholdError. To ask the user before logging
+// a heavy dose, use GetDoseClass() first. For alcohol in grams, when the weight
+// of the user is set, BACEstimateWarning is returned with the highest blood
+// alcohol concentration from the dose, checkout EstimateBAC(). When there's
+// still tolerance from previous doses, checkout GetTolerance(),
+// ToleranceWarning is returned too.
+// For every substance which shares tolerance with the drug and was logged
+// recently, checkout GetCrossTolerance(), CrossToleranceWarning is returned.
+// For every active log which interacts with the drug, checkout GetInteraction(),
+// InteractionWarning or DangerousInteractionWarning is returned.
+// Every kind of warning can be disabled for the user using the warn-*
+// preferences, checkout SetUserPref().
 //
 // db - open database connection
 //
@@ -118,20 +508,24 @@ func (cfg *Config) AddToInfoTable(db *sql.DB, ctx context.Context,
 // (set to nil if function doesn't need to be concurrent)
 //
 // synct - pointer to SyncTimestamps struct used for synchronizing all AddToDoseTable() goroutines,
-// it makes sure no conflicts happen when new doses are added
+// it makes sure the logs of a user are checked against MaxLogsPerUser
+// (and removed if AutoRemove is enabled) by only one goroutine at a time
+// and if two doses for the same user get the same start time, the later one
+// (including its end time) is moved forward by one second
 // (set to nil if function doesn't need to be concurrent)
 //
-// user - the username to log, if the same timestamps for the same username are chosen,
-// the function will increment them all with 1 second to avoid conflicts
+// user - the username to log
 //
 // drug - the name of the drug to log, it has to be present in the local info (source) database
 //
 // route - the name of the route to log, examples begin oral, smoked, etc. and it has
-// to be present in the local info (source) database for the given drug
+// to be present in the local info (source) database for the given drug,
+// if empty the default-route preference of the user is used
 //
 // dose - the amount of drug to log
 //
-// units - the units to be used for dose (amount)
+// units - the units to be used for dose (amount), if empty the default-units
+// preference of the user is used
 //
 // perc - when not 0, will attempt to convert the amount and units to new amount and units
 // according to the configurations present in the database, checkout ConvertUnits() in
@@ -140,15 +534,36 @@ func (cfg *Config) AddToInfoTable(db *sql.DB, ctx context.Context,
 // cost - the cost in money for the log, it has to be calculated manually
 // using the total amount paid
 //
-// costCur - the currency the cost is in
+// costCur - the currency the cost is in, if empty the default-currency
+// preference of the user is used
 //
 // printit - when true, prints what has been added to the database in the terminal
 func (cfg *Config) AddToDoseTable(db *sql.DB, ctx context.Context, errChannel chan<- ErrorInfo,
 	synct *SyncTimestamps, user string, drug string, route string,
 	dose float32, units string, perc float32, cost float32, costCur string,
 	printit bool) ErrorInfo {
+	return cfg.AddToDoseTableAt(db, ctx, errChannel, synct, user, drug, route,
+		dose, units, perc, cost, costCur, 0, 0, printit)
+}
 
-	const printN string = "AddToDoseTable()"
+// AddToDoseTableAt is the same as AddToDoseTable(), but the start and end
+// times of the dose can be set, for example when logging a dose taken earlier.
+// The times can be gotten from a human input using ParseTimeInput().
+// Checkout AddToDoseTable() for the rest of the arguments.
+//
+// startTime - the unix time when the dose was taken, if 0 the current time
+// is used, it can't be in the future
+//
+// endTime - the unix time when the dose ended, for example when it was taken
+// over a longer period of time, if 0 no end time is set
+func (cfg *Config) AddToDoseTableAt(db *sql.DB, ctx context.Context, errChannel chan<- ErrorInfo,
+	synct *SyncTimestamps, user string, drug string, route string,
+	dose float32, units string, perc float32, cost float32, costCur string,
+	startTime int64, endTime int64, printit bool) ErrorInfo {
+
+	const printN string = "AddToDoseTableAt()"
+
+	route, units = cfg.DefaultRouteUnits(db, ctx, user, route, units)
 
 	drug = cfg.MatchAndReplace(db, ctx, drug, NameTypeSubstance)
 	route = cfg.MatchAndReplace(db, ctx, route, NameTypeRoute)
@@ -160,6 +575,28 @@ func (cfg *Config) AddToDoseTable(db *sql.DB, ctx context.Context, errChannel ch
 		Username: user,
 	}
 
+	now := time.Now().Unix()
+	if startTime > now {
+		tempErrInfo.Err = fmt.Errorf("%s%w: %d", sprintName(printN), StartTimeInFutureError, startTime)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	if startTime == 0 {
+		startTime = now
+	}
+
+	if endTime != 0 && endTime < startTime {
+		tempErrInfo.Err = fmt.Errorf("%s%w: start: %d ; end: %d", sprintName(printN),
+			EndBeforeStartError, startTime, endTime)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
 	var err error = nil
 	if perc != 0 {
 		err, dose, units = cfg.ConvertUnits(db, ctx, drug, dose, perc)
@@ -189,6 +626,50 @@ func (cfg *Config) AddToDoseTable(db *sql.DB, ctx context.Context, errChannel ch
 		return tempErrInfo
 	}
 
+	prefs := cfg.userPrefValues(db, ctx, user)
+
+	if prefs[PrefWarnDoseClass] == "true" {
+		err, class := cfg.classifyLocalDose(db, ctx, user, drug, route, dose, units)
+		if err != nil {
+			printNameVerbose(cfg.VerbosePrinting, printN, "Couldn't classify dose:", err)
+		}
+		classWarn := doseClassWarning(class, drug, route, dose, units)
+		if classWarn != nil {
+			tempErrInfo.Warnings = append(tempErrInfo.Warnings, classWarn)
+		}
+	}
+
+	if prefs[PrefWarnBAC] == "true" {
+		bacWarn := cfg.bacWarning(db, ctx, user, drug, dose, units)
+		if bacWarn != nil {
+			tempErrInfo.Warnings = append(tempErrInfo.Warnings, bacWarn)
+		}
+	}
+
+	if prefs[PrefWarnTolerance] == "true" {
+		gotToleranceErr := cfg.GetTolerance(db, ctx, nil, user, drug, startTime)
+		if gotToleranceErr.Err != nil {
+			printNameVerbose(cfg.VerbosePrinting, printN, "Couldn't estimate tolerance:", gotToleranceErr.Err)
+		}
+		tolWarn := cfg.toleranceWarning(gotToleranceErr.Tol)
+		if tolWarn != nil {
+			tempErrInfo.Warnings = append(tempErrInfo.Warnings, tolWarn)
+		}
+
+		gotCrossErr := cfg.GetCrossTolerance(db, ctx, nil, user, drug, startTime)
+		if gotCrossErr.Err != nil {
+			printNameVerbose(cfg.VerbosePrinting, printN, "Couldn't check cross-tolerance:", gotCrossErr.Err)
+		}
+		for _, elem := range gotCrossErr.CrossTols {
+			tempErrInfo.Warnings = append(tempErrInfo.Warnings, cfg.crossToleranceWarning(elem))
+		}
+	}
+
+	if prefs[PrefWarnInteractions] == "true" {
+		tempErrInfo.Warnings = append(tempErrInfo.Warnings,
+			cfg.activeInteractionWarnings(db, ctx, user, drug, startTime)...)
+	}
+
 	var count uint32
 	gotLogCountErr := cfg.GetLogsCount(db, ctx, user, nil)
 	err = gotLogCountErr.Err
@@ -246,9 +727,7 @@ func (cfg *Config) AddToDoseTable(db *sql.DB, ctx context.Context, errChannel ch
 		return tempErrInfo
 	}
 
-	stmt, err := tx.Prepare("insert into " + loggingTableName +
-		" (timeOfDoseStart, username, drugName, dose, doseUnits, drugRoute, cost, costCurrency) " +
-		"values(?, ?, ?, ?, ?, ?, ?, ?)")
+	stmt, err := tx.Prepare(cfg.insertLogStmt())
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Prepare(): ") {
 		return tempErrInfo
 	}
@@ -259,18 +738,30 @@ func (cfg *Config) AddToDoseTable(db *sql.DB, ctx context.Context, errChannel ch
 		synct.Lock.Lock()
 	}
 
-	currTime := time.Now().Unix()
+	currTime := startTime
 	if errChannel != nil && synct != nil {
-		if currTime <= synct.LastTimestamp && user == synct.LastUser {
-			currTime = synct.LastTimestamp + 1
+		currTime = synct.uniqueStartTime(user, startTime)
+		if endTime != 0 {
+			endTime += currTime - startTime
 		}
 	}
 
 	if costCur == "" && cost != 0 {
-		costCur = cfg.CostCurrency
+		costCur = cfg.userPrefValues(db, ctx, user)[PrefDefaultCurrency]
 	}
 
-	_, err = stmt.Exec(currTime, user, drug, dose, units, route, cost, costCur)
+	newLog := UserLog{
+		StartTime:    currTime,
+		Username:     user,
+		EndTime:      endTime,
+		DrugName:     drug,
+		Dose:         dose,
+		DoseUnits:    units,
+		DrugRoute:    route,
+		Cost:         cost,
+		CostCurrency: costCur,
+	}
+	err, newLog.ID = cfg.insertLog(ctx, stmt, newLog)
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "stmt.Exec(): ") {
 		if errChannel != nil && synct != nil {
 			// release lock
@@ -278,6 +769,19 @@ func (cfg *Config) AddToDoseTable(db *sql.DB, ctx context.Context, errChannel ch
 		}
 		return tempErrInfo
 	}
+
+	var ids []int64
+	if newLog.ID != 0 {
+		ids = []int64{newLog.ID}
+	}
+	err = cfg.addAuditEntry(ctx, tx, ActionAddToDoseTable, user, ids, nil, newLog)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		if errChannel != nil && synct != nil {
+			// release lock
+			synct.Lock.Unlock()
+		}
+		return tempErrInfo
+	}
 	err = tx.Commit()
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
 		if errChannel != nil && synct != nil {
@@ -287,11 +791,6 @@ func (cfg *Config) AddToDoseTable(db *sql.DB, ctx context.Context, errChannel ch
 		return tempErrInfo
 	}
 
-	if errChannel != nil && synct != nil {
-		synct.LastTimestamp = currTime
-		synct.LastUser = user
-	}
-
 	if errChannel != nil && synct != nil {
 		// release lock
 		synct.Lock.Unlock()
@@ -299,8 +798,8 @@ func (cfg *Config) AddToDoseTable(db *sql.DB, ctx context.Context, errChannel ch
 
 	if printit {
 		printNameF(printN, "Logged: drug: %q ; dose: %g ; units: %q ; route: %q ; username: %q "+
-			"; cost: %g ; costCurrency: %q\n",
-			drug, dose, units, route, user, cost, costCur)
+			"; cost: %g ; costCurrency: %q ; start: %d ; end: %d\n",
+			drug, dose, units, route, user, cost, costCur, currTime, endTime)
 	}
 
 	if errChannel != nil {
@@ -311,3 +810,5 @@ func (cfg *Config) AddToDoseTable(db *sql.DB, ctx context.Context, errChannel ch
 
 var ComboInputError error = errors.New("combo of input parameters not in database")
 var MaxLogsPerUserError error = errors.New("reached the maximum entries per user")
+var StartTimeInFutureError error = errors.New("the start time of the dose is in the future")
+var EndBeforeStartError error = errors.New("the end time is before the start time")
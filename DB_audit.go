@@ -0,0 +1,340 @@
+package drugdose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+const auditTableName string = "auditLog"
+
+// AuditEntry is a single change of the data in the database, recorded by
+// the function which made it, in the same transaction when possible.
+type AuditEntry struct {
+	ID int64
+	// The same as ErrorInfo.Action, for example ActionAddToDoseTable
+	Action   string
+	Username string
+	// The unix time of the change.
+	Time int64
+	// The IDs of the touched logs, empty if the change isn't about logs
+	// or the driver doesn't return the ID of a new log
+	AffectedIDs []int64
+	// The data before and after the change in JSON, empty if there's none,
+	// for example Before is empty for a new log.
+	Before string
+	After  string
+}
+
+// AuditFilter is used to choose which entries to get using GetAuditLog(),
+// fields which are empty or 0 aren't used for filtering.
+type AuditFilter struct {
+	Username string
+	Action   string
+	// The unix times between which the change was made, including them.
+	From int64
+	To   int64
+	// How many of the newest entries to return.
+	Limit int
+}
+
+type AuditLogError struct {
+	Entries  []AuditEntry
+	Username string
+	Err      error
+}
+
+// Both *sql.DB and *sql.Tx can be used to add an entry.
+type auditExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Returns the statement for adding a new log, to be prepared and used with
+// insertLog(). On PostgreSQL the statement returns the ID of the new log,
+// since the driver doesn't support LastInsertId().
+func (cfg *Config) insertLogStmt() string {
+	stmt := "insert into " + loggingTableName +
+		" (" + LogStartTimeCol + ", username, " + LogEndTimeCol + ", " + LogDrugNameCol + ", " +
+		LogDoseCol + ", " + LogDoseUnitsCol + ", " + LogDrugRouteCol + ", " +
+		LogCostCol + ", " + LogCostCurrencyCol + ") " +
+		"values(?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	if cfg.DBDriver == PostgresDriver {
+		stmt += " returning " + LogIDCol
+	}
+	return stmt
+}
+
+// Adds the log using the statement prepared from insertLogStmt(), the ID of
+// the log is ignored. Returns the ID of the new log, 0 if the driver
+// doesn't support getting it.
+func (cfg *Config) insertLog(ctx context.Context, stmt *sql.Stmt, userLog UserLog) (error, int64) {
+	args := []any{userLog.StartTime, userLog.Username, userLog.EndTime, userLog.DrugName,
+		userLog.Dose, userLog.DoseUnits, userLog.DrugRoute, userLog.Cost, userLog.CostCurrency}
+
+	if cfg.DBDriver == PostgresDriver {
+		var id int64
+		err := stmt.QueryRowContext(ctx, args...).Scan(&id)
+		if err != nil {
+			return err, 0
+		}
+		return nil, id
+	}
+
+	res, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return err, 0
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, 0
+	}
+	return nil, id
+}
+
+// Returns the IDs of the logs.
+func logIDs(userLogs []UserLog) []int64 {
+	var ids []int64
+	for _, elem := range userLogs {
+		ids = append(ids, elem.ID)
+	}
+	return ids
+}
+
+// Returns all rows of the info table using the transaction, used to record
+// them before the table is removed.
+func (cfg *Config) allDrugInfoTx(ctx context.Context, tx *sql.Tx) (error, []DrugInfo) {
+	const printN string = "allDrugInfoTx()"
+
+	rows, err := tx.QueryContext(ctx, "select * from "+cfg.UseSource)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "tx.QueryContext(): "), err), nil
+	}
+	defer rows.Close()
+
+	var allInfo []DrugInfo
+	for rows.Next() {
+		var tempInfo DrugInfo
+		err = scanDrugInfo(rows, &tempInfo)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err), nil
+		}
+		allInfo = append(allInfo, tempInfo)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "rows.Err(): "), err), nil
+	}
+
+	return nil, allInfo
+}
+
+// Returns all routes of a drug in the info table using the transaction,
+// used to record them before they're changed.
+func (cfg *Config) drugInfoTx(ctx context.Context, tx *sql.Tx, drug string) (error, []DrugInfo) {
+	const printN string = "drugInfoTx()"
+
+	rows, err := tx.QueryContext(ctx, "select * from "+cfg.UseSource+" where drugName = ?", drug)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "tx.QueryContext(): "), err), nil
+	}
+	defer rows.Close()
+
+	var infoDrug []DrugInfo
+	for rows.Next() {
+		var tempInfo DrugInfo
+		err = scanDrugInfo(rows, &tempInfo)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err), nil
+		}
+		infoDrug = append(infoDrug, tempInfo)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "rows.Err(): "), err), nil
+	}
+
+	return nil, infoDrug
+}
+
+// Records a change in the audit table, before and after are converted
+// to JSON, if nil they're stored as empty. Use the transaction of the change
+// as exec when possible, so that the change isn't made if it can't be
+// recorded.
+func (cfg *Config) addAuditEntry(ctx context.Context, exec auditExecer, action string,
+	username string, ids []int64, before any, after any) error {
+	const printN string = "addAuditEntry()"
+
+	toJSON := func(data any) (error, string) {
+		if data == nil {
+			return nil, ""
+		}
+		got, err := json.Marshal(data)
+		if err != nil {
+			return err, ""
+		}
+		return nil, string(got)
+	}
+
+	err, beforeStr := toJSON(before)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "json.Marshal(): "), err)
+	}
+	err, afterStr := toJSON(after)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "json.Marshal(): "), err)
+	}
+
+	var idStrs []string
+	for _, id := range ids {
+		idStrs = append(idStrs, strconv.FormatInt(id, 10))
+	}
+
+	_, err = exec.ExecContext(ctx, "insert into "+auditTableName+
+		" (action, username, changedAt, affectedIDs, snapshotBefore, snapshotAfter) "+
+		"values(?, ?, ?, ?, ?, ?)", action, username, time.Now().Unix(),
+		strings.Join(idStrs, ","), beforeStr, afterStr)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "ExecContext(): "), err)
+	}
+
+	return nil
+}
+
+// GetAuditLog returns the recorded changes, from the newest to the oldest.
+// Every function which changes the logs, the user settings, preferences,
+// presets, the history or the info table records what it changed.
+// The names, cross-tolerance and interactions tables are filled from
+// the config files, so they aren't recorded.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// auditErrChan - the goroutine channel which returns the entries
+// and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// filter - which entries to return, checkout AuditFilter
+func (cfg *Config) GetAuditLog(db *sql.DB, ctx context.Context,
+	auditErrChan chan<- AuditLogError, filter AuditFilter) AuditLogError {
+	const printN string = "GetAuditLog()"
+
+	tempAuditErr := AuditLogError{
+		Entries:  nil,
+		Username: filter.Username,
+		Err:      nil,
+	}
+
+	var conds []string
+	var args []any
+	if filter.Username != "" {
+		conds = append(conds, "username = ?")
+		args = append(args, filter.Username)
+	}
+	if filter.Action != "" {
+		conds = append(conds, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.From != 0 {
+		conds = append(conds, "changedAt >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != 0 {
+		conds = append(conds, "changedAt <= ?")
+		args = append(args, filter.To)
+	}
+
+	query := "select auditID, action, username, changedAt, affectedIDs, snapshotBefore, snapshotAfter " +
+		"from " + auditTableName
+	if len(conds) != 0 {
+		query += " where " + strings.Join(conds, " and ")
+	}
+	query += " order by auditID desc"
+	if filter.Limit > 0 {
+		query += " limit " + strconv.Itoa(filter.Limit)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		tempAuditErr.Err = fmt.Errorf("%s%w", sprintName(printN, "db.QueryContext(): "), err)
+		if auditErrChan != nil {
+			auditErrChan <- tempAuditErr
+		}
+		return tempAuditErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tempEntry AuditEntry
+		var ids string
+		err = rows.Scan(&tempEntry.ID, &tempEntry.Action, &tempEntry.Username, &tempEntry.Time,
+			&ids, &tempEntry.Before, &tempEntry.After)
+		if err != nil {
+			tempAuditErr.Err = fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err)
+			if auditErrChan != nil {
+				auditErrChan <- tempAuditErr
+			}
+			return tempAuditErr
+		}
+
+		for _, elem := range strings.Split(ids, ",") {
+			id, err := strconv.ParseInt(elem, 10, 64)
+			if err == nil {
+				tempEntry.AffectedIDs = append(tempEntry.AffectedIDs, id)
+			}
+		}
+
+		tempAuditErr.Entries = append(tempAuditErr.Entries, tempEntry)
+	}
+
+	if auditErrChan != nil {
+		auditErrChan <- tempAuditErr
+	}
+	return tempAuditErr
+}
+
+// PrintAuditLog prints the entries gotten using GetAuditLog().
+//
+// entries - the entries to print
+//
+// prefix - if true, adds the function name to every print
+func (cfg *Config) PrintAuditLog(entries []AuditEntry, prefix bool) error {
+	var printN string
+	if prefix == true {
+		printN = "PrintAuditLog()"
+	} else {
+		printN = ""
+	}
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		err = fmt.Errorf("%s%w", sprintName(printN, "LoadLocation: "), err)
+		return err
+	}
+
+	for _, elem := range entries {
+		printNameF(printN, "ID: %d ; Time: %s ; User: %q ; Action: %q ; IDs: %v\n",
+			elem.ID, time.Unix(elem.Time, 0).In(location).Format("2006-01-02 15:04:05"),
+			elem.Username, elem.Action, elem.AffectedIDs)
+		if elem.Before != "" {
+			printName(printN, "\tBefore:", elem.Before)
+		}
+		if elem.After != "" {
+			printName(printN, "\tAfter:", elem.After)
+		}
+	}
+
+	return nil
+}
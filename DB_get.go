@@ -76,6 +76,23 @@ func (cfg *Config) GetDBSize() int64 {
 			return 0
 		}
 
+		return totalSize
+	} else if cfg.DBDriver == PostgresDriver {
+		db, err := sql.Open(cfg.sqlDriverName(), cfg.DBSettings[cfg.DBDriver].Path)
+		if err != nil {
+			errorCantOpenDB(cfg.DBSettings[cfg.DBDriver].Path, err, printN)
+		}
+		defer db.Close()
+
+		var totalSize int64
+
+		row := db.QueryRow("select pg_database_size(current_database())")
+		err = row.Scan(&totalSize)
+		if err != nil {
+			printName(printN, "Error getting size:", err)
+			return 0
+		}
+
 		return totalSize
 	}
 
@@ -211,7 +228,8 @@ func (cfg *Config) GetLogsCount(db *sql.DB, ctx context.Context, user string,
 //
 // num - amount of logs to return (limit), if 0 returns all logs (without limit)
 //
-// id - if not 0, will return the exact log matching that id for the given user
+// id - if not 0, will return the exact log matching that ID for the given user,
+// checkout UserLog.ID
 //
 // user - the user which created the logs, will returns only the logs for that
 // username
@@ -275,10 +293,10 @@ func (cfg *Config) GetLogs(db *sql.DB, ctx context.Context,
 				LogCostCol,
 				LogCostCurrencyCol}
 			searchArr = append(searchArr, user)
-			searchStmt += "and (" + searchColumns[0] + " like ? "
+			searchStmt += "and (" + cfg.likeStmt(searchColumns[0]) + " "
 			searchArr = append(searchArr, "%"+search+"%")
 			for i := 1; i < len(searchColumns); i++ {
-				searchStmt += "or " + searchColumns[i] + " like ? "
+				searchStmt += "or " + cfg.likeStmt(searchColumns[i]) + " "
 				searchArr = append(searchArr, "%"+search+"%")
 			}
 			searchStmt += ") "
@@ -290,7 +308,7 @@ func (cfg *Config) GetLogs(db *sql.DB, ctx context.Context,
 	}
 
 	mainQuery := "select * from " + loggingTableName + " where username = ? " + searchStmt +
-		"order by timeOfDoseStart " + orientation + endstmt
+		"order by " + LogStartTimeCol + " " + orientation + ", " + LogIDCol + " " + orientation + endstmt
 	stmt, err := db.PrepareContext(ctx, mainQuery)
 	if err != nil {
 		tempUserLogsError.Err = fmt.Errorf("%s: %w", sprintName(printN, "db.PrepareContext()"), err)
@@ -308,7 +326,7 @@ func (cfg *Config) GetLogs(db *sql.DB, ctx context.Context,
 		}
 	} else {
 		stmt, err = db.PrepareContext(ctx,
-			"select * from "+loggingTableName+" where username = ? and timeOfDoseStart = ?")
+			"select * from "+loggingTableName+" where username = ? and "+LogIDCol+" = ?")
 		if err != nil {
 			tempUserLogsError.Err = fmt.Errorf("%s: %w", sprintName(printN, "db.PrepareContext()"), err)
 			if userLogsErrorChannel != nil {
@@ -329,8 +347,7 @@ func (cfg *Config) GetLogs(db *sql.DB, ctx context.Context,
 
 	for rows.Next() {
 		tempul := UserLog{}
-		err = rows.Scan(&tempul.StartTime, &tempul.Username, &tempul.EndTime, &tempul.DrugName,
-			&tempul.Dose, &tempul.DoseUnits, &tempul.DrugRoute, &tempul.Cost, &tempul.CostCurrency)
+		err = scanUserLog(rows, &tempul)
 		if err != nil {
 			tempUserLogsError.Err = fmt.Errorf("%s: %w", sprintName(printN, "rows.Scan()"), err)
 			tempUserLogsError.UserLogs = userlogs
@@ -368,6 +385,47 @@ func (cfg *Config) GetLogs(db *sql.DB, ctx context.Context,
 	return tempUserLogsError
 }
 
+// Scans a single row of the logs table, selected with "select *", into
+// the given UserLog struct. Works for both sql.Rows and sql.Row.
+func scanUserLog(row interface{ Scan(...any) error }, tempul *UserLog) error {
+	return row.Scan(&tempul.ID, &tempul.StartTime, &tempul.Username, &tempul.EndTime, &tempul.DrugName,
+		&tempul.Dose, &tempul.DoseUnits, &tempul.DrugRoute, &tempul.Cost, &tempul.CostCurrency)
+}
+
+// Returns the logs of the user which started at or before the unix time at
+// and which started or ended at or after since, the newest first. Used when
+// only the recent logs are needed instead of the whole history.
+func (cfg *Config) getLogsBetween(db *sql.DB, ctx context.Context,
+	username string, since int64, at int64) (error, []UserLog) {
+	const printN string = "getLogsBetween()"
+
+	rows, err := db.QueryContext(ctx, "select * from "+loggingTableName+
+		" where username = ? and "+LogStartTimeCol+" <= ? and ("+
+		LogStartTimeCol+" >= ? or "+LogEndTimeCol+" >= ?) "+
+		"order by "+LogStartTimeCol+" desc, "+LogIDCol+" desc", username, at, since, since)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.QueryContext(): "), err), nil
+	}
+	defer rows.Close()
+
+	var userLogs []UserLog
+	for rows.Next() {
+		tempul := UserLog{}
+		err = scanUserLog(rows, &tempul)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err), nil
+		}
+		userLogs = append(userLogs, tempul)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "rows.Err(): "), err), nil
+	}
+
+	return nil, userLogs
+}
+
 // PrintLogs writes all logs present in userLogs to console.
 //
 // userLogs - the logs slice returned from GetLogs()
@@ -389,7 +447,8 @@ func (cfg *Config) PrintLogs(userLogs []UserLog, prefix bool) {
 	}
 
 	for _, elem := range userLogs {
-		printNameF(printN, "Start:\t%q (%d) < ID\n",
+		printNameF(printN, "ID:\t%d\n", elem.ID)
+		printNameF(printN, "Start:\t%q (%d)\n",
 			time.Unix(int64(elem.StartTime), 0).In(location), elem.StartTime)
 		if elem.EndTime != 0 {
 			printNameF(printN, "End:\t%q (%d)\n",
@@ -408,6 +467,21 @@ func (cfg *Config) PrintLogs(userLogs []UserLog, prefix bool) {
 	}
 }
 
+// Scans a single row of the info table, selected with "select *", into
+// the given DrugInfo struct. Works for both sql.Rows and sql.Row.
+func scanDrugInfo(row interface{ Scan(...any) error }, tempdrinfo *DrugInfo) error {
+	return row.Scan(&tempdrinfo.DrugName, &tempdrinfo.DrugRoute,
+		&tempdrinfo.Threshold,
+		&tempdrinfo.LowDoseMin, &tempdrinfo.LowDoseMax, &tempdrinfo.MediumDoseMin,
+		&tempdrinfo.MediumDoseMax, &tempdrinfo.HighDoseMin, &tempdrinfo.HighDoseMax,
+		&tempdrinfo.DoseUnits, &tempdrinfo.OnsetMin, &tempdrinfo.OnsetMax,
+		&tempdrinfo.OnsetUnits, &tempdrinfo.ComeUpMin, &tempdrinfo.ComeUpMax,
+		&tempdrinfo.ComeUpUnits, &tempdrinfo.PeakMin, &tempdrinfo.PeakMax,
+		&tempdrinfo.PeakUnits, &tempdrinfo.OffsetMin, &tempdrinfo.OffsetMax,
+		&tempdrinfo.OffsetUnits, &tempdrinfo.TotalDurMin, &tempdrinfo.TotalDurMax,
+		&tempdrinfo.TotalDurUnits, &tempdrinfo.TimeOfFetch)
+}
+
 // GetLocalInfo returns a slice containing all information about a drug.
 //
 // db - open database connection
@@ -460,16 +534,7 @@ func (cfg *Config) GetLocalInfo(db *sql.DB, ctx context.Context,
 	infoDrug := []DrugInfo{}
 	for rows.Next() {
 		tempdrinfo := DrugInfo{}
-		err := rows.Scan(&tempdrinfo.DrugName, &tempdrinfo.DrugRoute,
-			&tempdrinfo.Threshold,
-			&tempdrinfo.LowDoseMin, &tempdrinfo.LowDoseMax, &tempdrinfo.MediumDoseMin,
-			&tempdrinfo.MediumDoseMax, &tempdrinfo.HighDoseMin, &tempdrinfo.HighDoseMax,
-			&tempdrinfo.DoseUnits, &tempdrinfo.OnsetMin, &tempdrinfo.OnsetMax,
-			&tempdrinfo.OnsetUnits, &tempdrinfo.ComeUpMin, &tempdrinfo.ComeUpMax,
-			&tempdrinfo.ComeUpUnits, &tempdrinfo.PeakMin, &tempdrinfo.PeakMax,
-			&tempdrinfo.PeakUnits, &tempdrinfo.OffsetMin, &tempdrinfo.OffsetMax,
-			&tempdrinfo.OffsetUnits, &tempdrinfo.TotalDurMin, &tempdrinfo.TotalDurMax,
-			&tempdrinfo.TotalDurUnits, &tempdrinfo.TimeOfFetch)
+		err := scanDrugInfo(rows, &tempdrinfo)
 		if err != nil {
 			tempDrugInfoErr.Err = fmt.Errorf("%s%w", sprintName(printN), err)
 			if drugInfoErrChan != nil {
@@ -0,0 +1,378 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+const logHistoryTableName string = "logHistory"
+
+const ActionUndoLogChanges string = "undoing log changes completed"
+const ActionPurgeLogHistory string = "purging log history completed"
+
+// The kinds of operations kept in the log history.
+const HistoryRemove string = "remove"
+const HistoryChange string = "change"
+
+// The columns of a log, in the same order as in UserLog.
+func historyLogCols() []string {
+	return []string{LogIDCol, LogStartTimeCol, "username", LogEndTimeCol, LogDrugNameCol,
+		LogDoseCol, LogDoseUnitsCol, LogDrugRouteCol, LogCostCol, LogCostCurrencyCol}
+}
+
+// Returns the logs matching the condition, using the transaction.
+func selectLogsTx(ctx context.Context, tx *sql.Tx, where string, args ...any) (error, []UserLog) {
+	const printN string = "selectLogsTx()"
+
+	rows, err := tx.QueryContext(ctx, "select "+strings.Join(historyLogCols(), ", ")+
+		" from "+loggingTableName+" where "+where, args...)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "tx.QueryContext(): "), err), nil
+	}
+	defer rows.Close()
+
+	var userLogs []UserLog
+	for rows.Next() {
+		var tempLog UserLog
+		err = rows.Scan(&tempLog.ID, &tempLog.StartTime, &tempLog.Username, &tempLog.EndTime,
+			&tempLog.DrugName, &tempLog.Dose, &tempLog.DoseUnits, &tempLog.DrugRoute,
+			&tempLog.Cost, &tempLog.CostCurrency)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err), nil
+		}
+		userLogs = append(userLogs, tempLog)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "rows.Err(): "), err), nil
+	}
+
+	return nil, userLogs
+}
+
+// Copies the logs matching the condition to the history table before they're
+// removed or changed. It uses the same transaction as the removal or change,
+// so that either both happen or neither. All copied logs get the same
+// operation number, so that they're restored together, checkout
+// UndoLogChanges(). The copied logs are returned.
+func (cfg *Config) saveLogHistory(ctx context.Context, tx *sql.Tx, action string,
+	changedBy string, where string, args ...any) (error, []UserLog) {
+	const printN string = "saveLogHistory()"
+
+	err, userLogs := selectLogsTx(ctx, tx, where, args...)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+	if len(userLogs) == 0 {
+		return nil, nil
+	}
+
+	var operation int64
+	err = tx.QueryRowContext(ctx, "select coalesce(max(operation), 0) from "+
+		logHistoryTableName).Scan(&operation)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "tx.QueryRowContext(): "), err), nil
+	}
+	operation++
+
+	stmt, err := tx.PrepareContext(ctx, "insert into "+logHistoryTableName+
+		" (operation, action, changedBy, changedAt, "+strings.Join(historyLogCols(), ", ")+") "+
+		"values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "tx.PrepareContext(): "), err), nil
+	}
+	defer stmt.Close()
+
+	changedAt := time.Now().Unix()
+	for _, elem := range userLogs {
+		_, err = stmt.ExecContext(ctx, operation, action, changedBy, changedAt,
+			elem.ID, elem.StartTime, elem.Username, elem.EndTime, elem.DrugName,
+			elem.Dose, elem.DoseUnits, elem.DrugRoute, elem.Cost, elem.CostCurrency)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN, "stmt.ExecContext(): "), err), nil
+		}
+	}
+
+	return nil, userLogs
+}
+
+// Puts the log back in the logs table, the same as it was before it was
+// removed or changed.
+func restoreLogTx(ctx context.Context, tx *sql.Tx, userLog UserLog) error {
+	const printN string = "restoreLogTx()"
+
+	var count int
+	err := tx.QueryRowContext(ctx, "select count(*) from "+loggingTableName+
+		" where "+LogIDCol+" = ?", userLog.ID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "tx.QueryRowContext(): "), err)
+	}
+
+	if count == 0 {
+		_, err = tx.ExecContext(ctx, "insert into "+loggingTableName+
+			" ("+strings.Join(historyLogCols(), ", ")+") "+
+			"values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", userLog.ID, userLog.StartTime,
+			userLog.Username, userLog.EndTime, userLog.DrugName, userLog.Dose,
+			userLog.DoseUnits, userLog.DrugRoute, userLog.Cost, userLog.CostCurrency)
+	} else {
+		_, err = tx.ExecContext(ctx, "update "+loggingTableName+" set "+
+			strings.Join(historyLogCols()[1:], " = ?, ")+" = ? where "+LogIDCol+" = ?",
+			userLog.StartTime, userLog.Username, userLog.EndTime, userLog.DrugName,
+			userLog.Dose, userLog.DoseUnits, userLog.DrugRoute, userLog.Cost,
+			userLog.CostCurrency, userLog.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "tx.ExecContext(): "), err)
+	}
+
+	return nil
+}
+
+// UndoLogChanges restores the logs from the last operations of a user,
+// starting from the newest one. Every call to RemoveLogs() or ChangeUserLog()
+// is a single operation, no matter how many logs it touched. Restored
+// operations are removed from the history, so they can't be undone twice.
+// If there's nothing to undo, NoLogHistoryError is returned.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// errChannel - the gorouting channel which returns the errors
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user who removed or changed the logs
+//
+// amount - how many operations to undo, if 0 all operations in the history
+// are undone
+func (cfg *Config) UndoLogChanges(db *sql.DB, ctx context.Context,
+	errChannel chan<- ErrorInfo, username string, amount int) ErrorInfo {
+	const printN string = "UndoLogChanges()"
+
+	tempErrInfo := ErrorInfo{
+		Err:      nil,
+		Username: username,
+		Action:   ActionUndoLogChanges,
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%s: %w", sprintName(printN), "db.BeginTx()", err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	rows, err := tx.QueryContext(ctx, "select distinct operation from "+logHistoryTableName+
+		" where changedBy = ? order by operation desc", username)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.QueryContext(): ") {
+		return tempErrInfo
+	}
+
+	var operations []int64
+	for rows.Next() && (amount == 0 || len(operations) < amount) {
+		var operation int64
+		err = rows.Scan(&operation)
+		if err != nil {
+			rows.Close()
+			handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "rows.Scan(): ")
+			return tempErrInfo
+		}
+		operations = append(operations, operation)
+	}
+	err = rows.Err()
+	rows.Close()
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "rows.Err(): ") {
+		return tempErrInfo
+	}
+
+	if len(operations) == 0 {
+		tx.Rollback()
+		tempErrInfo.Err = fmt.Errorf("%s%w: %s", sprintName(printN), NoLogHistoryError, username)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	var restored []UserLog
+	for _, operation := range operations {
+		rows, err := tx.QueryContext(ctx, "select "+strings.Join(historyLogCols(), ", ")+
+			" from "+logHistoryTableName+" where operation = ? order by historyID desc", operation)
+		if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.QueryContext(): ") {
+			return tempErrInfo
+		}
+
+		var userLogs []UserLog
+		for rows.Next() {
+			var tempLog UserLog
+			err = rows.Scan(&tempLog.ID, &tempLog.StartTime, &tempLog.Username, &tempLog.EndTime,
+				&tempLog.DrugName, &tempLog.Dose, &tempLog.DoseUnits, &tempLog.DrugRoute,
+				&tempLog.Cost, &tempLog.CostCurrency)
+			if err != nil {
+				rows.Close()
+				handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "rows.Scan(): ")
+				return tempErrInfo
+			}
+			userLogs = append(userLogs, tempLog)
+		}
+		err = rows.Err()
+		rows.Close()
+		if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "rows.Err(): ") {
+			return tempErrInfo
+		}
+
+		for _, elem := range userLogs {
+			err = restoreLogTx(ctx, tx, elem)
+			if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+				return tempErrInfo
+			}
+			restored = append(restored, elem)
+		}
+
+		_, err = tx.ExecContext(ctx, "delete from "+logHistoryTableName+
+			" where operation = ?", operation)
+		if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.ExecContext(): ") {
+			return tempErrInfo
+		}
+	}
+
+	err = cfg.addAuditEntry(ctx, tx, ActionUndoLogChanges, username, logIDs(restored), nil, restored)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
+	err = tx.Commit()
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
+		return tempErrInfo
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Undone operations:", len(operations),
+		"; restored logs:", len(restored), "; for user:", username)
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+// GetMaxHistoryAge returns the parsed MaxHistoryAge from the Config struct.
+// If it's disabled, 0 is returned.
+func (cfg *Config) GetMaxHistoryAge() (error, time.Duration) {
+	const printN string = "GetMaxHistoryAge()"
+
+	if cfg.MaxHistoryAge == "" || cfg.MaxHistoryAge == "none" {
+		return nil, 0
+	}
+
+	maxAge, err := time.ParseDuration(cfg.MaxHistoryAge)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), 0
+	}
+
+	if maxAge < 0 {
+		return fmt.Errorf("%s%w: %q", sprintName(printN), InvalidMaxHistoryAgeError, cfg.MaxHistoryAge), 0
+	}
+
+	return nil, maxAge
+}
+
+// PurgeLogHistory permanently removes the operations which are older than
+// MaxHistoryAge in the settings file, so they can't be undone anymore.
+// If MaxHistoryAge is disabled, nothing is removed.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// errChannel - the gorouting channel which returns the errors
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to remove the history, if empty
+// the history of all users is removed
+func (cfg *Config) PurgeLogHistory(db *sql.DB, ctx context.Context,
+	errChannel chan<- ErrorInfo, username string) ErrorInfo {
+	const printN string = "PurgeLogHistory()"
+
+	tempErrInfo := ErrorInfo{
+		Err:      nil,
+		Username: username,
+		Action:   ActionPurgeLogHistory,
+	}
+
+	err, maxAge := cfg.GetMaxHistoryAge()
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	if maxAge == 0 {
+		printNameVerbose(cfg.VerbosePrinting, printN, "MaxHistoryAge is disabled, nothing is purged.")
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	olderThan := time.Now().Add(-maxAge).Unix()
+	stmtStr := "delete from " + logHistoryTableName + " where changedAt < ?"
+	args := []any{olderThan}
+	if username != "" {
+		stmtStr += " and changedBy = ?"
+		args = append(args, username)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%s: %w", sprintName(printN), "db.BeginTx()", err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	res, err := tx.ExecContext(ctx, stmtStr, args...)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.ExecContext(): ") {
+		return tempErrInfo
+	}
+
+	purged, err := res.RowsAffected()
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "res.RowsAffected(): ") {
+		return tempErrInfo
+	}
+
+	err = cfg.addAuditEntry(ctx, tx, ActionPurgeLogHistory, username, nil, nil,
+		map[string]int64{"purged": purged, "olderThan": olderThan})
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
+	err = tx.Commit()
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
+		return tempErrInfo
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Purged logs from history:", purged)
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+var NoLogHistoryError error = errors.New("there's nothing to undo for user")
+var InvalidMaxHistoryAgeError error = errors.New("MaxHistoryAge can't be negative")
@@ -82,10 +82,7 @@ func (cfg *Config) InitInfoTable(db *sql.DB, ctx context.Context) error {
 		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
 	}
 
-	caseInsensitive := " "
-	if cfg.DBDriver == SqliteDriver {
-		caseInsensitive = " COLLATE NOCASE "
-	}
+	caseInsensitive := cfg.caseInsensitive()
 
 	initDBsql := "create table " + cfg.UseSource + " (drugName varchar(255)" + caseInsensitive + "not null," +
 		"drugRoute varchar(255)" + caseInsensitive + "not null," +
@@ -132,6 +129,9 @@ func (cfg *Config) InitInfoTable(db *sql.DB, ctx context.Context) error {
 	return nil
 }
 
+// The automatically generated ID of every log. It never changes,
+// so it can't be set using ChangeUserLog().
+const LogIDCol string = "logID"
 const LogStartTimeCol string = "timeOfDoseStart"
 const LogEndTimeCol string = "timeOfDoseEnd"
 const LogDrugNameCol string = "drugName"
@@ -153,6 +153,34 @@ func validInfoCols() []string {
 	return []string{InfoDrugNameCol, InfoRouteCol}
 }
 
+// Returns the column definition for an automatically incremented ID,
+// which is also the primary key of the table.
+func (cfg *Config) autoIncrementID(col string) string {
+	if cfg.DBDriver == SqliteDriver {
+		// autoincrement makes sure IDs of removed logs aren't used again
+		return col + " integer primary key autoincrement"
+	} else if cfg.DBDriver == PostgresDriver {
+		return col + " bigint generated by default as identity primary key"
+	}
+	return col + " bigint not null auto_increment primary key"
+}
+
+// Returns the statement for creating the logs table using the given name.
+func (cfg *Config) logsTableStmt(name string) string {
+	caseInsensitive := cfg.caseInsensitive()
+
+	return "create table " + name + " (" + cfg.autoIncrementID(LogIDCol) + "," +
+		LogStartTimeCol + " bigint not null," +
+		"username varchar(255) not null," +
+		LogEndTimeCol + " bigint default 0 not null," +
+		LogDrugNameCol + " text" + caseInsensitive + "not null," +
+		LogDoseCol + " real not null," +
+		LogDoseUnitsCol + " text" + caseInsensitive + "not null," +
+		LogDrugRouteCol + " text" + caseInsensitive + "not null," +
+		LogCostCol + " real default 0 not null," +
+		LogCostCurrencyCol + " text" + caseInsensitive + "default '' not null);"
+}
+
 // InitLogsTable creates the table for all user drug logs if it doesn't exist.
 //
 // db - open database connection
@@ -171,21 +199,143 @@ func (cfg *Config) InitLogsTable(db *sql.DB, ctx context.Context) error {
 		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
 	}
 
-	caseInsensitive := " "
-	if cfg.DBDriver == SqliteDriver {
-		caseInsensitive = " COLLATE NOCASE "
+	_, err = tx.Exec(cfg.logsTableStmt(loggingTableName))
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+	if err != nil {
+		return err
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Created: 'userLogs' table in database.")
+
+	return nil
+}
+
+// Returns the statement for creating the user settings table using the given name.
+func userSetTableStmt(name string) string {
+	return "create table " + name + " (username varchar(255) not null," +
+		rememberIDTableName + " bigint not null," +
+		"primary key (username));"
+}
+
+// InitUserSetTable creates the table for all user settings if it doesn't exist.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+func (cfg *Config) InitUserSetTable(db *sql.DB, ctx context.Context) error {
+	const printN string = "InitUserSetTable()"
+
+	ret := cfg.CheckTables(db, ctx, userSetTableName)
+	if ret {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
+	}
+
+	_, err = tx.Exec(userSetTableStmt(userSetTableName))
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+	if err != nil {
+		return err
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Created: 'userSettings' table in database.")
+
+	return nil
+}
+
+// InitAuditTable creates the table for recording all changes of the data
+// if it doesn't exist, checkout GetAuditLog().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+func (cfg *Config) InitAuditTable(db *sql.DB, ctx context.Context) error {
+	const printN string = "InitAuditTable()"
+
+	ret := cfg.CheckTables(db, ctx, auditTableName)
+	if ret {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
 	}
 
-	initDBsql := "create table " + loggingTableName + " (timeOfDoseStart bigint not null," +
+	initDBsql := "create table " + auditTableName + " (" + cfg.autoIncrementID("auditID") + "," +
+		"action varchar(255) not null," +
 		"username varchar(255) not null," +
-		"timeOfDoseEnd bigint default 0 not null," +
-		LogDrugNameCol + " text" + caseInsensitive + "not null," +
+		"changedAt bigint not null," +
+		"affectedIDs text not null," +
+		"snapshotBefore text not null," +
+		"snapshotAfter text not null);"
+
+	_, err = tx.Exec(initDBsql)
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+	if err != nil {
+		return err
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Created: '"+auditTableName+"' table in database.")
+
+	return nil
+}
+
+// InitLogHistoryTable creates the table for the removed and changed logs
+// if it doesn't exist, checkout UndoLogChanges().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+func (cfg *Config) InitLogHistoryTable(db *sql.DB, ctx context.Context) error {
+	const printN string = "InitLogHistoryTable()"
+
+	ret := cfg.CheckTables(db, ctx, logHistoryTableName)
+	if ret {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
+	}
+
+	initDBsql := "create table " + logHistoryTableName + " (" + cfg.autoIncrementID("historyID") + "," +
+		"operation bigint not null," +
+		"action varchar(255) not null," +
+		"changedBy varchar(255) not null," +
+		"changedAt bigint not null," +
+		LogIDCol + " bigint not null," +
+		LogStartTimeCol + " bigint not null," +
+		"username varchar(255) not null," +
+		LogEndTimeCol + " bigint default 0 not null," +
+		LogDrugNameCol + " text not null," +
 		LogDoseCol + " real not null," +
-		LogDoseUnitsCol + " text" + caseInsensitive + "not null," +
-		LogDrugRouteCol + " text" + caseInsensitive + "not null," +
+		LogDoseUnitsCol + " text not null," +
+		LogDrugRouteCol + " text not null," +
 		LogCostCol + " real default 0 not null," +
-		LogCostCurrencyCol + " text" + caseInsensitive + "default '' not null," +
-		"primary key (timeOfDoseStart, username));"
+		LogCostCurrencyCol + " text not null);"
 
 	_, err = tx.Exec(initDBsql)
 	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
@@ -199,20 +349,31 @@ func (cfg *Config) InitLogsTable(db *sql.DB, ctx context.Context) error {
 		return err
 	}
 
-	printNameVerbose(cfg.VerbosePrinting, printN, "Created: 'userLogs' table in database.")
+	printNameVerbose(cfg.VerbosePrinting, printN, "Created: '"+logHistoryTableName+"' table in database.")
 
 	return nil
 }
 
-// InitUserSetTable creates the table for all user settings if it doesn't exist.
+// Returns the statement for creating the user preferences table using the given name.
+func userPrefsTableStmt(name string) string {
+	return "create table " + name +
+		" (username varchar(255) not null," +
+		"prefKey varchar(255) not null," +
+		"prefType varchar(255) not null," +
+		"prefValue varchar(255) not null," +
+		"primary key (username, prefKey));"
+}
+
+// InitUserPrefsTable creates the table for the preferences of all users
+// if it doesn't exist, checkout SetUserPref().
 //
 // db - open database connection
 //
 // ctx - context to be passed to sql queries
-func (cfg *Config) InitUserSetTable(db *sql.DB, ctx context.Context) error {
-	const printN string = "InitUserSetTable()"
+func (cfg *Config) InitUserPrefsTable(db *sql.DB, ctx context.Context) error {
+	const printN string = "InitUserPrefsTable()"
 
-	ret := cfg.CheckTables(db, ctx, userSetTableName)
+	ret := cfg.CheckTables(db, ctx, userPrefsTableName)
 	if ret {
 		return nil
 	}
@@ -222,9 +383,52 @@ func (cfg *Config) InitUserSetTable(db *sql.DB, ctx context.Context) error {
 		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
 	}
 
-	initDBsql := "create table " + userSetTableName + " (username varchar(255) not null," +
-		"useIDForRemember bigint not null," +
-		"primary key (username));"
+	_, err = tx.Exec(userPrefsTableStmt(userPrefsTableName))
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+	if err != nil {
+		return err
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Created: '"+userPrefsTableName+"' table in database.")
+
+	return nil
+}
+
+// InitDosingPresetsTable creates the table for the dosing presets of all
+// users if it doesn't exist, checkout AddDosingPreset().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+func (cfg *Config) InitDosingPresetsTable(db *sql.DB, ctx context.Context) error {
+	const printN string = "InitDosingPresetsTable()"
+
+	ret := cfg.CheckTables(db, ctx, dosingPresetsTableName)
+	if ret {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
+	}
+
+	initDBsql := "create table " + dosingPresetsTableName +
+		" (username varchar(255) not null," +
+		"presetName varchar(255) not null," +
+		"drugName text not null," +
+		"drugRoute text not null," +
+		"doseUnits text not null," +
+		"perc real default 0 not null," +
+		"cost real default 0 not null," +
+		"costCurrency text not null," +
+		"primary key (username, presetName));"
 
 	_, err = tx.Exec(initDBsql)
 	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
@@ -238,7 +442,96 @@ func (cfg *Config) InitUserSetTable(db *sql.DB, ctx context.Context) error {
 		return err
 	}
 
-	printNameVerbose(cfg.VerbosePrinting, printN, "Created: 'userSettings' table in database.")
+	printNameVerbose(cfg.VerbosePrinting, printN, "Created: '"+dosingPresetsTableName+"' table in database.")
+
+	return nil
+}
+
+// InitCrossToleranceTable creates the table for the cross-tolerance groups
+// if it doesn't exist, checkout AddToCrossToleranceTable().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+func (cfg *Config) InitCrossToleranceTable(db *sql.DB, ctx context.Context) error {
+	const printN string = "InitCrossToleranceTable()"
+
+	ret := cfg.CheckTables(db, ctx, crossToleranceTableName)
+	if ret {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
+	}
+
+	caseInsensitive := cfg.caseInsensitive()
+
+	initDBsql := "create table " + crossToleranceTableName +
+		" (groupName varchar(255)" + caseInsensitive + "not null," +
+		"drugName varchar(255)" + caseInsensitive + "not null," +
+		"windowDays real not null," +
+		"primary key (groupName, drugName));"
+
+	_, err = tx.Exec(initDBsql)
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+	if err != nil {
+		return err
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Created: '"+crossToleranceTableName+"' table in database.")
+
+	return nil
+}
+
+// InitInteractionsTable creates the table for the interactions between
+// substances if it doesn't exist, checkout AddToInteractionsTable().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+func (cfg *Config) InitInteractionsTable(db *sql.DB, ctx context.Context) error {
+	const printN string = "InitInteractionsTable()"
+
+	ret := cfg.CheckTables(db, ctx, interactionsTableName)
+	if ret {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
+	}
+
+	caseInsensitive := cfg.caseInsensitive()
+
+	initDBsql := "create table " + interactionsTableName +
+		" (drugA varchar(255)" + caseInsensitive + "not null," +
+		"drugB varchar(255)" + caseInsensitive + "not null," +
+		"risk int not null," +
+		"origin varchar(255) not null," +
+		"primary key (drugA, drugB, origin));"
+
+	_, err = tx.Exec(initDBsql)
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+	if err != nil {
+		return err
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Created: '"+interactionsTableName+"' table in database.")
 
 	return nil
 }
@@ -296,10 +589,7 @@ func (cfg *Config) InitNamesAltTables(db *sql.DB, ctx context.Context, replace b
 		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
 	}
 
-	caseInsensitive := " "
-	if cfg.DBDriver == SqliteDriver {
-		caseInsensitive = " COLLATE NOCASE "
-	}
+	caseInsensitive := cfg.caseInsensitive()
 
 	if !subsExists {
 		initDBsql := "create table " + altNamesSubsTableName + tableSuffix +
@@ -375,6 +665,8 @@ func (cfg *Config) InitNamesAltTables(db *sql.DB, ctx context.Context, replace b
 // Even if the function is called every time the program is started, it should
 // not be an issue, since all called functions first check if the tables they're
 // trying to create already exist.
+// Before creating the tables, MigrateDB() is called to update the schema of
+// existing tables.
 //
 // db - open database connection
 //
@@ -382,7 +674,17 @@ func (cfg *Config) InitNamesAltTables(db *sql.DB, ctx context.Context, replace b
 func (cfg *Config) InitAllDBTables(db *sql.DB, ctx context.Context) error {
 	const printN string = "InitAllDBTables()"
 
-	err := cfg.InitInfoTable(db, ctx)
+	err := cfg.initPostgresCollation(db, ctx)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = cfg.MigrateDB(db, ctx, false)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = cfg.InitInfoTable(db, ctx)
 	if err != nil {
 		return fmt.Errorf("%s%w", sprintName(printN), err)
 	}
@@ -397,6 +699,26 @@ func (cfg *Config) InitAllDBTables(db *sql.DB, ctx context.Context) error {
 		return fmt.Errorf("%s%w", sprintName(printN), err)
 	}
 
+	err = cfg.InitLogHistoryTable(db, ctx)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = cfg.InitAuditTable(db, ctx)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = cfg.InitUserPrefsTable(db, ctx)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = cfg.InitDosingPresetsTable(db, ctx)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
 	err = cfg.InitNamesAltTables(db, ctx, false)
 	if err != nil {
 		return fmt.Errorf("%s%w", sprintName(printN), err)
@@ -407,6 +729,16 @@ func (cfg *Config) InitAllDBTables(db *sql.DB, ctx context.Context) error {
 		return fmt.Errorf("%s%w", sprintName(printN), err)
 	}
 
+	err = cfg.InitCrossToleranceTable(db, ctx)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = cfg.InitInteractionsTable(db, ctx)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
 	printNameVerbose(cfg.VerbosePrinting, printN, "Ran through all tables for initialisation.")
 
 	return nil
@@ -419,8 +751,9 @@ func (cfg *Config) InitAllDBTables(db *sql.DB, ctx context.Context) error {
 func (cfg *Config) InitAllDB(ctx context.Context) {
 	const printN string = "InitAllDB()"
 
-	if cfg.DBDriver != MysqlDriver && cfg.DBDriver != SqliteDriver {
-		printName(printN, "No proper driver selected. Choose "+SqliteDriver+" or "+MysqlDriver+"!")
+	if cfg.DBDriver != MysqlDriver && cfg.DBDriver != SqliteDriver && cfg.DBDriver != PostgresDriver {
+		printName(printN, "No proper driver selected. Choose "+SqliteDriver+", "+
+			MysqlDriver+" or "+PostgresDriver+"!")
 		exitProgram(printN)
 	}
 
@@ -0,0 +1,332 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+// The table which contains a single row with the current schema version.
+const schemaVersionTableName string = "schemaVersion"
+
+// A single change to the database schema. The statements are generated when
+// the migration is about to be ran, so that they can depend on the
+// configured driver and on which tables are present.
+type migration struct {
+	version     int
+	description string
+	stmts       func(cfg *Config, db *sql.DB, ctx context.Context) []string
+}
+
+// All migrations in the order they need to be ran. The version of every
+// migration must be one bigger than the previous one. New migrations are only
+// appended, never change or remove an old one!
+//
+// Keep in mind, the Init*Table() functions should always create the tables
+// using the newest schema, since a new database is set to the newest version
+// without running any migrations.
+func schemaMigrations() []migration {
+	return []migration{
+		{
+			version:     1,
+			description: "baseline schema, before versioning was added",
+			stmts: func(cfg *Config, db *sql.DB, ctx context.Context) []string {
+				return nil
+			},
+		},
+		{
+			version: 2,
+			description: "add an automatically generated ID for every log, " +
+				"instead of using the start time",
+			stmts: func(cfg *Config, db *sql.DB, ctx context.Context) []string {
+				logCols := []string{LogStartTimeCol, "username", LogEndTimeCol,
+					LogDrugNameCol, LogDoseCol, LogDoseUnitsCol, LogDrugRouteCol,
+					LogCostCol, LogCostCurrencyCol}
+				stmts := cfg.rebuildTableStmts(db, ctx, loggingTableName,
+					cfg.logsTableStmt, logCols, logCols, LogStartTimeCol+", username")
+
+				// The remembered dosing used the start time as the ID.
+				if len(stmts) != 0 && cfg.CheckTables(db, ctx, userSetTableName) {
+					stmts = append(stmts, "update "+userSetTableName+" set "+rememberIDTableName+
+						" = coalesce((select "+LogIDCol+" from "+loggingTableName+
+						" where "+loggingTableName+"."+LogStartTimeCol+" = "+
+						userSetTableName+"."+rememberIDTableName+
+						" and "+loggingTableName+".username = "+userSetTableName+".username), 0)")
+				}
+
+				return stmts
+			},
+		},
+	}
+}
+
+// LatestSchemaVersion returns the schema version the database will be at,
+// after all migrations have been ran.
+func LatestSchemaVersion() int {
+	allMigr := schemaMigrations()
+	return allMigr[len(allMigr)-1].version
+}
+
+// Returns the statements to add a new column to an existing table.
+// If the table doesn't exist, nothing is returned, since it will be created
+// using the newest schema by the Init*Table() functions.
+//
+// table - the name of the table to add the column to
+//
+// colDef - the name of the column and it's definition, for example:
+// "weight real default 0 not null"
+func (cfg *Config) addColumnStmts(db *sql.DB, ctx context.Context,
+	table string, colDef string) []string {
+	if !cfg.CheckTables(db, ctx, table) {
+		return nil
+	}
+
+	return []string{"alter table " + table + " add column " + colDef}
+}
+
+// Returns the statements to rebuild a table using a new schema, while
+// keeping all data. This is needed when changing a column or the primary key,
+// since sqlite doesn't support doing it using "alter table".
+// If the table doesn't exist, nothing is returned.
+//
+// table - the name of the table to rebuild
+//
+// createStmt - returns the "create table" statement for the new schema,
+// using the given name for the table
+//
+// newCols - the columns in the new table to copy the data to
+//
+// oldCols - the columns or expressions from the old table used to fill
+// newCols, must be in the same order
+//
+// orderBy - if not empty, the order in which the rows are copied, needed
+// when the new table has an automatically incremented ID
+func (cfg *Config) rebuildTableStmts(db *sql.DB, ctx context.Context,
+	table string, createStmt func(name string) string,
+	newCols []string, oldCols []string, orderBy string) []string {
+	if !cfg.CheckTables(db, ctx, table) {
+		return nil
+	}
+
+	if orderBy != "" {
+		orderBy = " order by " + orderBy
+	}
+
+	tmpTable := table + "_migrate"
+	return []string{
+		createStmt(tmpTable),
+		"insert into " + tmpTable + " (" + strings.Join(newCols, ", ") + ") " +
+			"select " + strings.Join(oldCols, ", ") + " from " + table + orderBy,
+		"drop table " + table,
+		"alter table " + tmpTable + " rename to " + table,
+	}
+}
+
+// Returns the names of all tables which could be created by this module,
+// without the version table itself.
+func (cfg *Config) allTableNames() []string {
+	return []string{
+		loggingTableName,
+		userSetTableName,
+		cfg.UseSource,
+		altNamesSubsTableName,
+		altNamesRouteTableName,
+		altNamesUnitsTableName,
+		altNamesConvUnitsTableName,
+		crossToleranceTableName,
+		interactionsTableName,
+		logHistoryTableName,
+		auditTableName,
+		userPrefsTableName,
+		dosingPresetsTableName,
+	}
+}
+
+// GetSchemaVersion returns the current schema version of the database.
+// If there is no version stored, but any of the tables of this module exist,
+// the database was created before versioning was added and 1 is returned.
+// If there are no tables at all, the database is new and 0 is returned.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+func (cfg *Config) GetSchemaVersion(db *sql.DB, ctx context.Context) (error, int) {
+	const printN string = "GetSchemaVersion()"
+
+	if !cfg.CheckTables(db, ctx, schemaVersionTableName) {
+		for _, table := range cfg.allTableNames() {
+			if cfg.CheckTables(db, ctx, table) {
+				return nil, 1
+			}
+		}
+		return nil, 0
+	}
+
+	var version int
+	row := db.QueryRowContext(ctx, "select version from "+schemaVersionTableName)
+	err := row.Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 1
+	} else if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), 0
+	}
+
+	return nil, version
+}
+
+// Set the version stored in the database within the given transaction.
+func setSchemaVersion(tx *sql.Tx, version int) error {
+	const printN string = "setSchemaVersion()"
+
+	_, err := tx.Exec("delete from " + schemaVersionTableName)
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("insert into "+schemaVersionTableName+" (version) values(?)", version)
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MigrateDB brings the schema of all tables to the newest version, without
+// losing any data. It's called by InitAllDBTables(), so there's usually no
+// need to call it manually. Every migration is ran in it's own transaction,
+// if one fails, all migrations before it are kept and the rest aren't ran.
+//
+// Keep in mind, MySQL commits automatically after "create table",
+// "alter table" and etc., so for it, a failed migration could be only
+// partially applied.
+//
+// A new database (with no tables) is set to the newest version directly,
+// since the tables are created using the newest schema.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// dryRun - if true, only print the SQL statements of all migrations which
+// would be ran, without changing anything
+func (cfg *Config) MigrateDB(db *sql.DB, ctx context.Context, dryRun bool) error {
+	const printN string = "MigrateDB()"
+
+	allMigr := schemaMigrations()
+	for i := 0; i < len(allMigr); i++ {
+		if allMigr[i].version != i+1 {
+			return fmt.Errorf("%s%w: %d", sprintName(printN), MigrationOrderError, allMigr[i].version)
+		}
+	}
+
+	err, currVersion := cfg.GetSchemaVersion(db, ctx)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	latest := LatestSchemaVersion()
+	if currVersion > latest {
+		return fmt.Errorf("%s%w: database: %d ; newest known: %d", sprintName(printN),
+			SchemaTooNewError, currVersion, latest)
+	}
+
+	if dryRun {
+		if currVersion == latest {
+			printName(printN, "Dry run: schema is at the newest version:", latest)
+		} else if currVersion == 0 {
+			printName(printN, "Dry run: new database, it will be set to version:", latest)
+		}
+	}
+
+	if !dryRun && !cfg.CheckTables(db, ctx, schemaVersionTableName) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
+		}
+
+		_, err = tx.Exec("create table " + schemaVersionTableName + " (version bigint not null);")
+		err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+		if err != nil {
+			return err
+		}
+
+		setVersion := currVersion
+		if currVersion == 0 {
+			setVersion = latest
+		}
+
+		err = setSchemaVersion(tx, setVersion)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err)
+		}
+
+		err = tx.Commit()
+		err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+		if err != nil {
+			return err
+		}
+
+		printNameVerbose(cfg.VerbosePrinting, printN, "Created: '"+schemaVersionTableName+
+			"' table in database ; version:", setVersion)
+	}
+
+	if currVersion == 0 {
+		return nil
+	}
+
+	for _, migr := range allMigr {
+		if migr.version <= currVersion {
+			continue
+		}
+
+		stmts := migr.stmts(cfg, db, ctx)
+
+		if dryRun {
+			printNameF(printN, "Dry run: migration: %d ; %s\n", migr.version, migr.description)
+			for _, stmt := range stmts {
+				printName(printN, stmt)
+			}
+			continue
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
+		}
+
+		for _, stmt := range stmts {
+			_, err = tx.Exec(stmt)
+			err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+			if err != nil {
+				return fmt.Errorf("%s%d: %w", sprintName(printN, "Migration: "), migr.version, err)
+			}
+		}
+
+		err = setSchemaVersion(tx, migr.version)
+		if err != nil {
+			return fmt.Errorf("%s%d: %w", sprintName(printN, "Migration: "), migr.version, err)
+		}
+
+		err = tx.Commit()
+		err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+		if err != nil {
+			return fmt.Errorf("%s%d: %w", sprintName(printN, "Migration: "), migr.version, err)
+		}
+
+		printNameF(printN, "Migrated database to version: %d ; %s\n", migr.version, migr.description)
+	}
+
+	return nil
+}
+
+var MigrationOrderError error = errors.New("migrations aren't in order, wrong version")
+var SchemaTooNewError error = errors.New("the database schema is newer than this version supports")
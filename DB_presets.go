@@ -0,0 +1,260 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+const dosingPresetsTableName string = "dosingPresets"
+
+const ActionAddDosingPreset string = "adding dosing preset completed"
+const ActionRemoveDosingPreset string = "removing dosing preset completed"
+
+// DosingPreset is a named dosing setup of a user, which is used to log
+// only by giving the dose. Unlike RememberDosing(), it doesn't depend on
+// any log. The values are the same as the inputs of AddToDoseTable().
+type DosingPreset struct {
+	Name      string
+	Username  string
+	DrugName  string
+	DrugRoute string
+	DoseUnits string
+	// If not 0, the dose is converted, checkout ConvertUnits()
+	Perc         float32
+	Cost         float32
+	CostCurrency string
+}
+
+type DosingPresetsError struct {
+	Presets  []DosingPreset
+	Username string
+	Err      error
+}
+
+// AddDosingPreset creates a new dosing preset for a user. If the user
+// already has a preset with the same name, PresetExistsError is returned,
+// to change it, remove it first, checkout RemoveDosingPreset().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// errChannel - the gorouting channel which returns the errors
+// (set to nil if function doesn't need to be concurrent)
+//
+// preset - the preset to add, the name, username, drug, route and units
+// must be set
+func (cfg *Config) AddDosingPreset(db *sql.DB, ctx context.Context,
+	errChannel chan<- ErrorInfo, preset DosingPreset) ErrorInfo {
+	const printN string = "AddDosingPreset()"
+
+	tempErrInfo := ErrorInfo{
+		Err:      nil,
+		Username: preset.Username,
+		Action:   ActionAddDosingPreset,
+	}
+
+	preset.Name = strings.TrimSpace(preset.Name)
+	if preset.Name == "" || preset.Username == "" || preset.DrugName == "" ||
+		preset.DrugRoute == "" || preset.DoseUnits == "" {
+		tempErrInfo.Err = fmt.Errorf("%s%w: name: %q ; username: %q ; drug: %q ; route: %q ; units: %q",
+			sprintName(printN), IncompletePresetError, preset.Name, preset.Username,
+			preset.DrugName, preset.DrugRoute, preset.DoseUnits)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	xtrs := []string{xtrastmt("presetName", "and")}
+	ret := checkIfExistsDB(db, ctx,
+		"username", dosingPresetsTableName,
+		cfg.DBDriver, cfg.DBSettings[cfg.DBDriver].Path,
+		xtrs, preset.Username, preset.Name)
+	if ret {
+		tempErrInfo.Err = fmt.Errorf("%s%w: %q", sprintName(printN), PresetExistsError, preset.Name)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%s: %w", sprintName(printN), "db.BeginTx()", err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	_, err = tx.Exec("insert into "+dosingPresetsTableName+
+		" (username, presetName, drugName, drugRoute, doseUnits, perc, cost, costCurrency) "+
+		"values(?, ?, ?, ?, ?, ?, ?, ?)", preset.Username, preset.Name, preset.DrugName,
+		preset.DrugRoute, preset.DoseUnits, preset.Perc, preset.Cost, preset.CostCurrency)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Exec(): ") {
+		return tempErrInfo
+	}
+
+	err = cfg.addAuditEntry(ctx, tx, ActionAddDosingPreset, preset.Username, nil, nil, preset)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
+	err = tx.Commit()
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
+		return tempErrInfo
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Added preset:", preset.Name,
+		"; for user:", preset.Username)
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+// GetDosingPresets returns the dosing presets of a user, sorted by name.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// presetsErrChan - the goroutine channel which returns the presets
+// and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to get the presets
+//
+// name - if not empty, only the preset with this name is returned,
+// if it doesn't exist NoPresetError is returned
+func (cfg *Config) GetDosingPresets(db *sql.DB, ctx context.Context,
+	presetsErrChan chan<- DosingPresetsError, username string, name string) DosingPresetsError {
+	const printN string = "GetDosingPresets()"
+
+	tempPresetsErr := DosingPresetsError{
+		Presets:  nil,
+		Username: username,
+		Err:      nil,
+	}
+
+	query := "select presetName, username, drugName, drugRoute, doseUnits, perc, cost, costCurrency " +
+		"from " + dosingPresetsTableName + " where username = ?"
+	args := []any{username}
+	if name != "" {
+		query += " and presetName = ?"
+		args = append(args, name)
+	}
+	query += " order by presetName"
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		tempPresetsErr.Err = fmt.Errorf("%s%w", sprintName(printN, "db.QueryContext(): "), err)
+		if presetsErrChan != nil {
+			presetsErrChan <- tempPresetsErr
+		}
+		return tempPresetsErr
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tempPreset DosingPreset
+		err = rows.Scan(&tempPreset.Name, &tempPreset.Username, &tempPreset.DrugName,
+			&tempPreset.DrugRoute, &tempPreset.DoseUnits, &tempPreset.Perc,
+			&tempPreset.Cost, &tempPreset.CostCurrency)
+		if err != nil {
+			tempPresetsErr.Err = fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err)
+			if presetsErrChan != nil {
+				presetsErrChan <- tempPresetsErr
+			}
+			return tempPresetsErr
+		}
+		tempPresetsErr.Presets = append(tempPresetsErr.Presets, tempPreset)
+	}
+
+	if name != "" && len(tempPresetsErr.Presets) == 0 {
+		tempPresetsErr.Err = fmt.Errorf("%s%w: %q", sprintName(printN), NoPresetError, name)
+	}
+
+	if presetsErrChan != nil {
+		presetsErrChan <- tempPresetsErr
+	}
+	return tempPresetsErr
+}
+
+// RemoveDosingPreset removes a dosing preset of a user, if it doesn't exist
+// NoPresetError is returned. The logs added using the preset aren't touched.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// errChannel - the gorouting channel which returns the errors
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to remove the preset
+//
+// name - the name of the preset
+func (cfg *Config) RemoveDosingPreset(db *sql.DB, ctx context.Context,
+	errChannel chan<- ErrorInfo, username string, name string) ErrorInfo {
+	const printN string = "RemoveDosingPreset()"
+
+	tempErrInfo := ErrorInfo{
+		Err:      nil,
+		Username: username,
+		Action:   ActionRemoveDosingPreset,
+	}
+
+	gotPresetsErr := cfg.GetDosingPresets(db, ctx, nil, username, name)
+	if gotPresetsErr.Err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), gotPresetsErr.Err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%s: %w", sprintName(printN), "db.BeginTx()", err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	_, err = tx.Exec("delete from "+dosingPresetsTableName+
+		" where username = ? and presetName = ?", username, name)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Exec(): ") {
+		return tempErrInfo
+	}
+
+	err = cfg.addAuditEntry(ctx, tx, ActionRemoveDosingPreset, username, nil,
+		gotPresetsErr.Presets[0], nil)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
+	err = tx.Commit()
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
+		return tempErrInfo
+	}
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+var PresetExistsError error = errors.New("a dosing preset with this name already exists")
+var NoPresetError error = errors.New("no dosing preset with this name")
+var IncompletePresetError error = errors.New("the dosing preset needs a name, drug, route and units")
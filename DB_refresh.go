@@ -0,0 +1,283 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+const ActionRefreshInfo string = "refreshing info completed"
+const ActionRefreshStaleInfo string = "refreshing stale info completed"
+
+// StaleInfo contains a substance from the info table, which was fetched
+// longer ago than allowed by MaxInfoAge in the settings file.
+type StaleInfo struct {
+	DrugName string
+	// The oldest time of fetch from all routes of the substance.
+	TimeOfFetch int64
+}
+
+type StaleInfoError struct {
+	StaleInfo []StaleInfo
+	Username  string
+	Err       error
+}
+
+// GetMaxInfoAge returns the parsed MaxInfoAge from the Config struct.
+// If it's empty or set to "none", 0 is returned, meaning that information
+// in the info table never gets old.
+func (cfg *Config) GetMaxInfoAge() (error, time.Duration) {
+	const printN string = "GetMaxInfoAge()"
+
+	if cfg.MaxInfoAge == "" || cfg.MaxInfoAge == "none" {
+		return nil, 0
+	}
+
+	maxAge, err := time.ParseDuration(cfg.MaxInfoAge)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), 0
+	}
+
+	if maxAge < 0 {
+		return fmt.Errorf("%s%w: %q", sprintName(printN), InvalidMaxInfoAgeError, cfg.MaxInfoAge), 0
+	}
+
+	return nil, maxAge
+}
+
+// GetStaleInfo returns all substances from the currently configured info
+// table, which have at least one route older than MaxInfoAge.
+// If MaxInfoAge is disabled, an empty slice is returned.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// staleErrChan - the goroutine channel used to return the stale substances
+// and the error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user requesting the stale substances
+func (cfg *Config) GetStaleInfo(db *sql.DB, ctx context.Context,
+	staleErrChan chan<- StaleInfoError, username string) StaleInfoError {
+	const printN string = "GetStaleInfo()"
+
+	tempStaleErr := StaleInfoError{
+		StaleInfo: nil,
+		Username:  username,
+		Err:       nil,
+	}
+
+	err, maxAge := cfg.GetMaxInfoAge()
+	if err != nil {
+		tempStaleErr.Err = fmt.Errorf("%s%w", sprintName(printN), err)
+		if staleErrChan != nil {
+			staleErrChan <- tempStaleErr
+		}
+		return tempStaleErr
+	}
+
+	if maxAge == 0 {
+		printNameVerbose(cfg.VerbosePrinting, printN, "MaxInfoAge is disabled, nothing is stale.")
+		if staleErrChan != nil {
+			staleErrChan <- tempStaleErr
+		}
+		return tempStaleErr
+	}
+
+	olderThan := time.Now().Add(-maxAge).Unix()
+
+	rows, err := db.QueryContext(ctx, "select drugName, min(timeOfFetch) from "+cfg.UseSource+
+		" group by drugName having min(timeOfFetch) < ? order by drugName", olderThan)
+	if err != nil {
+		tempStaleErr.Err = fmt.Errorf("%s%w", sprintName(printN, "db.QueryContext(): "), err)
+		if staleErrChan != nil {
+			staleErrChan <- tempStaleErr
+		}
+		return tempStaleErr
+	}
+	defer rows.Close()
+
+	var staleInfo []StaleInfo
+	for rows.Next() {
+		tempStale := StaleInfo{}
+		err = rows.Scan(&tempStale.DrugName, &tempStale.TimeOfFetch)
+		if err != nil {
+			tempStaleErr.Err = fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err)
+			if staleErrChan != nil {
+				staleErrChan <- tempStaleErr
+			}
+			return tempStaleErr
+		}
+		staleInfo = append(staleInfo, tempStale)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		tempStaleErr.Err = fmt.Errorf("%s%w", sprintName(printN, "rows.Err(): "), err)
+		if staleErrChan != nil {
+			staleErrChan <- tempStaleErr
+		}
+		return tempStaleErr
+	}
+
+	tempStaleErr.StaleInfo = staleInfo
+	if staleErrChan != nil {
+		staleErrChan <- tempStaleErr
+	}
+	return tempStaleErr
+}
+
+// PrintStaleInfo prints the substances returned by GetStaleInfo().
+//
+// staleInfo - the slice returned by GetStaleInfo()
+//
+// prefix - if true, add the module name at the start of every line
+func (cfg *Config) PrintStaleInfo(staleInfo []StaleInfo, prefix bool) {
+	var printN string
+	if prefix == true {
+		printN = "PrintStaleInfo()"
+	} else {
+		printN = ""
+	}
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		printName(printN, err)
+		return
+	}
+
+	if len(staleInfo) == 0 {
+		printName(printN, "No stale substances in info table:", cfg.UseSource)
+		return
+	}
+
+	for _, elem := range staleInfo {
+		fetched := time.Unix(elem.TimeOfFetch, 0).In(location)
+		printNameF(printN, "Substance: %q ; Fetched: %q (%s ago)\n",
+			elem.DrugName, fetched.String(),
+			time.Since(fetched).Round(time.Minute).String())
+	}
+}
+
+// RefreshInfo fetches the information about a substance again from the given
+// source and replaces all of its rows in the info table in one transaction,
+// the same way as UpdateFromSource(). The old rows are only changed after
+// the fetch succeeds, so if the source can't be reached, the old information
+// stays and can still be used. Like UpdateFromSource(), AutoFetch doesn't
+// need to be enabled, since the refresh is requested explicitly.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// errChannel - the gorouting channel which returns the errors
+// (set to nil if function doesn't need to be concurrent)
+//
+// drugname - the substance to refresh
+//
+// username - the user requesting the refresh
+//
+// src - the source to fetch the information from, best done using
+// InitSource(), which picks the source configured with UseSource
+func (cfg *Config) RefreshInfo(db *sql.DB, ctx context.Context,
+	errChannel chan<- ErrorInfo, drugname string, username string,
+	src Source) ErrorInfo {
+	const printN string = "RefreshInfo()"
+
+	tempErrInfo := ErrorInfo{
+		Err:      nil,
+		Action:   ActionRefreshInfo,
+		Username: username,
+	}
+
+	err, infoDiff := cfg.updateFromSource(db, ctx, drugname, username, src, ActionRefreshInfo)
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Refreshed:", len(infoDiff), "routes for:", drugname)
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+// RefreshStaleInfo calls RefreshInfo() for every substance returned by
+// GetStaleInfo(). A failed refresh doesn't stop the rest, all errors are
+// joined and returned at the end.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// errChannel - the gorouting channel which returns the errors
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user requesting the refresh
+//
+// src - the source to fetch the information from, best done using
+// InitSource(), which picks the source configured with UseSource
+func (cfg *Config) RefreshStaleInfo(db *sql.DB, ctx context.Context,
+	errChannel chan<- ErrorInfo, username string, src Source) ErrorInfo {
+	const printN string = "RefreshStaleInfo()"
+
+	tempErrInfo := ErrorInfo{
+		Err:      nil,
+		Action:   ActionRefreshStaleInfo,
+		Username: username,
+	}
+
+	gotStale := cfg.GetStaleInfo(db, ctx, nil, username)
+	if gotStale.Err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), gotStale.Err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	if len(gotStale.StaleInfo) == 0 {
+		printName(printN, "No stale substances to refresh in info table:", cfg.UseSource)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	var errs []error
+	refreshed := 0
+	for _, elem := range gotStale.StaleInfo {
+		gotErrInfo := cfg.RefreshInfo(db, ctx, nil, elem.DrugName, username, src)
+		if gotErrInfo.Err != nil {
+			errs = append(errs, gotErrInfo.Err)
+			continue
+		}
+		refreshed++
+	}
+
+	printName(printN, "Refreshed:", refreshed, "out of:", len(gotStale.StaleInfo), "stale substances")
+
+	if len(errs) != 0 {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), errors.Join(errs...))
+	}
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+var InvalidMaxInfoAgeError error = errors.New("MaxInfoAge can't be negative")
@@ -17,7 +17,9 @@ import (
 // CleanDB deletes all tables in the database.
 // Make sure you don't have any other tables related to other projects in
 // the database! It's a good idea to create different databases for
-// every project.
+// every project. The audit log is deleted as well, so nothing is left
+// to record the removal in, checkout GetAuditLog(). To keep the audit log,
+// use CleanInfoTable(), CleanNamesTables() and RemoveLogs() instead.
 //
 // db - open database connection
 //
@@ -76,11 +78,14 @@ func (cfg *Config) CleanDB(db *sql.DB, ctx context.Context) error {
 // is set to "psychonautwiki" it will delete the table with the same name as
 // the source, containing all data like dosages and timings. All user dosages
 // aren't touched since they're not apart of the drug general information.
+// All removed information is recorded in the audit log.
 //
 // db - open database connection
 //
 // ctx - context to be passed to sql queries
-func (cfg *Config) CleanInfoTable(db *sql.DB, ctx context.Context) error {
+//
+// username - the user requesting the removal
+func (cfg *Config) CleanInfoTable(db *sql.DB, ctx context.Context, username string) error {
 	const printN string = "CleanInfoTable()"
 
 	tx, err := db.BeginTx(ctx, nil)
@@ -88,6 +93,20 @@ func (cfg *Config) CleanInfoTable(db *sql.DB, ctx context.Context) error {
 		return fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
 	}
 
+	err, oldInfo := cfg.allDrugInfoTx(ctx, tx)
+	err = handleErrRollbackSeq(err, tx, printN, "")
+	if err != nil {
+		return err
+	}
+
+	// MySQL commits automatically when dropping a table, so the entry is
+	// added before it.
+	err = cfg.addAuditEntry(ctx, tx, ActionCleanInfoTable, username, nil, oldInfo, nil)
+	err = handleErrRollbackSeq(err, tx, printN, "")
+	if err != nil {
+		return err
+	}
+
 	_, err = tx.Exec("drop table " + cfg.UseSource)
 	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
 	if err != nil {
@@ -110,6 +129,7 @@ func (cfg *Config) CleanInfoTable(db *sql.DB, ctx context.Context) error {
 // Main names are global, they apply to all sources. Currently configured ones
 // are source specific and are chosen based on the currently used source.
 // This means, that any old names generated for another source aren't removed.
+// The cross-tolerance groups are removed together with the main names.
 //
 // db - open database connection
 //
@@ -121,10 +141,11 @@ func (cfg *Config) CleanNamesTables(db *sql.DB, ctx context.Context, replaceOnly
 	const printN string = "CleanNamesTables()"
 
 	tableSuffix := "_" + cfg.UseSource
-	tableNames := [8]string{altNamesSubsTableName,
+	tableNames := [9]string{altNamesSubsTableName,
 		altNamesRouteTableName,
 		altNamesUnitsTableName,
 		altNamesConvUnitsTableName,
+		crossToleranceTableName,
 		altNamesSubsTableName + tableSuffix,
 		altNamesRouteTableName + tableSuffix,
 		altNamesUnitsTableName + tableSuffix,
@@ -137,7 +158,7 @@ func (cfg *Config) CleanNamesTables(db *sql.DB, ctx context.Context, replaceOnly
 
 	startCount := 0
 	if replaceOnly == true {
-		startCount = 4
+		startCount = 5
 	}
 	printNameNoNewline(printN, "Removing tables: ")
 	for i := startCount; i < len(tableNames); i++ {
@@ -163,7 +184,8 @@ func (cfg *Config) CleanNamesTables(db *sql.DB, ctx context.Context, replaceOnly
 	return nil
 }
 
-// RemoveLogs removes logs from the dose log table.
+// RemoveLogs removes logs from the dose log table. The removed logs are kept
+// in the history, so that they can be restored, checkout UndoLogChanges().
 //
 // db - open database connection
 //
@@ -181,7 +203,7 @@ func (cfg *Config) CleanNamesTables(db *sql.DB, ctx context.Context, replaceOnly
 // values to low values, this should remove the newest logs first,
 // false is the opposite direction
 //
-// remID - if not 0, remove a specific log using it's start timestamp (ID)
+// remID - if not 0, remove a specific log using it's ID, checkout UserLog.ID
 //
 // search - remove logs only matching this string
 func (cfg *Config) RemoveLogs(db *sql.DB, ctx context.Context,
@@ -196,7 +218,7 @@ func (cfg *Config) RemoveLogs(db *sql.DB, ctx context.Context,
 		Action:   ActionRemoveLogs,
 	}
 
-	stmtStr := "delete from " + loggingTableName + " where username = ?"
+	whereStr := "username = ?"
 	if (amount != 0 && remID == 0) || (search != "none" && search != "") {
 		if search != "none" && search != "" {
 			amount = 0
@@ -212,25 +234,17 @@ func (cfg *Config) RemoveLogs(db *sql.DB, ctx context.Context,
 			return tempErrInfo
 		}
 
-		var gotTimeOfDose []int64
-		var tempTimes int64
-
+		concatIDs := ""
 		for i := 0; i < len(gotLogs.UserLogs); i++ {
-			tempTimes = gotLogs.UserLogs[i].StartTime
-			gotTimeOfDose = append(gotTimeOfDose, tempTimes)
-		}
-
-		concatTimes := ""
-		for i := 0; i < len(gotTimeOfDose); i++ {
-			concatTimes = concatTimes + strconv.FormatInt(gotTimeOfDose[i], 10) + ","
+			concatIDs = concatIDs + strconv.FormatInt(gotLogs.UserLogs[i].ID, 10) + ","
 		}
-		concatTimes = strings.TrimSuffix(concatTimes, ",")
+		concatIDs = strings.TrimSuffix(concatIDs, ",")
 
-		stmtStr = "delete from " + loggingTableName + " where timeOfDoseStart in (" + concatTimes + ") AND username = ?"
+		whereStr = LogIDCol + " in (" + concatIDs + ") AND username = ?"
 	} else if remID != 0 && (search == "none" || search == "") {
 		xtrs := [1]string{xtrastmt("username", "and")}
 		ret := checkIfExistsDB(db, ctx,
-			"timeOfDoseStart", loggingTableName,
+			LogIDCol, loggingTableName,
 			cfg.DBDriver, cfg.DBSettings[cfg.DBDriver].Path,
 			xtrs[:], remID, username)
 		if !ret {
@@ -241,7 +255,13 @@ func (cfg *Config) RemoveLogs(db *sql.DB, ctx context.Context,
 			return tempErrInfo
 		}
 
-		stmtStr = "delete from " + loggingTableName + " where timeOfDoseStart = ? AND username = ?"
+		whereStr = LogIDCol + " = ? AND username = ?"
+	}
+	stmtStr := "delete from " + loggingTableName + " where " + whereStr
+
+	args := []any{username}
+	if remID != 0 {
+		args = []any{remID, username}
 	}
 
 	tx, err := db.BeginTx(ctx, nil)
@@ -253,16 +273,22 @@ func (cfg *Config) RemoveLogs(db *sql.DB, ctx context.Context,
 		return tempErrInfo
 	}
 
+	err, removedLogs := cfg.saveLogHistory(ctx, tx, HistoryRemove, username, whereStr, args...)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
+	err = cfg.addAuditEntry(ctx, tx, ActionRemoveLogs, username, logIDs(removedLogs), removedLogs, nil)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
 	stmt, err := tx.Prepare(stmtStr)
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Prepare(): ") {
 		return tempErrInfo
 	}
 	defer stmt.Close()
-	if remID != 0 {
-		_, err = stmt.Exec(remID, username)
-	} else {
-		_, err = stmt.Exec(username)
-	}
+	_, err = stmt.Exec(args...)
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "stmt.Exec(): ") {
 		return tempErrInfo
 	}
@@ -333,6 +359,11 @@ func (cfg *Config) RemoveSingleDrugInfo(db *sql.DB, ctx context.Context,
 		return tempErrInfo
 	}
 
+	err, oldInfo := cfg.drugInfoTx(ctx, tx, drug)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
 	stmt, err := tx.Prepare("delete from " + cfg.UseSource +
 		" where drugName = ?")
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Prepare(): ") {
@@ -344,6 +375,11 @@ func (cfg *Config) RemoveSingleDrugInfo(db *sql.DB, ctx context.Context,
 		return tempErrInfo
 	}
 
+	err = cfg.addAuditEntry(ctx, tx, ActionRemoveSingleDrugInfo, username, nil, oldInfo, nil)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
 	err = tx.Commit()
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
 		return tempErrInfo
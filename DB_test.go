@@ -5,14 +5,24 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/hasura/go-graphql-client"
 )
 
 // Set environment variable GPDNOMARIA to "1" in order to
 // skip running all MariaDB tests.
+//
+// Set environment variable GPDPOSTGRES to "1" in order to
+// run all tests against PostgreSQL as well, using the path from
+// DBSettings.postgres in the settings file.
 
 const test_drug string = "test_drug"
 const test_route string = "test_route"
@@ -20,11 +30,15 @@ const test_units string = "test_units"
 const test_user string = "test_user"
 const test_source string = "test"
 
-func testWithDrivers() [2]string {
-	if os.Getenv("GPDNOMARIA") == "1" {
-		return [2]string{SqliteDriver, ""}
+func testWithDrivers() []string {
+	drivers := []string{SqliteDriver}
+	if os.Getenv("GPDNOMARIA") != "1" {
+		drivers = append(drivers, MysqlDriver)
+	}
+	if os.Getenv("GPDPOSTGRES") == "1" {
+		drivers = append(drivers, PostgresDriver)
 	}
-	return [2]string{SqliteDriver, MysqlDriver}
+	return drivers
 }
 
 func testUsernames(o int) string {
@@ -89,7 +103,7 @@ func initForTests(dbDriver string) (*sql.DB, context.Context, Config) {
 }
 
 func (cfg *Config) cleanAfterTest(db *sql.DB, ctx context.Context) {
-	err := cfg.CleanInfoTable(db, ctx)
+	err := cfg.CleanInfoTable(db, ctx, "")
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -436,3 +450,2496 @@ func TestForcedRollback(t *testing.T) {
 		cfg.cleanAfterTest(db, ctx)
 	}
 }
+
+func TestUpsertInfoTable(t *testing.T) {
+	fmt.Println("\t---Starting TestUpsertInfoTable()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		subs := []DrugInfo{
+			{
+				DrugName:    test_drug,
+				DrugRoute:   test_route,
+				DoseUnits:   test_units,
+				Threshold:   1.5,
+				TotalDurMax: 5,
+			},
+			{
+				DrugName:  test_drug,
+				DrugRoute: test_route + "_new",
+				DoseUnits: test_units,
+			},
+		}
+
+		gotInfoDiffErr := cfg.UpsertInfoTable(db, ctx, nil, subs, test_user)
+		if gotInfoDiffErr.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotInfoDiffErr.Err)
+		}
+		cfg.PrintInfoDiff(gotInfoDiffErr.InfoDiff, true)
+
+		gotDiff := gotInfoDiffErr.InfoDiff
+		if len(gotDiff) != 2 ||
+			gotDiff[0].Status != InfoRouteUpdated || len(gotDiff[0].Fields) != 2 ||
+			gotDiff[1].Status != InfoRouteInserted {
+			t.Log("Wrong diff after first upsert:", gotDiff)
+			t.Fail()
+		}
+
+		gotInfoDiffErr = cfg.UpsertInfoTable(db, ctx, nil, subs, test_user)
+		if gotInfoDiffErr.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotInfoDiffErr.Err)
+		}
+
+		for _, elem := range gotInfoDiffErr.InfoDiff {
+			if elem.Status != InfoRouteUnchanged {
+				t.Log("Route should've been unchanged:", elem)
+				t.Fail()
+			}
+		}
+
+		// A source without a client returns an error instead of a panic.
+		cfg.AutoFetch = false
+		gotInfoDiffErr = cfg.UpdateFromSource(db, ctx, nil, test_drug, test_user,
+			cfg.NewPsychonautwikiSource(graphql.Client{}))
+		if !errors.Is(gotInfoDiffErr.Err, PsychonautwikiNoClientError) {
+			t.Log("Expected an error for a source without a client, got:", gotInfoDiffErr.Err)
+			t.Fail()
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestRewritePlaceholders(t *testing.T) {
+	fmt.Println("\t---Starting TestRewritePlaceholders()")
+	tests := [][2]string{
+		{"select * from userLogs", "select * from userLogs"},
+		{"select * from userLogs where username = ? AND drugName = ?",
+			"select * from userLogs where username = $1 AND drugName = $2"},
+		{"select '?' from \"what?\" where a = ?", "select '?' from \"what?\" where a = $1"},
+	}
+
+	for _, v := range tests {
+		got := rewritePlaceholders(v[0])
+		if got != v[1] {
+			t.Logf("Got: %q ; expected: %q", got, v[1])
+			t.Fail()
+		}
+	}
+}
+
+func TestEncryptDB(t *testing.T) {
+	fmt.Println("\t---Starting TestEncryptDB()")
+	_, _, cfg := initForTests("")
+
+	dbPath := t.TempDir() + "/" + DefaultDBName
+	cfg.DBDriver = SqliteDriver
+	cfg.DBSettings = map[string]DBSettings{
+		SqliteDriver: {
+			Path:       dbPath,
+			Parameters: cfg.DBSettings[SqliteDriver].Parameters,
+			Encrypt:    false,
+		},
+	}
+
+	ctx := context.Background()
+
+	cfg.InitAllDB(ctx)
+	db := cfg.OpenDBConnection(ctx)
+	_, err := db.ExecContext(ctx, "insert into "+loggingTableName+
+		" (timeOfDoseStart, username, drugName, dose, doseUnits, drugRoute) "+
+		"values(1, ?, ?, 1, ?, ?)", test_user, test_drug, test_units, test_route)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cfg.EncryptDB("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), encMagic) {
+		t.Fatal("Database file isn't encrypted after EncryptDB()")
+	}
+
+	err = cfg.RotateDBPassphrase("first", "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbSet := cfg.DBSettings[SqliteDriver]
+	dbSet.Encrypt = true
+	cfg.DBSettings[SqliteDriver] = dbSet
+
+	cfg.SetDBPassphrase("first")
+	wrongDB := sql.OpenDB(cfg.newEncSqliteConnector())
+	err = wrongDB.PingContext(ctx)
+	wrongDB.Close()
+	if !errors.Is(err, WrongPassphraseError) {
+		t.Fatal("Expected WrongPassphraseError, got:", err)
+	}
+
+	cfg.SetDBPassphrase("second")
+	db = cfg.OpenDBConnection(ctx)
+	_, err = db.ExecContext(ctx, "update "+loggingTableName+" set dose = 2")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db = cfg.OpenDBConnection(ctx)
+	defer db.Close()
+	var dose float32
+	err = db.QueryRowContext(ctx, "select dose from "+loggingTableName+
+		" where username = ?", test_user).Scan(&dose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dose != 2 {
+		t.Fatal("Change wasn't saved to the encrypted database, dose:", dose)
+	}
+
+	// The database is locked while it's open.
+	lockFile, err := os.OpenFile(dbPath+encLockSuffix, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, locked := tryLockFile(lockFile)
+	lockFile.Close()
+	if err != nil || locked {
+		t.Fatal("Expected the database to be locked, got:", locked, err)
+	}
+
+	// A change which can't be written to disk is still made and
+	// the error is returned when closing the database.
+	connector := cfg.newEncSqliteConnector()
+	db.Close()
+	failDB := sql.OpenDB(connector)
+	err = failDB.PingContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connector.path = t.TempDir() + "/missing/" + DefaultDBName
+	_, err = failDB.ExecContext(ctx, "update "+loggingTableName+" set dose = 3")
+	if err != nil {
+		t.Fatal("Expected the change to succeed, got:", err)
+	}
+
+	err = failDB.QueryRowContext(ctx, "select dose from "+loggingTableName+
+		" where username = ?", test_user).Scan(&dose)
+	if err != nil || dose != 3 {
+		t.Fatal("Change wasn't kept in memory, dose:", dose, err)
+	}
+
+	err = failDB.Close()
+	if !errors.Is(err, EncDBNotSavedError) {
+		t.Fatal("Expected EncDBNotSavedError, got:", err)
+	}
+}
+
+func TestExportLogs(t *testing.T) {
+	fmt.Println("\t---Starting TestExportLogs()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		temp_doses := genLogDoses()
+		for i := 0; i < 3; i++ {
+			gotErrInfo := cfg.AddToDoseTable(db, ctx, nil, nil, test_user, test_drug,
+				test_route, temp_doses[i], test_units, 0, 0, "", false)
+			if gotErrInfo.Err != nil {
+				cfg.cleanAfterTest(db, ctx)
+				t.Fatal(gotErrInfo.Err)
+			}
+		}
+
+		gotErrInfo := cfg.ChangeUserLog(db, ctx, nil, LogEndTimeCol, 0, test_user,
+			strconv.FormatInt(time.Now().Unix()+60, 10))
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		for _, format := range []string{ExportFormatCSV, ExportFormatJSON, ExportFormatNDJSON} {
+			var buf strings.Builder
+			gotErrInfo = cfg.ExportLogs(db, ctx, nil, &buf, format, test_user, 0, 0, "", "")
+			if gotErrInfo.Err != nil {
+				t.Log(format, gotErrInfo.Err)
+				t.Fail()
+				continue
+			}
+
+			got := buf.String()
+			lines := strings.Count(got, "\n")
+			if format == ExportFormatCSV && lines != 4 ||
+				format == ExportFormatNDJSON && lines != 3 ||
+				format == ExportFormatJSON && strings.Count(got, "\"Duration\"") != 3 {
+				t.Logf("Wrong %s output: %q", format, got)
+				t.Fail()
+			}
+		}
+
+		var buf strings.Builder
+		gotErrInfo = cfg.ExportLogs(db, ctx, nil, &buf, ExportFormatCSV, test_user,
+			time.Now().Unix()+3600, 0, "", "")
+		if !errors.Is(gotErrInfo.Err, NoLogsError) {
+			t.Log("Expected NoLogsError for logs outside of the time range, got:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.ExportLogs(db, ctx, nil, &buf, "xml", test_user, 0, 0, "", "")
+		if !errors.Is(gotErrInfo.Err, ExportFormatError) {
+			t.Log("Expected ExportFormatError, got:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestImportLogs(t *testing.T) {
+	fmt.Println("\t---Starting TestImportLogs()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		start := time.Now().Unix() - 3600
+		localStart := "2021-03-04 22:10"
+		input := "StartTime,Start,End,DrugName,Dose,DoseUnits,DrugRoute\n" +
+			fmt.Sprintf("%d,,,%s,%g,%s,%s\n", start, test_drug, 10.0, test_units, test_route) +
+			fmt.Sprintf("%d,,,%s,%g,%s,%s\n", start, "not_a_drug", 10.0, test_units, test_route) +
+			fmt.Sprintf("%d,,%s,%s,%g,%s,%s\n", start,
+				time.Unix(start-60, 0).Format(time.RFC3339), test_drug, 10.0, test_units, test_route) +
+			fmt.Sprintf("%d,,,%s,%g,%s,%s\n", start+7200, test_drug, 10.0, test_units, test_route) +
+			fmt.Sprintf("%d,,,%s,%g,%s,%s\n", start, test_drug, 10.0, test_units, test_route) +
+			fmt.Sprintf(",%s,,%s,%g,%s,%s\n", localStart, test_drug, 10.0, test_units, test_route)
+
+		err, rows := cfg.ReadImportLogs(strings.NewReader(input), ExportFormatCSV)
+		if err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(err)
+		}
+
+		err, localStartTime := cfg.ParseTimeInput(localStart)
+		if err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(err)
+		}
+
+		gotImportErr := cfg.ImportLogs(db, ctx, nil, rows, test_user, true, false)
+		if gotImportErr.Err != nil || gotImportErr.Valid != 2 ||
+			gotImportErr.Imported != 0 || len(gotImportErr.RowErrors) != 4 {
+			t.Logf("Wrong dry run result: %+v", gotImportErr)
+			t.Fail()
+		} else if !errors.Is(gotImportErr.RowErrors[0].Err, ComboInputError) ||
+			!errors.Is(gotImportErr.RowErrors[1].Err, EndBeforeStartError) ||
+			!errors.Is(gotImportErr.RowErrors[2].Err, StartTimeInFutureError) ||
+			!errors.Is(gotImportErr.RowErrors[3].Err, ImportDuplicateLogError) ||
+			gotImportErr.RowErrors[3].Row != 5 {
+			t.Logf("Wrong row errors: %+v", gotImportErr.RowErrors)
+			t.Fail()
+		}
+
+		gotImportErr = cfg.ImportLogs(db, ctx, nil, rows, test_user, false, true)
+		if !errors.Is(gotImportErr.Err, ImportInvalidRowsError) || gotImportErr.Imported != 0 {
+			t.Logf("Expected ImportInvalidRowsError, got: %+v", gotImportErr)
+			t.Fail()
+		}
+
+		gotImportErr = cfg.ImportLogs(db, ctx, nil, rows, test_user, false, false)
+		if gotImportErr.Err != nil || gotImportErr.Imported != 2 {
+			t.Logf("Wrong import result: %+v", gotImportErr)
+			t.Fail()
+		}
+
+		gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, test_user, false, "", "")
+		if gotLogs.Err != nil {
+			t.Log(gotLogs.Err)
+			t.Fail()
+		} else if len(gotLogs.UserLogs) != 2 || gotLogs.UserLogs[0].StartTime != localStartTime ||
+			gotLogs.UserLogs[1].StartTime != start {
+			t.Logf("Wrong imported logs: %+v", gotLogs.UserLogs)
+			t.Fail()
+		}
+
+		gotImportErr = cfg.ImportLogs(db, ctx, nil, rows, test_user, true, false)
+		if gotImportErr.Err != nil || gotImportErr.Valid != 0 || len(gotImportErr.RowErrors) != 6 ||
+			!errors.Is(gotImportErr.RowErrors[0].Err, ImportDuplicateLogError) ||
+			!errors.Is(gotImportErr.RowErrors[5].Err, ImportDuplicateLogError) {
+			t.Logf("Expected the imported logs to be duplicates, got: %+v", gotImportErr)
+			t.Fail()
+		}
+
+		gotErrInfo := cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestParseTimeInput(t *testing.T) {
+	fmt.Println("\t---Starting TestParseTimeInput()")
+	location := time.UTC
+	now := time.Date(2023, 11, 14, 1, 0, 0, 0, location)
+
+	inputs := map[string]time.Time{
+		"now":                       now,
+		"1700000000":                time.Unix(1700000000, 0),
+		"30m ago":                   now.Add(-30 * time.Minute),
+		"1h30m ago":                 now.Add(-90 * time.Minute),
+		"2d ago":                    now.AddDate(0, 0, -2),
+		"00:30":                     time.Date(2023, 11, 14, 0, 30, 0, 0, location),
+		"21:15":                     time.Date(2023, 11, 13, 21, 15, 0, 0, location),
+		"2023-11-10 12:00":          time.Date(2023, 11, 10, 12, 0, 0, 0, location),
+		"2023-11-10T12:00:00+01:00": time.Date(2023, 11, 10, 11, 0, 0, 0, location),
+	}
+
+	for input, expected := range inputs {
+		err, got := parseTimeInput(input, location, now)
+		if err != nil {
+			t.Log(input, err)
+			t.Fail()
+		} else if got != expected.Unix() {
+			t.Logf("Input: %q ; got: %v ; expected: %v", input, time.Unix(got, 0).UTC(), expected)
+			t.Fail()
+		}
+	}
+
+	for _, input := range []string{"yesterday", "-5m ago", "25:00"} {
+		err, _ := parseTimeInput(input, location, now)
+		if !errors.Is(err, TimeInputError) {
+			t.Logf("Input: %q ; expected TimeInputError, got: %v", input, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestAddToDoseTableAt(t *testing.T) {
+	fmt.Println("\t---Starting TestAddToDoseTableAt()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		start := time.Now().Unix() - 3600
+		end := start + 600
+
+		synct := SyncTimestamps{}
+		errorChannel := make(chan ErrorInfo)
+		go cfg.AddToDoseTable(db, ctx, errorChannel, &synct, test_user, test_drug,
+			test_route, 10, test_units, 0, 0, "", false)
+		gotErrInfo := <-errorChannel
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		go cfg.AddToDoseTableAt(db, ctx, errorChannel, &synct, test_user, test_drug,
+			test_route, 20, test_units, 0, 0, "", start, end, false)
+		gotErrInfo = <-errorChannel
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, test_user, false, "", "")
+		if gotLogs.Err != nil {
+			t.Log(gotLogs.Err)
+			t.Fail()
+		} else if len(gotLogs.UserLogs) != 2 || gotLogs.UserLogs[0].StartTime != start ||
+			gotLogs.UserLogs[0].EndTime != end || gotLogs.UserLogs[0].Dose != 20 {
+			t.Logf("Wrong backdated log: %+v", gotLogs.UserLogs)
+			t.Fail()
+		}
+
+		// The same start time is already used, so both logs are moved.
+		for i := 0; i < 2; i++ {
+			go cfg.AddToDoseTableAt(db, ctx, errorChannel, &synct, test_user, test_drug,
+				test_route, 30, test_units, 0, 0, "", start, end, false)
+		}
+		for i := 0; i < 2; i++ {
+			gotErrInfo = <-errorChannel
+			if gotErrInfo.Err != nil {
+				cfg.cleanAfterTest(db, ctx)
+				t.Fatal(gotErrInfo.Err)
+			}
+		}
+
+		gotLogs = cfg.GetLogs(db, ctx, nil, 0, 0, test_user, false, "", "")
+		if gotLogs.Err != nil {
+			t.Log(gotLogs.Err)
+			t.Fail()
+		} else if len(gotLogs.UserLogs) != 4 {
+			t.Logf("Wrong logs after the same start time: %+v", gotLogs.UserLogs)
+			t.Fail()
+		} else {
+			for i := int64(1); i <= 2; i++ {
+				elem := gotLogs.UserLogs[i]
+				if elem.StartTime != start+i || elem.EndTime != end+i {
+					t.Logf("Expected start: %d ; end: %d ; got: %+v", start+i, end+i, elem)
+					t.Fail()
+				}
+			}
+		}
+
+		if synct.LastUser != test_user || synct.LastTimestamp != start+2 {
+			t.Logf("Wrong last timestamp: %d ; user: %q", synct.LastTimestamp, synct.LastUser)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, test_drug,
+			test_route, 10, test_units, 0, 0, "", time.Now().Unix()+3600, 0, false)
+		if !errors.Is(gotErrInfo.Err, StartTimeInFutureError) {
+			t.Log("Expected StartTimeInFutureError, got:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, test_drug,
+			test_route, 10, test_units, 0, 0, "", start, start-60, false)
+		if !errors.Is(gotErrInfo.Err, EndBeforeStartError) {
+			t.Log("Expected EndBeforeStartError, got:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, test_drug,
+			test_route, 10, test_units, 0, 0, "", 0, time.Now().Unix()-60, false)
+		if !errors.Is(gotErrInfo.Err, EndBeforeStartError) {
+			t.Log("Expected EndBeforeStartError without a start time, got:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestGetActiveTimes(t *testing.T) {
+	fmt.Println("\t---Starting TestGetActiveTimes()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		const timedDrug string = "test_drug_timed"
+		timedInfo := []DrugInfo{{
+			DrugName:      timedDrug,
+			DrugRoute:     test_route,
+			DoseUnits:     test_units,
+			OnsetMin:      10,
+			OnsetMax:      20,
+			OnsetUnits:    "minutes",
+			ComeUpMin:     10,
+			ComeUpMax:     20,
+			ComeUpUnits:   "minutes",
+			PeakMin:       1,
+			PeakMax:       2,
+			PeakUnits:     "hours",
+			OffsetMin:     1,
+			OffsetMax:     2,
+			OffsetUnits:   "hours",
+			TotalDurMin:   3,
+			TotalDurMax:   6,
+			TotalDurUnits: "hours",
+		}}
+		gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, timedInfo, "")
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		curTime := time.Now().Unix()
+		logs := []struct {
+			drug  string
+			start int64
+		}{
+			{timedDrug, curTime - 2*24*60*60},
+			{timedDrug, curTime - 60*60},
+			{test_drug, curTime - 30*60},
+			{timedDrug, curTime - 5*60},
+		}
+		for _, elem := range logs {
+			gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, elem.drug,
+				test_route, 10, test_units, 0, 0, "", elem.start, 0, false)
+			if gotErrInfo.Err != nil {
+				cfg.cleanAfterTest(db, ctx)
+				t.Fatal(gotErrInfo.Err)
+			}
+		}
+
+		gotActiveTimesErr := cfg.GetActiveTimes(db, ctx, nil, test_user)
+		if gotActiveTimesErr.Err != nil {
+			t.Log(gotActiveTimesErr.Err)
+			t.Fail()
+		} else if got := gotActiveTimesErr.TimeTills; len(got) != 2 ||
+			got[0].TimeT.StartDose != curTime-5*60 || got[1].TimeT.StartDose != curTime-60*60 ||
+			got[0].TimeT.Phase != PhaseOnset || got[1].TimeT.Phase != PhasePeak {
+			t.Logf("Wrong active times: %+v", got)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		gotActiveTimesErr = cfg.GetActiveTimes(db, ctx, nil, test_user)
+		if !errors.Is(gotActiveTimesErr.Err, NoLogsError) {
+			t.Log("Expected NoLogsError, got:", gotActiveTimesErr.Err)
+			t.Fail()
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestPhaseTimes(t *testing.T) {
+	fmt.Println("\t---Starting TestPhaseTimes()")
+	info := DrugInfo{
+		OnsetMin:    600,
+		OnsetMax:    1200,
+		ComeUpMin:   600,
+		ComeUpMax:   1200,
+		PeakMin:     3600,
+		PeakMax:     7200,
+		OffsetMin:   3600,
+		OffsetMax:   7200,
+		TotalDurMin: 3 * 3600,
+		TotalDurMax: 6 * 3600,
+	}
+
+	var start int64 = 1000000
+	phaseTimes := calcPhaseTimes(start, info)
+	if len(phaseTimes) != 5 {
+		t.Fatalf("Wrong amount of phases: %+v", phaseTimes)
+	}
+
+	afterEffects := phaseTimes[4]
+	if afterEffects.Phase != PhaseAfterEffects ||
+		afterEffects.StartAvg != start+900+900+5400+5400 ||
+		afterEffects.EndAvg != start+int64(4.5*3600) ||
+		afterEffects.StartMin != start+600+600+3600+3600 ||
+		afterEffects.EndMax != start+6*3600 {
+		t.Logf("Wrong after-effects: %+v", afterEffects)
+		t.Fail()
+	}
+
+	phases := map[int64]Phase{
+		start - 1:           PhaseNotStarted,
+		start:               PhaseOnset,
+		start + 900:         PhaseComeup,
+		start + 1800:        PhasePeak,
+		start + 1800 + 5400: PhaseOffset,
+		start + 4*3600:      PhaseAfterEffects,
+		start + 5*3600:      PhaseFinished,
+	}
+	for curTime, expected := range phases {
+		got := currentPhase(start, phaseTimes, curTime)
+		if got != expected {
+			t.Logf("Time: %d ; got: %s ; expected: %s", curTime-start, got, expected)
+			t.Fail()
+		}
+	}
+}
+
+func TestClassifyDose(t *testing.T) {
+	fmt.Println("\t---Starting TestClassifyDose()")
+	info := DrugInfo{
+		Threshold:     10,
+		LowDoseMin:    20,
+		LowDoseMax:    50,
+		MediumDoseMin: 50,
+		MediumDoseMax: 100,
+		HighDoseMin:   100,
+		HighDoseMax:   200,
+	}
+
+	doses := map[float32]DoseClass{
+		5:   DoseClassBelowThreshold,
+		10:  DoseClassLight,
+		30:  DoseClassLight,
+		50:  DoseClassCommon,
+		150: DoseClassStrong,
+		200: DoseClassStrong,
+		201: DoseClassHeavy,
+	}
+	for dose, expected := range doses {
+		got := ClassifyDose(info, dose)
+		if got != expected {
+			t.Logf("Dose: %g ; got: %s ; expected: %s", dose, got, expected)
+			t.Fail()
+		}
+	}
+
+	info.Threshold = 0
+	if got := ClassifyDose(info, 15); got != DoseClassBelowThreshold {
+		t.Log("Expected LowDoseMin to be used without a threshold, got:", got)
+		t.Fail()
+	}
+
+	if got := ClassifyDose(DrugInfo{}, 15); got != DoseClassUnknown {
+		t.Log("Expected unknown class without ranges, got:", got)
+		t.Fail()
+	}
+
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		const rangesDrug string = "test_drug_ranges"
+		rangesInfo := info
+		rangesInfo.DrugName = rangesDrug
+		rangesInfo.DrugRoute = test_route
+		rangesInfo.DoseUnits = test_units
+		gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, []DrugInfo{rangesInfo}, "")
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		err, class := cfg.GetDoseClass(db, ctx, test_user, rangesDrug, test_route, 300, test_units, 0)
+		if err != nil || class != DoseClassHeavy {
+			t.Log("Expected a heavy dose, got:", class, err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.AddToDoseTable(db, ctx, nil, nil, test_user, rangesDrug,
+			test_route, 300, test_units, 0, 0, "", false)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		} else if len(gotErrInfo.Warnings) != 1 || !errors.Is(gotErrInfo.Warnings[0], HeavyDoseWarning) {
+			t.Log("Expected HeavyDoseWarning, got:", gotErrInfo.Warnings)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.AddToDoseTable(db, ctx, nil, nil, test_user, test_drug,
+			test_route, 300, test_units, 0, 0, "", false)
+		if gotErrInfo.Err != nil || len(gotErrInfo.Warnings) != 0 {
+			t.Log("Expected no warnings without ranges, got:", gotErrInfo.Err, gotErrInfo.Warnings)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestGetDoseSessions(t *testing.T) {
+	fmt.Println("\t---Starting TestGetDoseSessions()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		const sessionDrug string = "test_drug_session"
+		sessionInfo := []DrugInfo{{
+			DrugName:      sessionDrug,
+			DrugRoute:     test_route,
+			DoseUnits:     test_units,
+			Threshold:     10,
+			LowDoseMin:    20,
+			LowDoseMax:    50,
+			MediumDoseMin: 50,
+			MediumDoseMax: 100,
+			HighDoseMin:   100,
+			HighDoseMax:   200,
+			TotalDurMin:   3,
+			TotalDurMax:   6,
+			TotalDurUnits: "hours",
+		}}
+		gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, sessionInfo, "")
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		curTime := time.Now().Unix()
+		for _, start := range []int64{curTime - 3*24*60*60, curTime - 2*60*60, curTime - 60*60} {
+			gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, sessionDrug,
+				test_route, 60, test_units, 0, 0, "", start, 0, false)
+			if gotErrInfo.Err != nil {
+				cfg.cleanAfterTest(db, ctx)
+				t.Fatal(gotErrInfo.Err)
+			}
+		}
+
+		gotSessionsErr := cfg.GetDoseSessions(db, ctx, nil, test_user, false)
+		if gotSessionsErr.Err != nil {
+			t.Log(gotSessionsErr.Err)
+			t.Fail()
+		} else if len(gotSessionsErr.Sessions) != 2 || gotSessionsErr.Sessions[0].Redoses != 0 {
+			t.Logf("Wrong sessions: %+v", gotSessionsErr.Sessions)
+			t.Fail()
+		}
+
+		gotSessionsErr = cfg.GetDoseSessions(db, ctx, nil, test_user, true)
+		if gotSessionsErr.Err != nil {
+			t.Log(gotSessionsErr.Err)
+			t.Fail()
+		} else if got := gotSessionsErr.Sessions; len(got) != 1 || got[0].Redoses != 1 ||
+			got[0].TotalDose != 120 || got[0].Class != DoseClassStrong ||
+			got[0].End != curTime-60*60+6*60*60 {
+			t.Logf("Wrong active session: %+v", got)
+			t.Fail()
+		}
+
+		gotTimeTillErr := cfg.GetTimes(db, ctx, nil, test_user, 0)
+		if gotTimeTillErr.Err != nil {
+			t.Log(gotTimeTillErr.Err)
+			t.Fail()
+		} else if gotTimeTillErr.Session == nil || gotTimeTillErr.Session.Redoses != 1 {
+			t.Logf("Wrong session in GetTimes(): %+v", gotTimeTillErr.Session)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestIntensityCurve(t *testing.T) {
+	fmt.Println("\t---Starting TestIntensityCurve()")
+	info := DrugInfo{
+		DrugName:      "test_drug_curve",
+		DrugRoute:     test_route,
+		DoseUnits:     test_units,
+		MediumDoseMin: 50,
+		MediumDoseMax: 150,
+		OnsetMin:      20,
+		OnsetMax:      40,
+		OnsetUnits:    "minutes",
+		ComeUpMin:     20,
+		ComeUpMax:     40,
+		ComeUpUnits:   "minutes",
+		TotalDurMin:   8,
+		TotalDurMax:   12,
+		TotalDurUnits: "hours",
+	}
+
+	secInfo := info
+	secInfo.OnsetMin, secInfo.OnsetMax = 20*60, 40*60
+	secInfo.ComeUpMin, secInfo.ComeUpMax = 20*60, 40*60
+	secInfo.TotalDurMin, secInfo.TotalDurMax = 8*3600, 12*3600
+
+	var start int64 = 1000000
+	model := BatemanModel{}
+	bolus := UserLog{DrugName: info.DrugName, StartTime: start, Dose: 100}
+
+	if got := model.Intensity(bolus, secInfo, start+3600); math.Abs(got-1) > 0.001 {
+		t.Log("Expected the peak of a common dose to be 1, got:", got)
+		t.Fail()
+	}
+	if got := model.Intensity(bolus, secInfo, start+10*3600); math.Abs(got-0.05) > 0.001 {
+		t.Log("Expected 0.05 at the end of the total duration, got:", got)
+		t.Fail()
+	}
+	if got := model.Intensity(bolus, secInfo, start-60); got != 0 {
+		t.Log("Expected no intensity before the dose, got:", got)
+		t.Fail()
+	}
+
+	infusion := bolus
+	infusion.EndTime = start + 2*3600
+	if model.Intensity(infusion, secInfo, start+3600) >= model.Intensity(bolus, secInfo, start+3600) ||
+		model.Intensity(infusion, secInfo, start+5*3600) <= model.Intensity(bolus, secInfo, start+5*3600) {
+		t.Log("Expected a dose taken over time to be weaker first and stronger later")
+		t.Fail()
+	}
+
+	if len(model.fits) != 1 {
+		t.Log("Expected the curve to be fitted only once, got:", len(model.fits))
+		t.Fail()
+	}
+
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, []DrugInfo{info}, "")
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		curTime := time.Now().Unix()
+		for _, start := range []int64{curTime - 2*24*60*60, curTime - 2*3600, curTime - 3600} {
+			gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, info.DrugName,
+				test_route, 100, test_units, 0, 0, "", start, 0, false)
+			if gotErrInfo.Err != nil {
+				cfg.cleanAfterTest(db, ctx)
+				t.Fatal(gotErrInfo.Err)
+			}
+		}
+
+		gotCurveErr := cfg.GetIntensityCurve(db, ctx, nil, nil, test_user, curTime)
+		if gotCurveErr.Err != nil {
+			t.Log(gotCurveErr.Err)
+			t.Fail()
+		} else {
+			curve := gotCurveErr.Curve
+			expected := model.Intensity(UserLog{StartTime: curTime - 2*3600, Dose: 100}, secInfo, curTime) +
+				model.Intensity(UserLog{StartTime: curTime - 3600, Dose: 100}, secInfo, curTime)
+			samples := curve.Sample(curTime, curTime+3600, 1800, info.DrugName)
+			if len(curve.Logs) != 2 || len(samples) != 3 ||
+				math.Abs(curve.At(curTime)-expected) > 0.0001 || samples[0].Intensity != curve.At(curTime) {
+				t.Logf("Wrong curve: %+v ; samples: %+v", curve.Logs, samples)
+				t.Fail()
+			}
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestEstimateTolerance(t *testing.T) {
+	fmt.Println("\t---Starting TestEstimateTolerance()")
+	decay := ToleranceDecay{HalfDays: 6, FullDays: 14}
+	const day int64 = 24 * 60 * 60
+
+	days := map[float64]float64{
+		-1: 0,
+		0:  1,
+		3:  0.75,
+		6:  0.5,
+		10: 0.25,
+		14: 0,
+		20: 0,
+	}
+	for elem, expected := range days {
+		got := toleranceAfter(decay, elem)
+		if math.Abs(got-expected) > 0.0001 {
+			t.Logf("Days: %g ; got: %g ; expected: %g", elem, got, expected)
+			t.Fail()
+		}
+	}
+
+	var at int64 = 100 * day
+	userLogs := []UserLog{
+		{ID: 1, StartTime: at - 30*day},
+		{ID: 2, StartTime: at - 10*day},
+		{ID: 3, StartTime: at - 4*day, EndTime: at - 3*day},
+		{ID: 4, StartTime: at + day},
+	}
+
+	tol := estimateTolerance(test_drug, decay, userLogs, at)
+	if tol.Percent != 75 || tol.FromLog.ID != 3 || tol.Baseline != at-3*day+14*day {
+		t.Logf("Wrong tolerance: %+v", tol)
+		t.Fail()
+	}
+
+	tol = estimateTolerance(test_drug, decay, userLogs[:1], at)
+	if tol.Percent != 0 || tol.Baseline != 0 {
+		t.Logf("Expected no tolerance, got: %+v", tol)
+		t.Fail()
+	}
+}
+
+func TestCrossTolerance(t *testing.T) {
+	fmt.Println("\t---Starting TestCrossTolerance()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		const crossDrugA string = "test_drug_cross_a"
+		const crossDrugB string = "test_drug_cross_b"
+		crossInfo := []DrugInfo{
+			{DrugName: crossDrugA, DrugRoute: test_route, DoseUnits: test_units},
+			{DrugName: crossDrugB, DrugRoute: test_route, DoseUnits: test_units},
+		}
+		gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, crossInfo, "")
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		_, err := db.ExecContext(ctx, "delete from "+crossToleranceTableName)
+		if err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(err)
+		}
+
+		err = cfg.addCrossToleranceGroups(db, ctx, &CrossToleranceConfig{
+			Group: map[string]CrossToleranceGroup{
+				"test_group": {Substances: []string{crossDrugA, crossDrugB}, WindowDays: 10},
+			},
+		})
+		if err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(err)
+		}
+
+		curTime := time.Now().Unix()
+		gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, crossDrugA,
+			test_route, 1, test_units, 0, 0, "", curTime-4*24*60*60, 0, false)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, crossDrugB,
+			test_route, 1, test_units, 0, 0, "", curTime, 0, false)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		found := false
+		for _, elem := range gotErrInfo.Warnings {
+			if errors.Is(elem, CrossToleranceWarning) {
+				found = true
+			}
+		}
+		if !found {
+			t.Logf("No cross-tolerance warning: %q", gotErrInfo.Warnings)
+			t.Fail()
+		}
+
+		gotCrossErr := cfg.GetCrossTolerance(db, ctx, nil, test_user, crossDrugB, curTime)
+		if gotCrossErr.Err != nil {
+			t.Log(gotCrossErr.Err)
+			t.Fail()
+		} else if got := gotCrossErr.CrossTols; len(got) != 1 || got[0].GroupName != "test group" ||
+			got[0].FromLog.DrugName != crossDrugA || got[0].DaysLeft != 6 {
+			t.Logf("Wrong cross-tolerance: %+v", got)
+			t.Fail()
+		}
+
+		gotCrossErr = cfg.GetCrossTolerance(db, ctx, nil, test_user, crossDrugB, curTime+7*24*60*60)
+		if gotCrossErr.Err != nil || len(gotCrossErr.CrossTols) != 0 {
+			t.Logf("Cross-tolerance after the window: %+v ; %v", gotCrossErr.CrossTols, gotCrossErr.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		_, err = db.ExecContext(ctx, "delete from "+crossToleranceTableName)
+		if err != nil {
+			t.Log(err)
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestInteractions(t *testing.T) {
+	fmt.Println("\t---Starting TestInteractions()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		const interDrugA string = "test_drug_inter_a"
+		const interDrugB string = "test_drug_inter_b"
+		var interInfo []DrugInfo
+		for _, drug := range []string{interDrugA, interDrugB} {
+			interInfo = append(interInfo, DrugInfo{
+				DrugName:      drug,
+				DrugRoute:     test_route,
+				DoseUnits:     test_units,
+				OnsetMin:      10,
+				OnsetMax:      20,
+				OnsetUnits:    "minutes",
+				ComeUpMin:     10,
+				ComeUpMax:     20,
+				ComeUpUnits:   "minutes",
+				PeakMin:       1,
+				PeakMax:       2,
+				PeakUnits:     "hours",
+				OffsetMin:     1,
+				OffsetMax:     2,
+				OffsetUnits:   "hours",
+				TotalDurMin:   3,
+				TotalDurMax:   6,
+				TotalDurUnits: "hours",
+			})
+		}
+		gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, interInfo, "")
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		err := cfg.storeInteractions(db, ctx, test_source, interDrugA, []Interaction{
+			{interDrugA, interDrugB, InteractionCaution, test_source},
+			{interDrugA, interDrugB, InteractionUnsafe, test_source},
+		})
+		if err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(err)
+		}
+
+		err, interaction := cfg.GetInteraction(db, ctx, interDrugB, interDrugA)
+		if err != nil || interaction == nil || interaction.Risk != InteractionUnsafe {
+			t.Logf("Wrong interaction from source: %+v ; %v", interaction, err)
+			t.Fail()
+		}
+
+		err = cfg.storeInteractions(db, ctx, LocalInteractionsOrigin, interDrugB, []Interaction{
+			{interDrugB, interDrugA, InteractionDangerous, LocalInteractionsOrigin},
+		})
+		if err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(err)
+		}
+
+		err, interaction = cfg.GetInteraction(db, ctx, interDrugA, interDrugB)
+		if err != nil || interaction == nil || interaction.Risk != InteractionDangerous ||
+			interaction.Origin != LocalInteractionsOrigin {
+			t.Logf("Wrong interaction from config: %+v ; %v", interaction, err)
+			t.Fail()
+		}
+
+		// The source returns the substance using other case and a similar
+		// substance, fetching twice shouldn't fail because of the key.
+		interSrc := &testInterSource{inter: []Interaction{
+			{strings.ToUpper(interDrugA), interDrugB, InteractionCaution, ""},
+			{interDrugA, strings.ToUpper(interDrugB), InteractionUnsafe, ""},
+			{interDrugA + "_similar", interDrugB, InteractionDangerous, ""},
+		}}
+		for i := 0; i < 2; i++ {
+			cfg.fetchSourceInteractions(db, ctx, interSrc, interDrugA)
+		}
+
+		var storedInter int
+		err = db.QueryRowContext(ctx, "select count(*) from "+interactionsTableName+
+			" where origin = ?", cfg.UseSource).Scan(&storedInter)
+		if err != nil || storedInter != 1 {
+			t.Logf("Wrong stored interactions from source: %d ; %v", storedInter, err)
+			t.Fail()
+		}
+
+		curTime := time.Now().Unix()
+		gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, interDrugA,
+			test_route, 1, test_units, 0, 0, "", curTime-48*60*60, 0, false)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, interDrugA,
+			test_route, 1, test_units, 0, 0, "", curTime-60*60, 0, false)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.AddToDoseTableAt(db, ctx, nil, nil, test_user, interDrugB,
+			test_route, 1, test_units, 0, 0, "", curTime, 0, false)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		found := 0
+		for _, elem := range gotErrInfo.Warnings {
+			if errors.Is(elem, DangerousInteractionWarning) {
+				found++
+			}
+		}
+		if found != 1 {
+			t.Logf("Wrong interaction warnings: %q", gotErrInfo.Warnings)
+			t.Fail()
+		}
+
+		err, recentLogs := cfg.getLogsBetween(db, ctx, test_user, curTime-6*60*60, curTime)
+		if err != nil || len(recentLogs) != 2 {
+			t.Logf("Wrong recent logs: %+v ; %v", recentLogs, err)
+			t.Fail()
+		}
+
+		gotActiveErr := cfg.GetActiveTimes(db, ctx, nil, test_user)
+		if gotActiveErr.Err != nil {
+			t.Log(gotActiveErr.Err)
+			t.Fail()
+		} else if len(gotActiveErr.Warnings) != 1 ||
+			!errors.Is(gotActiveErr.Warnings[0], DangerousInteractionWarning) {
+			t.Logf("Wrong interaction warnings for active logs: %q", gotActiveErr.Warnings)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		for _, origin := range []string{test_source, LocalInteractionsOrigin, cfg.UseSource} {
+			_, err = db.ExecContext(ctx, "delete from "+interactionsTableName+
+				" where origin = ? and (drugA = ? or drugA = ?)", origin, interDrugA, interDrugB)
+			if err != nil {
+				t.Log(err)
+			}
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestUserProfile(t *testing.T) {
+	fmt.Println("\t---Starting TestUserProfile()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		const profileDrug string = "test_drug_profile"
+		profileInfo := []DrugInfo{{
+			DrugName:      profileDrug,
+			DrugRoute:     test_route,
+			DoseUnits:     test_units,
+			Threshold:     10,
+			LowDoseMin:    20,
+			LowDoseMax:    50,
+			MediumDoseMin: 50,
+			MediumDoseMax: 100,
+			HighDoseMin:   100,
+			HighDoseMax:   200,
+		}}
+		gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, profileInfo, "")
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		for _, elem := range [][2]string{{PrefWeight, "-5"}, {PrefAge, "151"}, {PrefSex, "none"}} {
+			gotErrInfo = cfg.SetUserPref(db, ctx, nil, test_user, elem[0], elem[1])
+			if !errors.Is(gotErrInfo.Err, InvalidUserPrefError) {
+				t.Logf("Invalid %s was set: %v", elem[0], gotErrInfo.Err)
+				t.Fail()
+			}
+		}
+
+		settings := [][2]string{
+			{PrefWeight, "140"},
+			{PrefHeight, "180"},
+			{PrefAge, "30"},
+			{PrefSex, "Male"},
+			{PrefScalePerKg, "true"},
+		}
+		for _, elem := range settings {
+			gotErrInfo = cfg.SetUserPref(db, ctx, nil, test_user, elem[0], elem[1])
+			if gotErrInfo.Err != nil {
+				t.Log(gotErrInfo.Err)
+				t.Fail()
+			}
+		}
+
+		gotProfileErr := cfg.GetUserProfile(db, ctx, nil, test_user)
+		if gotProfileErr.Err != nil {
+			t.Log(gotProfileErr.Err)
+			t.Fail()
+		} else if got := *gotProfileErr.Profile; got != (UserProfile{140, 180, 30, SexMale, true}) {
+			t.Logf("Wrong profile: %+v", got)
+			t.Fail()
+		}
+
+		// 60 is common for 70 kg, but light for 140 kg.
+		err, class := cfg.GetDoseClass(db, ctx, test_user, profileDrug, test_route, 60, test_units, 0)
+		if err != nil || class != DoseClassLight {
+			t.Logf("Wrong scaled class: %s ; %v", class, err)
+			t.Fail()
+		}
+
+		err, bac := EstimateBAC(UserProfile{WeightKg: 70, Sex: SexMale}, 14, 0)
+		if err != nil || math.Abs(bac-14/(0.68*70*10)) > 1e-9 {
+			t.Logf("Wrong BAC: %g ; %v", bac, err)
+			t.Fail()
+		}
+
+		err, bac = EstimateBAC(UserProfile{WeightKg: 70, Sex: SexMale}, 14, 10)
+		if err != nil || bac != 0 {
+			t.Logf("BAC should be 0 after elimination: %g ; %v", bac, err)
+			t.Fail()
+		}
+
+		err, _ = EstimateBAC(UserProfile{}, 14, 0)
+		if !errors.Is(err, NoWeightError) {
+			t.Log("No error without weight:", err)
+			t.Fail()
+		}
+
+		for _, elem := range settings {
+			gotErrInfo = cfg.UnsetUserPref(db, ctx, nil, test_user, elem[0])
+			if gotErrInfo.Err != nil {
+				t.Log(gotErrInfo.Err)
+			}
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestBACTimeline(t *testing.T) {
+	fmt.Println("\t---Starting TestBACTimeline()")
+	profile := UserProfile{WeightKg: 70, Sex: SexMale}
+	perGram := 100 / (0.68 * 70 * 1000)
+	const hour int64 = 60 * 60
+
+	var at int64 = 1000 * hour
+	userLogs := []UserLog{
+		{ID: 1, StartTime: at - 20*hour, Dose: 20},
+		{ID: 3, StartTime: at - hour/2, EndTime: at, Dose: 20},
+		{ID: 2, StartTime: at - hour, Dose: 20},
+		{ID: 4, StartTime: at + hour, Dose: 20},
+	}
+
+	timeline := bacTimeline(profile, userLogs, at, []float64{0.05, 0.08}, bacStep)
+	current := 20*perGram*2 - 0.015
+	if math.Abs(timeline.Current-current) > 0.0001 || math.Abs(timeline.Peak-current) > 0.0001 {
+		t.Logf("Wrong concentration: %+v ; expected: %g", timeline, current)
+		t.Fail()
+	}
+
+	if len(timeline.Logs) != 2 || timeline.Logs[0].ID != 2 || timeline.Logs[1].ID != 3 {
+		t.Logf("Wrong logs in episode: %+v", timeline.Logs)
+		t.Fail()
+	}
+
+	withinSteps := func(got int64, expected int64) bool {
+		return got >= expected-2*bacStep && got <= expected+2*bacStep
+	}
+
+	if !withinSteps(timeline.PeakTime, at) ||
+		!withinSteps(timeline.Sober, at+int64(current/0.015*float64(hour))) {
+		t.Logf("Wrong times: %+v", timeline)
+		t.Fail()
+	}
+
+	if len(timeline.Thresholds) != 2 ||
+		!withinSteps(timeline.Thresholds[0].Below, at+int64((current-0.05)/0.015*float64(hour))) ||
+		timeline.Thresholds[1].Below != at {
+		t.Logf("Wrong thresholds: %+v", timeline.Thresholds)
+		t.Fail()
+	}
+
+	timeline = bacTimeline(profile, userLogs[:1], at, nil, bacStep)
+	if timeline.Current != 0 || timeline.Peak != 0 || timeline.Sober != at || timeline.Logs != nil {
+		t.Logf("Expected to be sober, got: %+v", timeline)
+		t.Fail()
+	}
+
+	// An end time far in the future only absorbs a tiny amount for every
+	// step, the timeline must still end soon after at.
+	farLogs := []UserLog{{ID: 5, StartTime: at - hour, EndTime: at + 100000*hour, Dose: 20}}
+	timeline = bacTimeline(profile, farLogs, at, nil, bacStep)
+	if timeline.Sober > at+int64(20*perGram/0.015*float64(hour))+2*bacStep {
+		t.Logf("Timeline didn't stop after all alcohol could be eliminated: %+v", timeline)
+		t.Fail()
+	}
+}
+
+func TestUserPrefs(t *testing.T) {
+	fmt.Println("\t---Starting TestUserPrefs()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		gotErrInfo := cfg.SetUserPref(db, ctx, nil, test_user, "no-such-pref", "1")
+		if !errors.Is(gotErrInfo.Err, UnknownUserPrefError) {
+			t.Log("Unknown preference was set:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.SetUserPref(db, ctx, nil, test_user, PrefTimezone, "Nowhere/Nothing")
+		if !errors.Is(gotErrInfo.Err, InvalidUserPrefError) {
+			t.Log("Invalid timezone was set:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		prefs := [][2]string{
+			{PrefTimezone, "Europe/Paris"},
+			{PrefDefaultCurrency, "EUR"},
+			{PrefWarnBAC, "0"},
+			{PrefWeight, "75"},
+			{PrefDefaultRoute, "Oral"},
+			{PrefDefaultUnits, "mg"},
+		}
+		for _, elem := range prefs {
+			gotErrInfo = cfg.SetUserPref(db, ctx, nil, test_user, elem[0], elem[1])
+			if gotErrInfo.Err != nil {
+				t.Log(gotErrInfo.Err)
+				t.Fail()
+			}
+		}
+
+		gotPrefsErr := cfg.GetUserPref(db, ctx, nil, test_user, PrefWarnBAC)
+		if gotPrefsErr.Err != nil || len(gotPrefsErr.Prefs) != 1 ||
+			gotPrefsErr.Prefs[0] != (UserPref{PrefWarnBAC, "false", PrefTypeBool, false}) {
+			t.Logf("Wrong preference: %+v ; %v", gotPrefsErr.Prefs, gotPrefsErr.Err)
+			t.Fail()
+		}
+
+		gotProfileErr := cfg.GetUserProfile(db, ctx, nil, test_user)
+		if gotProfileErr.Err != nil || gotProfileErr.Profile.WeightKg != 75 {
+			t.Logf("Weight not set in profile: %+v ; %v", gotProfileErr.Profile, gotProfileErr.Err)
+			t.Fail()
+		}
+
+		route, units := cfg.DefaultRouteUnits(db, ctx, test_user, "", test_units)
+		if route != "Oral" || units != test_units {
+			t.Logf("Wrong default route and units: %q ; %q", route, units)
+			t.Fail()
+		}
+
+		err, userCfg := cfg.UserConfig(db, ctx, test_user)
+		if err != nil || userCfg.Timezone != "Europe/Paris" || userCfg.CostCurrency != "EUR" ||
+			cfg.Timezone == userCfg.Timezone {
+			t.Logf("Wrong user config: %q ; %q ; %v", userCfg.Timezone, userCfg.CostCurrency, err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.AddToDoseTable(db, ctx, nil, nil, test_user, test_drug,
+			test_route, 10, test_units, 0, 5, "", false)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotLogs := cfg.GetLogs(db, ctx, nil, 1, 0, test_user, true, "", "")
+		if gotLogs.Err != nil || len(gotLogs.UserLogs) != 1 || gotLogs.UserLogs[0].CostCurrency != "EUR" {
+			t.Logf("Default currency not used: %+v ; %v", gotLogs.UserLogs, gotLogs.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		for _, elem := range prefs {
+			gotErrInfo = cfg.UnsetUserPref(db, ctx, nil, test_user, elem[0])
+			if gotErrInfo.Err != nil {
+				t.Log(gotErrInfo.Err)
+				t.Fail()
+			}
+		}
+
+		gotPrefsErr = cfg.ListUserPrefs(db, ctx, nil, test_user)
+		if gotPrefsErr.Err != nil || len(gotPrefsErr.Prefs) != len(UserPrefKeys()) {
+			t.Logf("Wrong preferences: %+v ; %v", gotPrefsErr.Prefs, gotPrefsErr.Err)
+			t.Fail()
+		}
+		for _, elem := range gotPrefsErr.Prefs {
+			if !elem.IsDefault {
+				t.Logf("Preference wasn't unset: %+v", elem)
+				t.Fail()
+			} else if elem.Key == PrefTimezone && elem.Value != cfg.Timezone {
+				t.Logf("Timezone doesn't fall back to the config: %+v", elem)
+				t.Fail()
+			}
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestDosingPresets(t *testing.T) {
+	fmt.Println("\t---Starting TestDosingPresets()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		presets := []DosingPreset{
+			{Name: "test_preset_b", Username: test_user, DrugName: test_drug,
+				DrugRoute: test_route, DoseUnits: test_units, Perc: 5, Cost: 2, CostCurrency: "EUR"},
+			{Name: "test_preset_a", Username: test_user, DrugName: test_drug,
+				DrugRoute: test_route, DoseUnits: test_units},
+		}
+		for _, elem := range presets {
+			gotErrInfo := cfg.AddDosingPreset(db, ctx, nil, elem)
+			if gotErrInfo.Err != nil {
+				t.Log(gotErrInfo.Err)
+				t.Fail()
+			}
+		}
+
+		gotErrInfo := cfg.AddDosingPreset(db, ctx, nil, presets[0])
+		if !errors.Is(gotErrInfo.Err, PresetExistsError) {
+			t.Log("Preset was added twice:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.AddDosingPreset(db, ctx, nil, DosingPreset{Name: "test_preset_c", Username: test_user})
+		if !errors.Is(gotErrInfo.Err, IncompletePresetError) {
+			t.Log("Incomplete preset was added:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotPresetsErr := cfg.GetDosingPresets(db, ctx, nil, test_user, "")
+		if gotPresetsErr.Err != nil || len(gotPresetsErr.Presets) != 2 ||
+			gotPresetsErr.Presets[0] != presets[1] || gotPresetsErr.Presets[1] != presets[0] {
+			t.Logf("Wrong presets: %+v ; %v", gotPresetsErr.Presets, gotPresetsErr.Err)
+			t.Fail()
+		}
+
+		for _, elem := range presets {
+			gotErrInfo = cfg.RemoveDosingPreset(db, ctx, nil, test_user, elem.Name)
+			if gotErrInfo.Err != nil {
+				t.Log(gotErrInfo.Err)
+				t.Fail()
+			}
+		}
+
+		gotErrInfo = cfg.RemoveDosingPreset(db, ctx, nil, test_user, presets[0].Name)
+		if !errors.Is(gotErrInfo.Err, NoPresetError) {
+			t.Log("Removed a preset which doesn't exist:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotPresetsErr = cfg.GetDosingPresets(db, ctx, nil, test_user, presets[0].Name)
+		if !errors.Is(gotPresetsErr.Err, NoPresetError) {
+			t.Log("Got a removed preset:", gotPresetsErr.Presets, gotPresetsErr.Err)
+			t.Fail()
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestUndoLogChanges(t *testing.T) {
+	fmt.Println("\t---Starting TestUndoLogChanges()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		_, err := db.ExecContext(ctx, "delete from "+logHistoryTableName+" where changedBy = ?", test_user)
+		if err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(err)
+		}
+
+		temp_doses := genLogDoses()
+		for i := 0; i < 3; i++ {
+			gotErrInfo := cfg.AddToDoseTable(db, ctx, nil, nil, test_user, test_drug,
+				test_route, temp_doses[i], test_units, 0, 0, "", false)
+			if gotErrInfo.Err != nil {
+				cfg.cleanAfterTest(db, ctx)
+				t.Fatal(gotErrInfo.Err)
+			}
+		}
+
+		gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, test_user, false, "", "")
+		if gotLogs.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotLogs.Err)
+		}
+		before := gotLogs.UserLogs
+
+		gotErrInfo := cfg.ChangeUserLog(db, ctx, nil, LogDoseCol, 0, test_user, "123")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		// Only restores the removed logs, the change stays.
+		gotErrInfo = cfg.UndoLogChanges(db, ctx, nil, test_user, 1)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotLogs = cfg.GetLogs(db, ctx, nil, 0, 0, test_user, false, "", "")
+		if gotLogs.Err != nil || len(gotLogs.UserLogs) != len(before) ||
+			gotLogs.UserLogs[len(before)-1].Dose != 123 {
+			t.Logf("Removed logs weren't restored: %+v ; %v", gotLogs.UserLogs, gotLogs.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.UndoLogChanges(db, ctx, nil, test_user, 1)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotLogs = cfg.GetLogs(db, ctx, nil, 0, 0, test_user, false, "", "")
+		if gotLogs.Err != nil || len(gotLogs.UserLogs) != len(before) {
+			t.Logf("Wrong logs after undo: %+v ; %v", gotLogs.UserLogs, gotLogs.Err)
+			t.Fail()
+		} else {
+			for i := range before {
+				if gotLogs.UserLogs[i] != before[i] {
+					t.Logf("Log wasn't restored: %+v ; expected: %+v", gotLogs.UserLogs[i], before[i])
+					t.Fail()
+				}
+			}
+		}
+
+		gotErrInfo = cfg.UndoLogChanges(db, ctx, nil, test_user, 1)
+		if !errors.Is(gotErrInfo.Err, NoLogHistoryError) {
+			t.Log("Expected NoLogHistoryError, got:", gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, 0, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+		}
+
+		cfg.MaxHistoryAge = "1h"
+		gotErrInfo = cfg.PurgeLogHistory(db, ctx, nil, test_user)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		var count int
+		err = db.QueryRowContext(ctx, "select count(*) from "+logHistoryTableName+
+			" where changedBy = ?", test_user).Scan(&count)
+		if err != nil || count != len(before) {
+			t.Logf("Recent history was purged: %d ; %v", count, err)
+			t.Fail()
+		}
+
+		_, err = db.ExecContext(ctx, "delete from "+logHistoryTableName+" where changedBy = ?", test_user)
+		if err != nil {
+			t.Log(err)
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	fmt.Println("\t---Starting TestAuditLog()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		_, err := db.ExecContext(ctx, "delete from "+auditTableName+" where username = ?", test_user)
+		if err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(err)
+		}
+
+		gotErrInfo := cfg.AddToDoseTable(db, ctx, nil, nil, test_user, test_drug,
+			test_route, 100, test_units, 0, 0, "", false)
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		gotLogs := cfg.GetLogs(db, ctx, nil, 1, 0, test_user, true, "", "")
+		if gotLogs.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotLogs.Err)
+		}
+		logID := gotLogs.UserLogs[0].ID
+
+		gotErrInfo = cfg.ChangeUserLog(db, ctx, nil, LogDoseCol, logID, test_user, "123")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.RemoveLogs(db, ctx, nil, test_user, 0, false, logID, "", "")
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotAuditErr := cfg.GetAuditLog(db, ctx, nil, AuditFilter{Username: test_user})
+		if gotAuditErr.Err != nil {
+			t.Log(gotAuditErr.Err)
+			t.Fail()
+		}
+		expected := []string{ActionRemoveLogs, ActionChangeUserLog, ActionAddToDoseTable}
+		if len(gotAuditErr.Entries) != len(expected) {
+			t.Logf("Wrong audit entries: %+v", gotAuditErr.Entries)
+			t.Fail()
+		} else if added := gotAuditErr.Entries[2]; len(added.AffectedIDs) != 1 ||
+			added.AffectedIDs[0] != logID {
+			t.Logf("Wrong ID of the added log: %+v ; expected: %d", added, logID)
+			t.Fail()
+		} else {
+			for i, elem := range gotAuditErr.Entries {
+				if elem.Action != expected[i] || elem.Username != test_user {
+					t.Logf("Wrong audit entry: %+v ; expected action: %q", elem, expected[i])
+					t.Fail()
+				}
+			}
+		}
+
+		gotAuditErr = cfg.GetAuditLog(db, ctx, nil, AuditFilter{
+			Username: test_user,
+			Action:   ActionChangeUserLog,
+		})
+		if gotAuditErr.Err != nil || len(gotAuditErr.Entries) != 1 {
+			t.Logf("Wrong audit entries for action: %+v ; %v", gotAuditErr.Entries, gotAuditErr.Err)
+			t.Fail()
+		} else {
+			elem := gotAuditErr.Entries[0]
+			if len(elem.AffectedIDs) != 1 || elem.AffectedIDs[0] != logID ||
+				!strings.Contains(elem.Before, `"Dose":100`) ||
+				!strings.Contains(elem.After, "123") {
+				t.Logf("Wrong change recorded: %+v", elem)
+				t.Fail()
+			}
+		}
+
+		gotAuditErr = cfg.GetAuditLog(db, ctx, nil, AuditFilter{
+			Username: test_user,
+			From:     time.Now().Add(time.Hour).Unix(),
+		})
+		if gotAuditErr.Err != nil || len(gotAuditErr.Entries) != 0 {
+			t.Logf("Entries outside of the time range: %+v ; %v", gotAuditErr.Entries, gotAuditErr.Err)
+			t.Fail()
+		}
+
+		err = cfg.CleanInfoTable(db, ctx, test_user)
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+
+		gotAuditErr = cfg.GetAuditLog(db, ctx, nil, AuditFilter{
+			Username: test_user,
+			Action:   ActionCleanInfoTable,
+		})
+		if gotAuditErr.Err != nil || len(gotAuditErr.Entries) != 1 ||
+			!strings.Contains(gotAuditErr.Entries[0].Before, test_drug) {
+			t.Logf("Cleaning the info table wasn't recorded: %+v ; %v", gotAuditErr.Entries, gotAuditErr.Err)
+			t.Fail()
+		}
+
+		// Needed by cleanAfterTest().
+		err = cfg.InitInfoTable(db, ctx)
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		}
+
+		_, err = db.ExecContext(ctx, "delete from "+auditTableName+" where username = ?", test_user)
+		if err != nil {
+			t.Log(err)
+		}
+		_, err = db.ExecContext(ctx, "delete from "+logHistoryTableName+" where changedBy = ?", test_user)
+		if err != nil {
+			t.Log(err)
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+// A source used only for tests, it returns subs or err for every substance.
+type testSource struct {
+	srcCfg SourceConfig
+	subs   []DrugInfo
+	err    error
+}
+
+func (src *testSource) FetchSubstance(ctx context.Context, drugname string) (error, []DrugInfo) {
+	if src.err != nil {
+		return src.err, nil
+	}
+	return nil, src.subs
+}
+
+func (src *testSource) Routes(ctx context.Context, drugname string) (error, []string) {
+	var routes []string
+	for _, elem := range src.subs {
+		routes = append(routes, elem.DrugRoute)
+	}
+	return nil, routes
+}
+
+func (src *testSource) Describe() string {
+	return "test source"
+}
+
+// A source used only for tests, which also returns inter as the
+// interactions of every substance.
+type testInterSource struct {
+	testSource
+	inter []Interaction
+}
+
+func (src *testInterSource) FetchInteractions(ctx context.Context, drugname string) (error, []Interaction) {
+	return nil, src.inter
+}
+
+func TestSourceRegistry(t *testing.T) {
+	fmt.Println("\t---Starting TestSourceRegistry()")
+	_, _, cfg := initForTests("")
+
+	initTestSource := func(cfg *Config, srcCfg SourceConfig) (error, Source) {
+		return nil, &testSource{srcCfg: srcCfg}
+	}
+
+	err := RegisterSource("", initTestSource)
+	if !errors.Is(err, EmptySourceNameError) {
+		t.Log("Expected EmptySourceNameError, got:", err)
+		t.Fail()
+	}
+
+	err = RegisterSource(test_source, nil)
+	if !errors.Is(err, NilSourceInitError) {
+		t.Log("Expected NilSourceInitError, got:", err)
+		t.Fail()
+	}
+
+	err = RegisterSource(PsychonautwikiName, initTestSource)
+	if !errors.Is(err, SourceAlreadyRegisteredError) {
+		t.Log("Expected SourceAlreadyRegisteredError, got:", err)
+		t.Fail()
+	}
+
+	const noConfigSource string = "test_no_config"
+	for _, name := range []string{test_source, noConfigSource} {
+		err = RegisterSource(name, initTestSource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func(name string) {
+			sourcesRegistryLock.Lock()
+			delete(sourcesRegistry, name)
+			sourcesRegistryLock.Unlock()
+		}(name)
+	}
+
+	names := RegisteredSources()
+	expected := []string{LocalFileName, PsychonautwikiName, test_source, noConfigSource}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Logf("Wrong registered sources: %v ; expected: %v", names, expected)
+		t.Fail()
+	}
+
+	cfg.UseSource = test_source
+	err, src := cfg.InitSource()
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	} else if got, ok := src.(*testSource); !ok || got.srcCfg != GetSourceData()[test_source] {
+		t.Logf("Wrong source: %+v", src)
+		t.Fail()
+	}
+
+	cfg.UseSource = noConfigSource
+	err, _ = cfg.InitSource()
+	if !errors.Is(err, NoSourceConfigError) {
+		t.Log("Expected NoSourceConfigError, got:", err)
+		t.Fail()
+	}
+
+	cfg.UseSource = "test_not_registered"
+	err, _ = cfg.InitSource()
+	if !errors.Is(err, NoValidSourceSel) {
+		t.Log("Expected NoValidSourceSel, got:", err)
+		t.Fail()
+	}
+}
+
+func TestLocalFileSource(t *testing.T) {
+	fmt.Println("\t---Starting TestLocalFileSource()")
+
+	_, _, cfg := initForTests("")
+	srcmap := cfg.InitSourceMap(DefaultSourceAddress)
+	if _, exists := srcmap[LocalFileName]; !exists {
+		t.Logf("No default local file source: %+v", srcmap)
+		t.Fail()
+	}
+
+	const localDrug string = "test_drug_local"
+	writeFile := func(dir string, name string, content string) {
+		err := os.WriteFile(dir+"/"+name, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	validDir := t.TempDir()
+	writeFile(validDir, "a.toml", `
+[[Substance]]
+DrugName = '`+localDrug+`'
+DrugRoute = 'oral'
+DoseUnits = '`+test_units+`'
+OnsetMin = 20
+OnsetMax = 40
+OnsetUnits = 'minutes'
+TotalDurMin = 4
+TotalDurMax = 6
+TotalDurUnits = 'hours'
+
+[[Substance]]
+DrugName = '`+test_drug+`'
+DrugRoute = '`+test_route+`'
+DoseUnits = '`+test_units+`'
+TotalDurMax = 1
+TotalDurUnits = 'hours'
+`)
+	writeFile(validDir, "b.json", `{"Substance": [{"DrugName": "`+localDrug+`",
+		"DrugRoute": "insufflated", "DoseUnits": "`+test_units+`",
+		"TotalDurMin": 1, "TotalDurMax": 2, "TotalDurUnits": "hours"}]}`)
+	writeFile(validDir, "ignored.txt", "not a substance")
+
+	err, src := NewLocalFileSource(validDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(src.Substances()) != 3 {
+		t.Logf("Wrong substances: %+v", src.Substances())
+		t.Fail()
+	}
+
+	err, routes := src.Routes(context.Background(), strings.ToUpper(localDrug))
+	if err != nil || strings.Join(routes, ",") != "oral,insufflated" {
+		t.Logf("Wrong routes: %v ; %v", routes, err)
+		t.Fail()
+	}
+
+	err, _ = src.FetchSubstance(context.Background(), "test_drug_missing")
+	if !errors.Is(err, LocalFileNoSubstanceError) {
+		t.Log("Expected LocalFileNoSubstanceError, got:", err)
+		t.Fail()
+	}
+
+	invalid := map[string]string{
+		"bad.toml":        "[[Substance]\nDrugName = 'broken'",
+		"bad.json":        `{"Substance": [{"DrugName": }]}`,
+		"no_units.toml":   "[[Substance]]\nDrugName = 'a'\nDrugRoute = 'oral'\nTotalDurMax = 1\nTotalDurUnits = 'hours'",
+		"no_total.json":   `{"Substance": [{"DrugName": "a", "DrugRoute": "oral", "DoseUnits": "mg"}]}`,
+		"min_max.toml":    "[[Substance]]\nDrugName = 'a'\nDrugRoute = 'oral'\nDoseUnits = 'mg'\nLowDoseMin = 2\nLowDoseMax = 1\nTotalDurMax = 1\nTotalDurUnits = 'hours'",
+		"bad_units.json":  `{"Substance": [{"DrugName": "a", "DrugRoute": "oral", "DoseUnits": "mg", "TotalDurMax": 1, "TotalDurUnits": "days"}]}`,
+		"unsupported.yml": "Substance: []",
+	}
+	expected := map[string]error{
+		"no_units.toml":   InvalidDrugInfoError,
+		"no_total.json":   InvalidDrugInfoError,
+		"min_max.toml":    InvalidDrugInfoError,
+		"bad_units.json":  InvalidDrugInfoError,
+		"unsupported.yml": LocalFileFormatError,
+	}
+	for name, content := range invalid {
+		dir := t.TempDir()
+		writeFile(dir, name, content)
+		err, _ = NewLocalFileSource(dir + "/" + name)
+		if err == nil || (expected[name] != nil && !errors.Is(err, expected[name])) {
+			t.Logf("Wrong error for: %s ; got: %v ; expected: %v", name, err, expected[name])
+			t.Fail()
+		}
+	}
+
+	dupDir := t.TempDir()
+	writeFile(dupDir, "a.json", `{"Substance": [{"DrugName": "a", "DrugRoute": "oral", "DoseUnits": "mg", "TotalDurMax": 1, "TotalDurUnits": "hours"}]}`)
+	writeFile(dupDir, "b.toml", "[[Substance]]\nDrugName = 'A'\nDrugRoute = 'Oral'\nDoseUnits = 'mg'\nTotalDurMax = 1\nTotalDurUnits = 'hours'")
+	err, _ = NewLocalFileSource(dupDir)
+	if !errors.Is(err, LocalFileDuplicateError) {
+		t.Log("Expected LocalFileDuplicateError, got:", err)
+		t.Fail()
+	}
+
+	err, _ = NewLocalFileSource(t.TempDir())
+	if !errors.Is(err, LocalFileNoFilesError) {
+		t.Log("Expected LocalFileNoFilesError, got:", err)
+		t.Fail()
+	}
+
+	err, _ = NewLocalFileSource("")
+	if !errors.Is(err, LocalFilePathEmptyError) {
+		t.Log("Expected LocalFilePathEmptyError, got:", err)
+		t.Fail()
+	}
+
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		// The test drug is already in the info table, so it's skipped.
+		gotErrInfo := cfg.LoadLocalFileSource(db, ctx, nil, src, test_user)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotInfoErr := cfg.GetLocalInfo(db, ctx, nil, localDrug, test_user)
+		if gotInfoErr.Err != nil || len(gotInfoErr.DrugI) != 2 {
+			t.Logf("Wrong info loaded: %+v ; %v", gotInfoErr.DrugI, gotInfoErr.Err)
+			t.Fail()
+		}
+
+		gotInfoErr = cfg.GetLocalInfo(db, ctx, nil, test_drug, test_user)
+		if gotInfoErr.Err != nil || len(gotInfoErr.DrugI) != 1 || gotInfoErr.DrugI[0].TotalDurMax != 0 {
+			t.Logf("Info already present was changed: %+v ; %v", gotInfoErr.DrugI, gotInfoErr.Err)
+			t.Fail()
+		}
+
+		gotErrInfo = cfg.LoadLocalFileSource(db, ctx, nil, src, test_user)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+func TestRefreshInfo(t *testing.T) {
+	fmt.Println("\t---Starting TestRefreshInfo()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg := initForTests(v)
+		if db == nil {
+			return
+		}
+		defer db.Close()
+
+		const staleDrug string = "test_drug_stale"
+		oldInfo := []DrugInfo{
+			{DrugName: staleDrug, DrugRoute: "oral", DoseUnits: test_units, Threshold: 1},
+			{DrugName: staleDrug, DrugRoute: "smoked", DoseUnits: test_units, Threshold: 2},
+		}
+		gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, oldInfo, test_user)
+		if gotErrInfo.Err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		_, err := db.ExecContext(ctx, "update "+cfg.UseSource+" set timeOfFetch = ? where drugName = ?",
+			time.Now().Add(-2*time.Hour).Unix(), staleDrug)
+		if err != nil {
+			cfg.cleanAfterTest(db, ctx)
+			t.Fatal(err)
+		}
+
+		cfg.MaxInfoAge = "none"
+		gotStaleErr := cfg.GetStaleInfo(db, ctx, nil, test_user)
+		if gotStaleErr.Err != nil || len(gotStaleErr.StaleInfo) != 0 {
+			t.Logf("Expected nothing stale, got: %+v ; %v", gotStaleErr.StaleInfo, gotStaleErr.Err)
+			t.Fail()
+		}
+
+		cfg.MaxInfoAge = "1h"
+		gotStaleErr = cfg.GetStaleInfo(db, ctx, nil, test_user)
+		if gotStaleErr.Err != nil || len(gotStaleErr.StaleInfo) != 1 ||
+			gotStaleErr.StaleInfo[0].DrugName != staleDrug {
+			t.Logf("Wrong stale info: %+v ; %v", gotStaleErr.StaleInfo, gotStaleErr.Err)
+			t.Fail()
+		}
+
+		// AutoFetch is disabled for tests, the refresh works anyway.
+		failSrc := &testSource{err: errors.New("test source can't be reached")}
+		gotErrInfo = cfg.RefreshInfo(db, ctx, nil, staleDrug, test_user, failSrc)
+		if gotErrInfo.Err == nil {
+			t.Log("Expected an error from the failing source")
+			t.Fail()
+		}
+
+		gotInfoErr := cfg.GetLocalInfo(db, ctx, nil, staleDrug, test_user)
+		if gotInfoErr.Err != nil || len(gotInfoErr.DrugI) != len(oldInfo) {
+			t.Logf("Old info wasn't kept: %+v ; %v", gotInfoErr.DrugI, gotInfoErr.Err)
+			t.Fail()
+		}
+
+		newSrc := &testSource{subs: []DrugInfo{
+			{DrugName: staleDrug, DrugRoute: "oral", DoseUnits: test_units, Threshold: 3},
+		}}
+		gotErrInfo = cfg.RefreshInfo(db, ctx, nil, staleDrug, test_user, newSrc)
+		if gotErrInfo.Err != nil {
+			t.Log(gotErrInfo.Err)
+			t.Fail()
+		}
+
+		gotInfoErr = cfg.GetLocalInfo(db, ctx, nil, staleDrug, test_user)
+		if gotInfoErr.Err != nil || len(gotInfoErr.DrugI) != 1 ||
+			gotInfoErr.DrugI[0].DrugRoute != "oral" || gotInfoErr.DrugI[0].Threshold != 3 {
+			t.Logf("Info wasn't replaced: %+v ; %v", gotInfoErr.DrugI, gotInfoErr.Err)
+			t.Fail()
+		}
+
+		gotStaleErr = cfg.GetStaleInfo(db, ctx, nil, test_user)
+		if gotStaleErr.Err != nil || len(gotStaleErr.StaleInfo) != 0 {
+			t.Logf("Still stale after refresh: %+v ; %v", gotStaleErr.StaleInfo, gotStaleErr.Err)
+			t.Fail()
+		}
+
+		// The client of Psychonautwiki is created even when AutoFetch is
+		// disabled, the refresh fails because of the server, without a panic.
+		cfg.AutoFetch = false
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		err, pwSrc := initPsychonautwikiSource(&cfg,
+			SourceConfig{API_ADDRESS: strings.TrimPrefix(server.URL, "https://")})
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		} else {
+			gotErrInfo = cfg.RefreshInfo(db, ctx, nil, staleDrug, test_user, pwSrc)
+			if gotErrInfo.Err == nil {
+				t.Log("Expected an error from the test server")
+				t.Fail()
+			}
+		}
+		server.Close()
+
+		gotInfoErr = cfg.GetLocalInfo(db, ctx, nil, staleDrug, test_user)
+		if gotInfoErr.Err != nil || len(gotInfoErr.DrugI) != 1 || gotInfoErr.DrugI[0].Threshold != 3 {
+			t.Logf("Info changed after a failed refresh: %+v ; %v", gotInfoErr.DrugI, gotInfoErr.Err)
+			t.Fail()
+		}
+
+		_, err = db.ExecContext(ctx, "delete from "+auditTableName+" where username = ?", test_user)
+		if err != nil {
+			t.Log(err)
+		}
+
+		cfg.cleanAfterTest(db, ctx)
+	}
+}
+
+// Opens an empty database used only for testing migrations, so that the
+// tables used by all other tests aren't touched. For sqlite it's a temporary
+// file, for MySQL and PostgreSQL a new database is created next to the
+// configured one, which requires the user to have the privileges for it.
+func openMigrateTestDB(t *testing.T, dbDriver string) (*sql.DB, context.Context, Config, func()) {
+	const migrateDBName string = "gpd_migrate_test"
+
+	_, _, cfg := initForTests("")
+	cfg.AutoFetch = false
+	cfg.AutoRemove = false
+	cfg.UseSource = test_source
+	cfg.DBDriver = dbDriver
+
+	fmt.Println("\topenMigrateTestDB: DBDriver:", cfg.DBDriver)
+
+	ctx := context.Background()
+
+	settings := cfg.DBSettings[dbDriver]
+	if dbDriver == SqliteDriver {
+		settings.Path = t.TempDir() + "/" + migrateDBName + ".db"
+		settings.Encrypt = false
+		cfg.DBSettings[dbDriver] = settings
+
+		db := cfg.OpenDBConnection(ctx)
+		return db, ctx, cfg, func() { db.Close() }
+	}
+
+	mainDB := cfg.OpenDBConnection(ctx)
+
+	_, err := mainDB.ExecContext(ctx, "drop database if exists "+migrateDBName)
+	if err == nil {
+		_, err = mainDB.ExecContext(ctx, "create database "+migrateDBName)
+	}
+	if err != nil {
+		mainDB.Close()
+		t.Skip("Can't create a database for testing migrations:", err)
+	}
+
+	// Replace only the database name in the path, keep the parameters.
+	slash := strings.LastIndex(settings.Path, "/")
+	params := ""
+	if question := strings.Index(settings.Path[slash+1:], "?"); question != -1 {
+		params = settings.Path[slash+1+question:]
+	}
+	settings.Path = settings.Path[:slash+1] + migrateDBName + params
+	cfg.DBSettings[dbDriver] = settings
+
+	db := cfg.OpenDBConnection(ctx)
+
+	// Normally created by InitAllDBTables(), but the migrations need it too.
+	err = cfg.initPostgresCollation(db, ctx)
+	if err != nil {
+		db.Close()
+		mainDB.Close()
+		t.Fatal(err)
+	}
+
+	return db, ctx, cfg, func() {
+		db.Close()
+		_, err := mainDB.ExecContext(ctx, "drop database if exists "+migrateDBName)
+		if err != nil {
+			t.Log(err)
+		}
+		mainDB.Close()
+	}
+}
+
+// Creates the tables the same way as before versioning was added,
+// extraSetCols are added to the end of the user settings table.
+func createV1Tables(db *sql.DB, ctx context.Context, logs bool, extraSetCols string) error {
+	if logs {
+		_, err := db.ExecContext(ctx, "create table "+loggingTableName+" ("+
+			"timeOfDoseStart bigint not null,"+
+			"username varchar(255) not null,"+
+			"timeOfDoseEnd bigint default 0 not null,"+
+			"drugName text not null,"+
+			"dose real not null,"+
+			"doseUnits text not null,"+
+			"drugRoute text not null,"+
+			"cost real default 0 not null,"+
+			"costCurrency text default '' not null,"+
+			"primary key (timeOfDoseStart, username));")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := db.ExecContext(ctx, "create table "+userSetTableName+" ("+
+		"username varchar(255) not null,"+
+		"useIDForRemember bigint not null,"+
+		extraSetCols+
+		"primary key (username));")
+	return err
+}
+
+func TestMigrateDB(t *testing.T) {
+	fmt.Println("\t---Starting TestMigrateDB()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg, closeDB := openMigrateTestDB(t, v)
+		defer closeDB()
+
+		err, version := cfg.GetSchemaVersion(db, ctx)
+		if err != nil || version != 0 {
+			t.Fatal("Expected version 0 for an empty database, got:", version, err)
+		}
+
+		// Only the settings table exists, it's still an old database.
+		err = createV1Tables(db, ctx, false, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err, version = cfg.GetSchemaVersion(db, ctx)
+		if err != nil || version != 1 {
+			t.Fatal("Expected version 1 without a logs table, got:", version, err)
+		}
+
+		err = cfg.MigrateDB(db, ctx, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err, version = cfg.GetSchemaVersion(db, ctx)
+		if err != nil || version != 1 || cfg.CheckTables(db, ctx, schemaVersionTableName) {
+			t.Log("Dry run changed the database, version:", version, err)
+			t.Fail()
+		}
+
+		err = cfg.MigrateDB(db, ctx, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err, version = cfg.GetSchemaVersion(db, ctx)
+		if err != nil || version != LatestSchemaVersion() {
+			t.Log("Expected version:", LatestSchemaVersion(), "got:", version, err)
+			t.Fail()
+		}
+
+		err = cfg.CleanDB(db, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A failed migration isn't counted, the temporary table used for
+		// rebuilding the logs already exists.
+		err = createV1Tables(db, ctx, true, "")
+		if err == nil {
+			_, err = db.ExecContext(ctx, "create table "+loggingTableName+"_migrate (id int)")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = cfg.MigrateDB(db, ctx, false)
+		if err == nil {
+			t.Log("Expected the log ID migration to fail")
+			t.Fail()
+		}
+
+		err, version = cfg.GetSchemaVersion(db, ctx)
+		if err != nil || version != 1 {
+			t.Log("Expected version 1 after the failed migration, got:", version, err)
+			t.Fail()
+		}
+
+		err = cfg.CleanDB(db, ctx)
+		if err != nil {
+			t.Log(err)
+			t.Fail()
+		} else if cfg.CheckTables(db, ctx, "") {
+			t.Log("Not all tables were removed")
+			t.Fail()
+		}
+	}
+}
+
+func TestMigrateLogIDs(t *testing.T) {
+	fmt.Println("\t---Starting TestMigrateLogIDs()")
+	for _, v := range testWithDrivers() {
+		db, ctx, cfg, closeDB := openMigrateTestDB(t, v)
+		defer closeDB()
+
+		err := createV1Tables(db, ctx, true, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const otherUser string = "test_user_other"
+		// Not added in order, the IDs should still follow the start times.
+		oldLogs := []struct {
+			start int64
+			user  string
+			drug  string
+		}{
+			{300, test_user, "test_drug_3"},
+			{100, test_user, "test_drug_1"},
+			{150, otherUser, "test_drug_other"},
+			{200, test_user, "test_drug_2"},
+		}
+		for _, elem := range oldLogs {
+			_, err = db.ExecContext(ctx, "insert into "+loggingTableName+
+				" (timeOfDoseStart, username, drugName, dose, doseUnits, drugRoute) "+
+				"values(?, ?, ?, ?, ?, ?)", elem.start, elem.user, elem.drug, 1, test_units, test_route)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// The remembered dosing used the start time as the ID, one which
+		// doesn't exist anymore is forgotten.
+		_, err = db.ExecContext(ctx, "insert into "+userSetTableName+
+			" (username, useIDForRemember) values(?, ?), (?, ?)", test_user, 200, otherUser, 999)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = cfg.InitAllDBTables(db, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err, version := cfg.GetSchemaVersion(db, ctx)
+		if err != nil || version != LatestSchemaVersion() {
+			t.Log("Expected version:", LatestSchemaVersion(), "got:", version, err)
+			t.Fail()
+		}
+
+		gotLogsErr := cfg.GetLogs(db, ctx, nil, 0, 0, test_user, false, "", "")
+		if gotLogsErr.Err != nil || len(gotLogsErr.UserLogs) != 3 {
+			t.Fatal("Logs weren't kept:", gotLogsErr.UserLogs, gotLogsErr.Err)
+		}
+
+		for i, elem := range gotLogsErr.UserLogs {
+			// The other user's log got ID 2, since it's second by start time.
+			wantID := int64(i + 1)
+			if i != 0 {
+				wantID++
+			}
+			wantStart := int64(100 * (i + 1))
+			if elem.ID != wantID || elem.StartTime != wantStart {
+				t.Logf("Expected ID: %d ; start: %d ; got: %+v", wantID, wantStart, elem)
+				t.Fail()
+			}
+		}
+
+		gotLogsErr = cfg.RecallDosing(db, ctx, nil, test_user)
+		if gotLogsErr.Err != nil || len(gotLogsErr.UserLogs) != 1 ||
+			gotLogsErr.UserLogs[0].ID != 3 || gotLogsErr.UserLogs[0].StartTime != 200 {
+			t.Log("Wrong remembered dosing:", gotLogsErr.UserLogs, gotLogsErr.Err)
+			t.Fail()
+		}
+
+		gotUserSetErr := cfg.GetUserSettings(db, ctx, nil, "useIDForRemember", otherUser)
+		if gotUserSetErr.Err != nil || gotUserSetErr.UserSetting != ForgetInputConfigMagicNumber {
+			t.Log("Missing remembered dosing wasn't forgotten:", gotUserSetErr.UserSetting, gotUserSetErr.Err)
+			t.Fail()
+		}
+
+		err = cfg.AddToAllNamesTables(db, ctx, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, []DrugInfo{
+			{DrugName: test_drug, DrugRoute: test_route, DoseUnits: test_units},
+		}, test_user)
+		if gotErrInfo.Err != nil {
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		gotErrInfo = cfg.AddToDoseTable(db, ctx, nil, nil, test_user, test_drug,
+			test_route, 1, test_units, 0, 0, "", false)
+		if gotErrInfo.Err != nil {
+			t.Fatal(gotErrInfo.Err)
+		}
+
+		gotLogsErr = cfg.GetLogs(db, ctx, nil, 1, 0, test_user, true, "", "")
+		if gotLogsErr.Err != nil || len(gotLogsErr.UserLogs) != 1 ||
+			gotLogsErr.UserLogs[0].ID != 5 || gotLogsErr.UserLogs[0].DrugName != test_drug {
+			t.Log("Wrong ID for a new log:", gotLogsErr.UserLogs, gotLogsErr.Err)
+			t.Fail()
+		}
+
+		err = cfg.CleanDB(db, ctx)
+		if err != nil {
+			t.Log(err)
+		}
+	}
+}
+
+func TestInitNamesFiles(t *testing.T) {
+	fmt.Println("\t---Starting TestInitNamesFiles()")
+	_, _, cfg := initForTests("")
+
+	// Don't touch the real config directory of the user.
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	t.Setenv("AppData", configDir)
+
+	err, setdir := InitSettingsDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workDir := t.TempDir()
+	prevDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(prevDir)
+
+	sourceDir := allNamesConfigsDir + "/" + sourceNamesDir + "/" + test_source
+	err = os.MkdirAll(sourceDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFiles := func(files map[string]string) {
+		for name, content := range files {
+			err := os.WriteFile(name, []byte(content), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	writeFiles(map[string]string{
+		allNamesConfigsDir + "/" + namesSubstanceFilename: "first",
+		sourceDir + "/" + toleranceFilename:               "first",
+	})
+
+	err = cfg.InitNamesFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copiedTo := setdir + "/" + allNamesConfigsDir
+	changed := copiedTo + "/" + namesSubstanceFilename
+	err = os.WriteFile(changed, []byte("changed by the user"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the new files are copied, the changed one is kept.
+	writeFiles(map[string]string{
+		allNamesConfigsDir + "/" + namesSubstanceFilename: "second",
+		allNamesConfigsDir + "/" + toleranceFilename:      "second",
+		sourceDir + "/" + interactionsFilename:            "second",
+	})
+
+	err = cfg.InitNamesFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFiles := map[string]string{
+		changed:                            "changed by the user",
+		copiedTo + "/" + toleranceFilename: "second",
+		setdir + "/" + sourceDir + "/" + toleranceFilename:    "first",
+		setdir + "/" + sourceDir + "/" + interactionsFilename: "second",
+	}
+	for name, want := range wantFiles {
+		got, err := os.ReadFile(name)
+		if err != nil || string(got) != want {
+			t.Logf("File: %q ; expected: %q ; got: %q ; %v", name, want, got, err)
+			t.Fail()
+		}
+	}
+}
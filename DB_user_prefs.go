@@ -0,0 +1,578 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+const userPrefsTableName string = "userPreferences"
+
+const ActionSetUserPref string = "user preference change completed"
+const ActionUnsetUserPref string = "user preference unset completed"
+
+// The types of the values of the user preferences.
+const PrefTypeString string = "string"
+const PrefTypeBool string = "bool"
+const PrefTypeFloat string = "float"
+const PrefTypeInt string = "int"
+const PrefTypeTimezone string = "timezone"
+
+// The keys of the user preferences, checkout SetUserPref().
+const PrefDefaultRoute string = "default-route"
+const PrefDefaultUnits string = "default-units"
+const PrefDefaultCurrency string = "default-currency"
+const PrefTimezone string = "timezone"
+const PrefWeight string = "weight"
+const PrefHeight string = "height"
+const PrefAge string = "age"
+const PrefSex string = "sex"
+const PrefScalePerKg string = "scale-per-kg"
+const PrefWarnDoseClass string = "warn-dose-class"
+const PrefWarnBAC string = "warn-bac"
+const PrefWarnTolerance string = "warn-tolerance"
+const PrefWarnInteractions string = "warn-interactions"
+
+type userPrefDef struct {
+	valueType string
+	// Returns the value used when the preference isn't set.
+	fallback func(cfg *Config) string
+	// If not 0, the biggest allowed value of a number.
+	max float64
+	// If not empty, the only allowed values of a string, without
+	// considering the case.
+	allowed []string
+}
+
+func noPrefFallback(cfg *Config) string {
+	return ""
+}
+
+func truePrefFallback(cfg *Config) string {
+	return "true"
+}
+
+func falsePrefFallback(cfg *Config) string {
+	return "false"
+}
+
+var userPrefDefs = map[string]userPrefDef{
+	PrefDefaultRoute:    {valueType: PrefTypeString, fallback: noPrefFallback},
+	PrefDefaultUnits:    {valueType: PrefTypeString, fallback: noPrefFallback},
+	PrefDefaultCurrency: {valueType: PrefTypeString, fallback: func(cfg *Config) string { return cfg.CostCurrency }},
+	PrefTimezone:        {valueType: PrefTypeTimezone, fallback: func(cfg *Config) string { return cfg.Timezone }},
+	// The profile of the user, checkout UserProfile.
+	PrefWeight:           {valueType: PrefTypeFloat, fallback: noPrefFallback, max: 700},
+	PrefHeight:           {valueType: PrefTypeFloat, fallback: noPrefFallback, max: 300},
+	PrefAge:              {valueType: PrefTypeInt, fallback: noPrefFallback, max: 150},
+	PrefSex:              {valueType: PrefTypeString, fallback: noPrefFallback, allowed: []string{SexMale, SexFemale}},
+	PrefScalePerKg:       {valueType: PrefTypeBool, fallback: falsePrefFallback},
+	PrefWarnDoseClass:    {valueType: PrefTypeBool, fallback: truePrefFallback},
+	PrefWarnBAC:          {valueType: PrefTypeBool, fallback: truePrefFallback},
+	PrefWarnTolerance:    {valueType: PrefTypeBool, fallback: truePrefFallback},
+	PrefWarnInteractions: {valueType: PrefTypeBool, fallback: truePrefFallback},
+}
+
+// UserPref is a single preference of a user. The preferences are kept in
+// the database like the user settings, so that every user has their own,
+// even when sharing a database.
+type UserPref struct {
+	Key   string
+	Value string
+	// PrefTypeString, PrefTypeBool, PrefTypeFloat, PrefTypeInt
+	// or PrefTypeTimezone
+	Type string
+	// If true, the preference isn't set and Value comes from the Config
+	// struct or is the default.
+	IsDefault bool
+}
+
+type UserPrefsError struct {
+	Prefs    []UserPref
+	Username string
+	Err      error
+}
+
+// UserPrefKeys returns the keys of all available user preferences, sorted.
+func UserPrefKeys() []string {
+	keys := make([]string, 0, len(userPrefDefs))
+	for key := range userPrefDefs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Checks the value of a preference and returns it in the form in which
+// it's stored in the database.
+func validateUserPref(key string, value string) (error, string) {
+	def, exists := userPrefDefs[key]
+	if !exists {
+		return fmt.Errorf("%w: %q ; available: %s", UnknownUserPrefError, key,
+			strings.Join(UserPrefKeys(), ", ")), ""
+	}
+
+	value = strings.TrimSpace(value)
+	switch def.valueType {
+	case PrefTypeBool:
+		got, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%w: %s ; %q ; must be true or false", InvalidUserPrefError,
+				key, value), ""
+		}
+		return nil, strconv.FormatBool(got)
+	case PrefTypeFloat:
+		got, err := strconv.ParseFloat(value, 32)
+		if err != nil || got < 0 || (def.max != 0 && got > def.max) {
+			return invalidNumberPref(key, value, def), ""
+		}
+		return nil, strconv.FormatFloat(got, 'f', -1, 32)
+	case PrefTypeInt:
+		got, err := strconv.Atoi(value)
+		if err != nil || got < 0 || (def.max != 0 && float64(got) > def.max) {
+			return invalidNumberPref(key, value, def), ""
+		}
+		return nil, strconv.Itoa(got)
+	case PrefTypeTimezone:
+		_, err := time.LoadLocation(value)
+		if err != nil || value == "" {
+			return fmt.Errorf("%w: %s ; %q ; must be a timezone like \"Local\" or \"Europe/Paris\"",
+				InvalidUserPrefError, key, value), ""
+		}
+		return nil, value
+	}
+
+	if value == "" {
+		return fmt.Errorf("%w: %s ; the value is empty, to remove it, unset it instead",
+			InvalidUserPrefError, key), ""
+	}
+
+	if len(def.allowed) != 0 {
+		for _, elem := range def.allowed {
+			if strings.EqualFold(value, elem) {
+				return nil, elem
+			}
+		}
+		return fmt.Errorf("%w: %s ; %q ; must be one of: %s", InvalidUserPrefError,
+			key, value, strings.Join(def.allowed, ", ")), ""
+	}
+
+	return nil, value
+}
+
+func invalidNumberPref(key string, value string, def userPrefDef) error {
+	if def.max != 0 {
+		return fmt.Errorf("%w: %s ; %q ; must be from 0 to %g", InvalidUserPrefError,
+			key, value, def.max)
+	}
+	return fmt.Errorf("%w: %s ; %q ; must be a number bigger or equal to 0",
+		InvalidUserPrefError, key, value)
+}
+
+// Returns the stored preference of a user using the transaction,
+// nil if it isn't set.
+func userPrefTx(ctx context.Context, tx *sql.Tx, username string, key string) (error, *UserPref) {
+	const printN string = "userPrefTx()"
+
+	pref := UserPref{Key: key}
+	err := tx.QueryRowContext(ctx, "select prefType, prefValue from "+userPrefsTableName+
+		" where username = ? and prefKey = ?", username, key).Scan(&pref.Type, &pref.Value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "tx.QueryRowContext(): "), err), nil
+	}
+
+	return nil, &pref
+}
+
+// Returns all preferences of a user, sorted by key, the ones which
+// aren't set have the fallback value.
+func (cfg *Config) getUserPrefs(db *sql.DB, ctx context.Context, username string) (error, []UserPref) {
+	const printN string = "getUserPrefs()"
+
+	rows, err := db.QueryContext(ctx, "select prefKey, prefType, prefValue from "+
+		userPrefsTableName+" where username = ?", username)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.QueryContext(): "), err), nil
+	}
+	defer rows.Close()
+
+	stored := map[string]UserPref{}
+	for rows.Next() {
+		var tempPref UserPref
+		err = rows.Scan(&tempPref.Key, &tempPref.Type, &tempPref.Value)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err), nil
+		}
+		stored[tempPref.Key] = tempPref
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "rows.Err(): "), err), nil
+	}
+
+	var prefs []UserPref
+	for _, key := range UserPrefKeys() {
+		pref, exists := stored[key]
+		if !exists {
+			def := userPrefDefs[key]
+			pref = UserPref{
+				Key:       key,
+				Value:     def.fallback(cfg),
+				Type:      def.valueType,
+				IsDefault: true,
+			}
+		}
+		prefs = append(prefs, pref)
+	}
+
+	return nil, prefs
+}
+
+// Returns the values of all preferences of a user, if there's an error,
+// the fallback values are returned.
+func (cfg *Config) userPrefValues(db *sql.DB, ctx context.Context, username string) map[string]string {
+	const printN string = "userPrefValues()"
+
+	values := map[string]string{}
+	err, prefs := cfg.getUserPrefs(db, ctx, username)
+	if err != nil {
+		printNameVerbose(cfg.VerbosePrinting, printN, err)
+		for key, def := range userPrefDefs {
+			values[key] = def.fallback(cfg)
+		}
+		return values
+	}
+
+	for _, elem := range prefs {
+		values[elem.Key] = elem.Value
+	}
+	return values
+}
+
+// SetUserPref changes a preference of a user, checkout UserPrefKeys()
+// for the available keys. Preferences which aren't set fall back to
+// the values in the Config struct, for example timezone uses Timezone and
+// default-currency uses CostCurrency. The default-currency preference is used
+// by AddToDoseTableAt() and ImportLogs() and the timezone preference by
+// ExportLogs(), for everything else use the Config returned by UserConfig().
+// The warn-*
+// preferences enable or disable the warnings when logging, checkout
+// AddToDoseTableAt(), all of them are enabled by default. The weight, height,
+// age, sex and scale-per-kg preferences are the profile of the user,
+// checkout UserProfile. The default-route and default-units preferences are
+// used when logging without a route or units, checkout DefaultRouteUnits().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// errChannel - the gorouting channel which returns the errors
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to change the preference
+//
+// key - the name of the preference
+//
+// value - the new value, it's checked using the type of the preference
+func (cfg *Config) SetUserPref(db *sql.DB, ctx context.Context,
+	errChannel chan<- ErrorInfo, username string, key string, value string) ErrorInfo {
+	const printN string = "SetUserPref()"
+
+	tempErrInfo := ErrorInfo{
+		Err:      nil,
+		Username: username,
+		Action:   ActionSetUserPref,
+	}
+
+	err, value := validateUserPref(key, value)
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%s: %w", sprintName(printN), "db.BeginTx()", err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	err, before := userPrefTx(ctx, tx, username, key)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
+	_, err = tx.Exec("delete from "+userPrefsTableName+" where username = ? and prefKey = ?",
+		username, key)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Exec(): ") {
+		return tempErrInfo
+	}
+
+	_, err = tx.Exec("insert into "+userPrefsTableName+" (username, prefKey, prefType, prefValue) "+
+		"values(?, ?, ?, ?)", username, key, userPrefDefs[key].valueType, value)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Exec(): ") {
+		return tempErrInfo
+	}
+
+	err = cfg.addAuditEntry(ctx, tx, ActionSetUserPref, username, nil, before,
+		UserPref{Key: key, Value: value, Type: userPrefDefs[key].valueType})
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
+	err = tx.Commit()
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
+		return tempErrInfo
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, key+": preference changed to:", value)
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+// UnsetUserPref removes a preference of a user, so that the fallback
+// value is used again, checkout SetUserPref().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// errChannel - the gorouting channel which returns the errors
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to remove the preference
+//
+// key - the name of the preference
+func (cfg *Config) UnsetUserPref(db *sql.DB, ctx context.Context,
+	errChannel chan<- ErrorInfo, username string, key string) ErrorInfo {
+	const printN string = "UnsetUserPref()"
+
+	tempErrInfo := ErrorInfo{
+		Err:      nil,
+		Username: username,
+		Action:   ActionUnsetUserPref,
+	}
+
+	if _, exists := userPrefDefs[key]; !exists {
+		tempErrInfo.Err = fmt.Errorf("%s%w: %q ; available: %s", sprintName(printN),
+			UnknownUserPrefError, key, strings.Join(UserPrefKeys(), ", "))
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%s: %w", sprintName(printN), "db.BeginTx()", err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	err, before := userPrefTx(ctx, tx, username, key)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
+	_, err = tx.Exec("delete from "+userPrefsTableName+
+		" where username = ? and prefKey = ?", username, key)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Exec(): ") {
+		return tempErrInfo
+	}
+
+	if before != nil {
+		err = cfg.addAuditEntry(ctx, tx, ActionUnsetUserPref, username, nil, before, nil)
+		if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+			return tempErrInfo
+		}
+	}
+
+	err = tx.Commit()
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
+		return tempErrInfo
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, key+": preference unset")
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+// GetUserPref returns a single preference of a user, if it isn't set,
+// the fallback value is returned, checkout SetUserPref().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// prefsErrChan - the goroutine channel which returns the preference
+// and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to get the preference
+//
+// key - the name of the preference
+func (cfg *Config) GetUserPref(db *sql.DB, ctx context.Context,
+	prefsErrChan chan<- UserPrefsError, username string, key string) UserPrefsError {
+	const printN string = "GetUserPref()"
+
+	tempPrefsErr := cfg.ListUserPrefs(db, ctx, nil, username)
+	if tempPrefsErr.Err != nil {
+		tempPrefsErr.Err = fmt.Errorf("%s%w", sprintName(printN), tempPrefsErr.Err)
+		if prefsErrChan != nil {
+			prefsErrChan <- tempPrefsErr
+		}
+		return tempPrefsErr
+	}
+
+	prefs := tempPrefsErr.Prefs
+	tempPrefsErr.Prefs = nil
+	for _, elem := range prefs {
+		if elem.Key == key {
+			tempPrefsErr.Prefs = []UserPref{elem}
+		}
+	}
+
+	if tempPrefsErr.Prefs == nil {
+		tempPrefsErr.Err = fmt.Errorf("%s%w: %q ; available: %s", sprintName(printN),
+			UnknownUserPrefError, key, strings.Join(UserPrefKeys(), ", "))
+	}
+
+	if prefsErrChan != nil {
+		prefsErrChan <- tempPrefsErr
+	}
+	return tempPrefsErr
+}
+
+// ListUserPrefs returns all preferences of a user sorted by key, the ones
+// which aren't set have the fallback value, checkout SetUserPref().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// prefsErrChan - the goroutine channel which returns the preferences
+// and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to get the preferences
+func (cfg *Config) ListUserPrefs(db *sql.DB, ctx context.Context,
+	prefsErrChan chan<- UserPrefsError, username string) UserPrefsError {
+	const printN string = "ListUserPrefs()"
+
+	tempPrefsErr := UserPrefsError{
+		Prefs:    nil,
+		Username: username,
+		Err:      nil,
+	}
+
+	err, prefs := cfg.getUserPrefs(db, ctx, username)
+	if err != nil {
+		tempPrefsErr.Err = fmt.Errorf("%s%w", sprintName(printN), err)
+		if prefsErrChan != nil {
+			prefsErrChan <- tempPrefsErr
+		}
+		return tempPrefsErr
+	}
+	tempPrefsErr.Prefs = prefs
+
+	if prefsErrChan != nil {
+		prefsErrChan <- tempPrefsErr
+	}
+	return tempPrefsErr
+}
+
+// DefaultRouteUnits returns the route and units, where the empty ones are
+// replaced using the default-route and default-units preferences of the user,
+// checkout SetUserPref(). If a preference isn't set, the value stays empty.
+// It's used by AddToDoseTableAt(), so there's no need to call it before
+// logging, only when the values are needed earlier.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// username - the user for which to use the preferences
+//
+// route - the route to use, if empty the default is returned
+//
+// units - the units to use, if empty the default is returned
+func (cfg *Config) DefaultRouteUnits(db *sql.DB, ctx context.Context,
+	username string, route string, units string) (string, string) {
+	if route != "" && units != "" {
+		return route, units
+	}
+
+	prefs := cfg.userPrefValues(db, ctx, username)
+	if route == "" {
+		route = prefs[PrefDefaultRoute]
+	}
+	if units == "" {
+		units = prefs[PrefDefaultUnits]
+	}
+
+	return route, units
+}
+
+// UserConfig returns a copy of the Config struct, with the values replaced
+// by the preferences of the user which are set, so that for example times
+// are printed in the timezone of the user. The original isn't changed.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// username - the user for which to use the preferences
+func (cfg *Config) UserConfig(db *sql.DB, ctx context.Context, username string) (error, Config) {
+	const printN string = "UserConfig()"
+
+	userCfg := *cfg
+
+	err, prefs := cfg.getUserPrefs(db, ctx, username)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), userCfg
+	}
+
+	for _, elem := range prefs {
+		if elem.IsDefault {
+			continue
+		}
+		switch elem.Key {
+		case PrefTimezone:
+			userCfg.Timezone = elem.Value
+		case PrefDefaultCurrency:
+			userCfg.CostCurrency = elem.Value
+		}
+	}
+
+	return nil, userCfg
+}
+
+var UnknownUserPrefError error = errors.New("unknown user preference")
+var InvalidUserPrefError error = errors.New("invalid value for user preference")
@@ -136,6 +136,13 @@ func (cfg *Config) SetUserSettings(db *sql.DB, ctx context.Context,
 		return tempErrInfo
 	}
 
+	var oldValue string
+	err = tx.QueryRowContext(ctx, "select "+set+" from "+userSetTableName+
+		" where username = ?", username).Scan(&oldValue)
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.QueryRowContext(): ") {
+		return tempErrInfo
+	}
+
 	stmt, err := tx.Prepare(stmtStr)
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Prepare(): ") {
 		return tempErrInfo
@@ -148,6 +155,12 @@ func (cfg *Config) SetUserSettings(db *sql.DB, ctx context.Context,
 		return tempErrInfo
 	}
 
+	err = cfg.addAuditEntry(ctx, tx, ActionSetUserSettings, username, nil,
+		map[string]string{set: oldValue}, map[string]string{set: setValue})
+	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "") {
+		return tempErrInfo
+	}
+
 	err = tx.Commit()
 	if handleErrRollback(err, tx, errChannel, &tempErrInfo, printN, "tx.Commit(): ") {
 		return tempErrInfo
@@ -252,7 +265,7 @@ func (cfg *Config) RememberDosing(db *sql.DB, ctx context.Context,
 			}
 			return tempErrInfo
 		}
-		forIDStr = strconv.FormatInt(gotLogs.UserLogs[0].StartTime, 10)
+		forIDStr = strconv.FormatInt(gotLogs.UserLogs[0].ID, 10)
 	}
 
 	gotErrInfo := cfg.SetUserSettings(db, ctx, nil, settingTypeID, username, forIDStr)
@@ -0,0 +1,341 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+// How often the blood alcohol concentration is calculated, in seconds.
+const bacStep int64 = 60
+
+type BACThreshold struct {
+	// In percent, the same as the concentration.
+	Limit float64
+	// The unix time when the concentration drops below the limit for the last
+	// time, the same as BACTimeline.At if it's already below and won't rise.
+	Below int64
+}
+
+// BACTimeline is the estimated blood alcohol concentration of the current
+// drinking episode. An episode starts with the first drink after being sober
+// and ends when the concentration is back at 0. All concentrations are
+// in percent (grams per 100 ml), checkout EstimateBAC().
+type BACTimeline struct {
+	// The unix time for which the timeline was calculated.
+	At      int64
+	Current float64
+	// The highest concentration of the episode, it can be after At if
+	// the alcohol is still being absorbed. Both are 0 if there's no episode.
+	Peak     float64
+	PeakTime int64
+	// The unix time when the concentration is expected to be 0, the same
+	// as At if it's already 0.
+	Sober      int64
+	Thresholds []BACThreshold
+	// The logs of the episode, from the oldest to the newest.
+	Logs    []UserLog
+	Profile UserProfile
+}
+
+type BACError struct {
+	BAC      *BACTimeline
+	Username string
+	Err      error
+}
+
+// Returns the largest time, which is before or the same as t and is
+// a whole amount of steps away from at.
+func alignToStep(t int64, at int64, step int64) int64 {
+	diff := t - at
+	steps := diff / step
+	if diff%step != 0 && diff < 0 {
+		steps--
+	}
+	return at + steps*step
+}
+
+// Returns the grams of alcohol absorbed from the log between from and to.
+// A log without an end time is absorbed at once when it starts.
+func absorbedGrams(userLog UserLog, from int64, to int64) float64 {
+	if userLog.EndTime <= userLog.StartTime {
+		if userLog.StartTime >= from && userLog.StartTime < to {
+			return float64(userLog.Dose)
+		}
+		return 0
+	}
+
+	start := userLog.StartTime
+	if from > start {
+		start = from
+	}
+	end := userLog.EndTime
+	if to < end {
+		end = to
+	}
+	if end <= start {
+		return 0
+	}
+
+	return float64(userLog.Dose) * float64(end-start) / float64(userLog.EndTime-userLog.StartTime)
+}
+
+// Calculates the timeline for the logs, which must all be alcohol in grams.
+// Logs which start after at are ignored. The concentration is calculated
+// every step seconds, the absorbed alcohol is added to it and the eliminated
+// alcohol is subtracted, it never drops below 0.
+func bacTimeline(profile UserProfile, userLogs []UserLog, at int64,
+	limits []float64, step int64) BACTimeline {
+	timeline := BACTimeline{
+		At:      at,
+		Sober:   at,
+		Profile: profile,
+	}
+	for _, limit := range limits {
+		timeline.Thresholds = append(timeline.Thresholds, BACThreshold{Limit: limit, Below: at})
+	}
+
+	var sorted []UserLog
+	for _, elem := range userLogs {
+		if elem.StartTime <= at {
+			sorted = append(sorted, elem)
+		}
+	}
+	if len(sorted) == 0 || profile.WeightKg <= 0 {
+		return timeline
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime < sorted[j].StartTime
+	})
+
+	// The concentration in percent from one gram of alcohol.
+	perGram := 100 / (WidmarkFactor(profile) * float64(profile.WeightKg) * 1000)
+	elimPerStep := alcoholEliminationPerHour * float64(step) / 3600
+
+	// The end times could be far in the future, then the concentration would
+	// be calculated for every step until then. So the absorption is only
+	// followed until all alcohol could've been eliminated after at.
+	var totalGrams float64
+	for _, elem := range sorted {
+		totalGrams += float64(elem.Dose)
+	}
+	maxAbsorbing := at + int64(totalGrams*perGram/alcoholEliminationPerHour*3600) + step
+
+	var bac float64
+	// Until when the alcohol of the added logs is being absorbed.
+	var absorbingUntil int64
+	var episode []UserLog
+	var peak float64
+	var peakTime int64
+	next := 0
+	t := alignToStep(sorted[0].StartTime, at, step)
+	for {
+		if bac == 0 && t >= absorbingUntil {
+			if t > at {
+				break
+			}
+			if next == len(sorted) {
+				t = at
+				break
+			}
+			// Sober, skip to the next drink, which starts a new episode.
+			if nextStart := alignToStep(sorted[next].StartTime, at, step); nextStart > t {
+				t = nextStart
+			}
+			episode = nil
+			peak = 0
+			peakTime = 0
+		}
+
+		for next < len(sorted) && sorted[next].StartTime < t+step {
+			episode = append(episode, sorted[next])
+			if sorted[next].EndTime > absorbingUntil {
+				absorbingUntil = sorted[next].EndTime
+			}
+			if sorted[next].StartTime > absorbingUntil {
+				absorbingUntil = sorted[next].StartTime
+			}
+			if absorbingUntil > maxAbsorbing {
+				absorbingUntil = maxAbsorbing
+			}
+			next++
+		}
+
+		if t == at {
+			timeline.Current = bac
+		}
+
+		var grams float64
+		for _, elem := range episode {
+			grams += absorbedGrams(elem, t, t+step)
+		}
+
+		prev := bac
+		bac += grams*perGram - elimPerStep
+		if bac < 0 {
+			bac = 0
+		}
+		t += step
+
+		if bac > peak {
+			peak = bac
+			peakTime = t
+		}
+
+		if t > at {
+			for i, elem := range timeline.Thresholds {
+				if prev >= elem.Limit && bac < elem.Limit {
+					timeline.Thresholds[i].Below = t
+				}
+			}
+		}
+	}
+
+	if timeline.Current == 0 && t == at && bac == 0 {
+		return timeline
+	}
+
+	timeline.Peak = peak
+	timeline.PeakTime = peakTime
+	timeline.Sober = t
+	timeline.Logs = episode
+	return timeline
+}
+
+// GetBAC estimates the blood alcohol concentration of a user, using all
+// alcohol logs in grams, checkout BACTimeline. The weight of the user must
+// be set, checkout UserProfile. The limits for BACTimeline.Thresholds are
+// set using BACLimits in the settings file. This is only a rough estimate,
+// never use it to decide if it's safe to drive!
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// bacErrChan - the goroutine channel which returns the timeline and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to estimate the concentration
+//
+// at - the unix time for which to estimate, if 0 the current time is used
+func (cfg *Config) GetBAC(db *sql.DB, ctx context.Context,
+	bacErrChan chan<- BACError, username string, at int64) BACError {
+	const printN string = "GetBAC()"
+
+	tempBACErr := BACError{
+		BAC:      nil,
+		Username: username,
+		Err:      nil,
+	}
+
+	if at == 0 {
+		at = time.Now().Unix()
+	}
+
+	gotProfileErr := cfg.GetUserProfile(db, ctx, nil, username)
+	if gotProfileErr.Err != nil {
+		tempBACErr.Err = fmt.Errorf("%s%w", sprintName(printN), gotProfileErr.Err)
+		if bacErrChan != nil {
+			bacErrChan <- tempBACErr
+		}
+		return tempBACErr
+	}
+
+	if gotProfileErr.Profile.WeightKg <= 0 {
+		tempBACErr.Err = fmt.Errorf("%s%w: %s", sprintName(printN), NoWeightError, username)
+		if bacErrChan != nil {
+			bacErrChan <- tempBACErr
+		}
+		return tempBACErr
+	}
+
+	gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, username, false, alcoholDrugName, LogDrugNameCol)
+	if gotLogs.Err != nil && !errors.Is(gotLogs.Err, NoLogsError) {
+		tempBACErr.Err = fmt.Errorf("%s%w", sprintName(printN), gotLogs.Err)
+		if bacErrChan != nil {
+			bacErrChan <- tempBACErr
+		}
+		return tempBACErr
+	}
+
+	var alcoholLogs []UserLog
+	for _, elem := range gotLogs.UserLogs {
+		if elem.DoseUnits != "g" {
+			printNameVerbose(cfg.VerbosePrinting, printN, "Skipping log:", elem.ID,
+				"; units aren't grams:", elem.DoseUnits)
+			continue
+		}
+		alcoholLogs = append(alcoholLogs, elem)
+	}
+
+	timeline := bacTimeline(*gotProfileErr.Profile, alcoholLogs, at, cfg.BACLimits, bacStep)
+	tempBACErr.BAC = &timeline
+
+	if bacErrChan != nil {
+		bacErrChan <- tempBACErr
+	}
+	return tempBACErr
+}
+
+// PrintBAC prints the timeline gotten using GetBAC().
+//
+// bacErr - the struct returned from GetBAC()
+//
+// prefix - if true, adds the function name to every print
+func (cfg *Config) PrintBAC(bacErr BACError, prefix bool) error {
+	var printN string
+	if prefix == true {
+		printN = "PrintBAC()"
+	} else {
+		printN = ""
+	}
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		err = fmt.Errorf("%s%w", sprintName(printN, "LoadLocation: "), err)
+		return err
+	}
+
+	timeline := bacErr.BAC
+	if timeline == nil {
+		return nil
+	}
+
+	printName(printN, "Warning: This is only a rough estimate, never use it to decide if it's safe to drive!")
+
+	if len(timeline.Logs) == 0 {
+		printName(printN, "Estimated BAC: 0% ; no alcohol is expected in the blood")
+		return nil
+	}
+
+	fmtTime := func(t int64) string {
+		str := time.Unix(t, 0).In(location).Format("2006-01-02 15:04")
+		if t > timeline.At {
+			str += " (in " + (time.Duration(t-timeline.At) * time.Second).Round(time.Minute).String() + ")"
+		}
+		return str
+	}
+
+	printNameF(printN, "Estimated BAC: %.3f%% ; Peak: %.3f%% at: %s\n",
+		timeline.Current, timeline.Peak, fmtTime(timeline.PeakTime))
+	printNameF(printN, "Back to 0%% at: %s\n", fmtTime(timeline.Sober))
+	for _, elem := range timeline.Thresholds {
+		if elem.Below <= timeline.At {
+			printNameF(printN, "Below %g%%: already\n", elem.Limit)
+		} else {
+			printNameF(printN, "Below %g%% at: %s\n", elem.Limit, fmtTime(elem.Below))
+		}
+	}
+	printNameF(printN, "Drinks: %d ; since: %s\n", len(timeline.Logs),
+		time.Unix(timeline.Logs[0].StartTime, 0).In(location).Format("2006-01-02 15:04"))
+
+	return nil
+}
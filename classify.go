@@ -0,0 +1,175 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+// DoseClass is how strong a dose is, compared to the ranges from the source.
+type DoseClass int
+
+const (
+	// The source has no ranges for the drug and route.
+	DoseClassUnknown DoseClass = iota
+	DoseClassBelowThreshold
+	DoseClassLight
+	DoseClassCommon
+	DoseClassStrong
+	// Above HighDoseMax
+	DoseClassHeavy
+)
+
+func (d DoseClass) String() string {
+	switch d {
+	case DoseClassUnknown:
+		return "unknown"
+	case DoseClassBelowThreshold:
+		return "below threshold"
+	case DoseClassLight:
+		return "light"
+	case DoseClassCommon:
+		return "common"
+	case DoseClassStrong:
+		return "strong"
+	case DoseClassHeavy:
+		return "heavy"
+	}
+	return fmt.Sprintf("DoseClass(%d)", int(d))
+}
+
+// ClassifyDose returns the class of a dose for the given info. The dose must
+// be in the same units as the info. If the source has no threshold,
+// LowDoseMin is used instead. Ranges which aren't set are skipped,
+// so for example a dose above LowDoseMax is common, even if the source
+// only has MediumDoseMax.
+//
+// info - the information for the drug and route of the dose
+//
+// dose - the amount to classify
+func ClassifyDose(info DrugInfo, dose float32) DoseClass {
+	threshold := info.Threshold
+	if threshold == 0 {
+		threshold = info.LowDoseMin
+	}
+
+	if info.HighDoseMax != 0 && dose > info.HighDoseMax {
+		return DoseClassHeavy
+	} else if info.HighDoseMin != 0 && dose >= info.HighDoseMin {
+		return DoseClassStrong
+	} else if info.MediumDoseMin != 0 && dose >= info.MediumDoseMin {
+		return DoseClassCommon
+	} else if threshold != 0 && dose >= threshold {
+		return DoseClassLight
+	} else if threshold != 0 {
+		return DoseClassBelowThreshold
+	}
+
+	return DoseClassUnknown
+}
+
+// Returns the info for the route of the drug from the local info table.
+// The drug and route must be the local names. If the user has enabled it,
+// the dose ranges are scaled using the weight, checkout ScaleDoseRanges().
+func (cfg *Config) getRouteInfo(db *sql.DB, ctx context.Context,
+	drug string, route string, username string) (error, DrugInfo) {
+	gotDrugInfoErr := cfg.GetLocalInfo(db, ctx, nil, drug, username)
+	if gotDrugInfoErr.Err != nil {
+		return gotDrugInfoErr.Err, DrugInfo{}
+	}
+
+	for _, elem := range gotDrugInfoErr.DrugI {
+		if elem.DrugRoute == route {
+			return nil, cfg.userDoseRanges(db, ctx, username, elem)
+		}
+	}
+
+	return LoggedRouteInfoError, DrugInfo{}
+}
+
+// Classifies a dose which already has the local names and converted units.
+func (cfg *Config) classifyLocalDose(db *sql.DB, ctx context.Context, username string,
+	drug string, route string, dose float32, units string) (error, DoseClass) {
+	err, info := cfg.getRouteInfo(db, ctx, drug, route, username)
+	if err != nil {
+		return err, DoseClassUnknown
+	}
+
+	if info.DoseUnits != units {
+		return fmt.Errorf("%w: %s ; info table units: %s",
+			LoggedUnitsInfoError, units, info.DoseUnits), DoseClassUnknown
+	}
+
+	return nil, ClassifyDose(info, dose)
+}
+
+// GetDoseClass returns the class of a dose, before it's logged, using the
+// same name replacements and conversions as AddToDoseTable(). This way
+// the user can be asked to confirm a heavy dose, before logging it.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// username - the user requesting the class
+//
+// drug - the name of the drug
+//
+// route - the route of administration
+//
+// dose - the amount
+//
+// units - the units of the amount
+//
+// perc - when not 0, the dose is converted first, checkout ConvertUnits()
+func (cfg *Config) GetDoseClass(db *sql.DB, ctx context.Context, username string,
+	drug string, route string, dose float32, units string, perc float32) (error, DoseClass) {
+	const printN string = "GetDoseClass()"
+
+	drug = cfg.MatchAndReplace(db, ctx, drug, NameTypeSubstance)
+	route = cfg.MatchAndReplace(db, ctx, route, NameTypeRoute)
+	units = cfg.MatchAndReplace(db, ctx, units, NameTypeUnits)
+
+	var err error
+	if perc != 0 {
+		err, dose, units = cfg.ConvertUnits(db, ctx, drug, dose, perc)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err), DoseClassUnknown
+		}
+	}
+
+	err, class := cfg.classifyLocalDose(db, ctx, username, drug, route, dose, units)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), DoseClassUnknown
+	}
+
+	return nil, class
+}
+
+// Returns the warning for a dose class, so that it can be added to
+// ErrorInfo.Warnings, nil is returned for an unknown class.
+func doseClassWarning(class DoseClass, drug string, route string, dose float32, units string) error {
+	if class == DoseClassUnknown {
+		return nil
+	}
+
+	useErr := DoseClassWarning
+	if class == DoseClassHeavy {
+		useErr = HeavyDoseWarning
+	} else if class == DoseClassBelowThreshold {
+		useErr = DoseBelowThresholdError
+	}
+
+	return fmt.Errorf("%w: %s ; drug: %q ; route: %q ; dose: %g %s",
+		useErr, class, drug, route, dose, units)
+}
+
+var DoseClassWarning error = errors.New("the class of the dose is")
+var HeavyDoseWarning error = errors.New("WARNING: the dose is above the strong range, " +
+	"the risk of negative effects is much higher, the class of the dose is")
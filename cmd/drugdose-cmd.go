@@ -1,10 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/psybits/gopsydose"
 )
@@ -53,6 +56,13 @@ var (
 		"The currency to be used for when logging a cost.\n"+
 			"This takes priority over the value set in the settings file.")
 
+	noConfirmHeavy = flag.Bool(
+		"no-confirm-heavy",
+		false,
+		"Don't ask before logging a dose above the strong range of the source.\n"+
+			"Without it, the dose is only logged after answering \"y\" in the terminal\n"+
+			"and it's not logged at all if the input isn't a terminal, for example in scripts.")
+
 	changeLog = flag.Bool(
 		"change-log",
 		false,
@@ -67,20 +77,28 @@ var (
 		"none",
 		"Change the end time of the last log.\n"+
 			"It accepts unix timestamps as input.\n"+
-			"If input is the string \"now\", it will use the current time\n"+
+			"If input is the string \"now\", it will use the current time.\n"+
+			"Times like \"30m ago\", \"21:15\", \"2006-01-02 15:04\" or RFC3339\n"+
+			"are also accepted, in the configured timezone.\n"+
 			"\n"+
 			"Must be used in combination with -change-log.\n"+
-			"If it's also combined with -for-id, it will change for a specific ID.")
+			"If it's also combined with -for-id, it will change for a specific ID.\n"+
+			"When logging a new dose instead, it sets its end time, for example:\n"+
+			"-drug ... -start-time \"30m ago\"")
 
 	startTime = flag.String(
 		"start-time",
 		"none",
 		"Change the start time of the last log.\n"+
 			"It accepts unix timestamps as input.\n"+
-			"If input is the string \"now\", it will use the current time\n"+
+			"If input is the string \"now\", it will use the current time.\n"+
+			"Times like \"30m ago\", \"21:15\", \"2006-01-02 15:04\" or RFC3339\n"+
+			"are also accepted, in the configured timezone.\n"+
 			"\n"+
 			"Must be used in combination with -change-log.\n"+
-			"If it's also combined with -for-id, it will change for a specific ID.")
+			"If it's also combined with -for-id, it will change for a specific ID.\n"+
+			"When logging a new dose instead, it sets its start time, for example:\n"+
+			"-drug ... -start-time \"30m ago\"")
 
 	forUser = flag.String(
 		"user",
@@ -118,10 +136,50 @@ var (
 		0,
 		"Clean a given number of oldest logs.")
 
+	undoLogChanges = flag.Int(
+		"undo",
+		0,
+		"Restore the logs from a given number of the last clean or change operations.")
+
+	purgeHistory = flag.Bool(
+		"purge-history",
+		false,
+		"Permanently remove the history of removed and changed logs, which is older\n"+
+			"than MaxHistoryAge in the settings file.")
+
+	getAudit = flag.Bool(
+		"get-audit",
+		false,
+		"Print the audit log of all changes made by the set user, newest first.\n"+
+			"Respects -no-get-limit like -get-logs.")
+
+	auditAction = flag.String(
+		"audit-action",
+		"none",
+		"Only print audit entries with this action,\n"+
+			"for example: \"removing logs from dose table completed\"")
+
+	auditFrom = flag.String(
+		"audit-from",
+		"none",
+		"Only print audit entries made after this time,\n"+
+			"the format is the same as -start-time.")
+
+	auditTo = flag.String(
+		"audit-to",
+		"none",
+		"Only print audit entries made before this time,\n"+
+			"the format is the same as -start-time.")
+
+	auditAllUsers = flag.Bool(
+		"audit-all-users",
+		false,
+		"Print the audit entries of all users, instead of only the set user.")
+
 	cleanDB = flag.Bool(
 		"clean-db",
 		false,
-		"Remove all tables from the database.\n"+
+		"Remove all tables from the database, including the audit log.\n"+
 			"Remember that it's for the currently set database path and driver.")
 
 	cleanLogs = flag.Bool(
@@ -157,7 +215,7 @@ var (
 	forID = flag.Int64(
 		"for-id",
 		0,
-		"Perform an action for a particular ID (start of dose timestamp).")
+		"Perform an action for a particular ID (shown with -get-logs).")
 
 	sourcecfg = flag.String(
 		"sourcecfg",
@@ -245,6 +303,33 @@ var (
 		"none",
 		"Remove all entries of a single drug from the local information table.")
 
+	updateInfoDrug = flag.String(
+		"update-info-drug",
+		"none",
+		"Fetch a drug from the source again and update the local information\n"+
+			"table, even if the drug is already present. Prints which routes\n"+
+			"were inserted, updated or unchanged and all changed values.")
+
+	loadLocalSource = flag.Bool(
+		"load-local-source",
+		false,
+		"Add all substances from the local files to the information table.\n"+
+			"UseSource in the settings file must be set to \""+drugdose.LocalFileName+"\"\n"+
+			"and the address in the sources file must be the path to the files.")
+
+	getStaleInfo = flag.Bool(
+		"get-stale-info",
+		false,
+		"Get all substances in the local information table, which are older\n"+
+			"than MaxInfoAge in the settings file.")
+
+	refreshStaleInfo = flag.Bool(
+		"refresh-stale-info",
+		false,
+		"Fetch again all substances in the local information table, which are older\n"+
+			"than MaxInfoAge in the settings file. If fetching fails, the old\n"+
+			"information is kept.")
+
 	getTimes = flag.Bool(
 		"get-times",
 		false,
@@ -252,6 +337,85 @@ var (
 			"Can be combined with -for-id to get times for a specific ID,\n"+
 			"relative to the current time.")
 
+	getTolerance = flag.Bool(
+		"get-tolerance",
+		false,
+		"Get the estimated tolerance to the drug set with -drug, using all\n"+
+			"previous doses and the decay periods from the tolerance config file.\n"+
+			"The tolerance is also shown when logging a dose.")
+
+	getSessions = flag.Bool(
+		"get-sessions",
+		false,
+		"Get all logs grouped into sessions, where every log of the same drug\n"+
+			"and route taken before the previous ones ended is a redose.\n"+
+			"Shows the total dose and its class for every session.\n"+
+			"Can be combined with -only-active.")
+
+	onlyActive = flag.Bool(
+		"only-active",
+		false,
+		"Combined with -get-sessions, shows only sessions which haven't ended.")
+
+	onlyPhase = flag.Bool(
+		"only-phase",
+		false,
+		"Combined with -get-times, prints only the current phase of the\n"+
+			"experience and until when it lasts, for example for a status bar.")
+
+	getActiveTimes = flag.Bool(
+		"get-active-times",
+		false,
+		"Get the times for all logs which haven't ended yet, for example\n"+
+			"when a few different substances were taken or after redosing.")
+
+	exportLogs = flag.String(
+		"export",
+		"none",
+		"Export the logs for the set user to csv, json or ndjson\n"+
+			"(newline-delimited JSON), for example: -export csv\n"+
+			"Can be combined with -search, -search-exact, -export-from,\n"+
+			"-export-to and -export-file.")
+
+	exportFile = flag.String(
+		"export-file",
+		"",
+		"The file to write the exported logs to, combined with -export.\n"+
+			"If empty, the logs are written to the terminal.")
+
+	exportFrom = flag.Int64(
+		"export-from",
+		0,
+		"Export only logs started at or after this unix timestamp,\n"+
+			"combined with -export.")
+
+	exportTo = flag.Int64(
+		"export-to",
+		0,
+		"Export only logs started at or before this unix timestamp,\n"+
+			"combined with -export.")
+
+	importLogs = flag.String(
+		"import",
+		"",
+		"Import logs for the set user from a csv, json or ndjson file,\n"+
+			"the format is chosen using the file extension (.csv, .json,\n"+
+			".ndjson or .jsonl). The layout is the same as when using -export.\n"+
+			"Every log must have a start time, either as StartTime (unix timestamp)\n"+
+			"or Start (RFC3339), same for the optional end time.\n"+
+			"Invalid logs are skipped, unless -import-all-or-nothing is used.")
+
+	importDryRun = flag.Bool(
+		"import-dry-run",
+		false,
+		"Only check the logs which would be imported using -import,\n"+
+			"without changing anything.")
+
+	importAllOrNothing = flag.Bool(
+		"import-all-or-nothing",
+		false,
+		"Don't import anything using -import if even one log is invalid.")
+
 	getUsers = flag.Bool(
 		"get-users",
 		false,
@@ -267,6 +431,26 @@ var (
 		false,
 		"Stops the program once the config files have been initialised.")
 
+	migrateDryRun = flag.Bool(
+		"migrate-dry-run",
+		false,
+		"Print the SQL statements of all database migrations, which would be ran\n"+
+			"on the next start, without changing anything and exit.")
+
+	encryptDB = flag.Bool(
+		"encrypt-db",
+		false,
+		"Encrypt the existing sqlite database using the passphrase from\n"+
+			"the "+passphraseEnv+" environment variable and exit.\n"+
+			"Afterwards set Encrypt to true for sqlite in the settings file.")
+
+	rotatePassphrase = flag.Bool(
+		"rotate-passphrase",
+		false,
+		"Change the passphrase of the encrypted sqlite database from\n"+
+			"the one in "+passphraseEnv+" to the one in "+newPassphraseEnv+"\n"+
+			"and exit.")
+
 	stopOnDbInit = flag.Bool(
 		"stop-on-db-init",
 		false,
@@ -290,6 +474,92 @@ var (
 		false,
 		"Forget the remembered -drug -units and -route.")
 
+	setWeight = flag.String(
+		"set-weight",
+		"none",
+		"Set the weight of the user in kg, used for estimating the blood\n"+
+			"alcohol concentration and for -set-scale-per-kg. 0 unsets it.")
+
+	setHeight = flag.String(
+		"set-height",
+		"none",
+		"Set the height of the user in cm, makes the blood alcohol\n"+
+			"concentration more accurate. 0 unsets it.")
+
+	setAge = flag.String(
+		"set-age",
+		"none",
+		"Set the age of the user in years, makes the blood alcohol\n"+
+			"concentration more accurate for men. 0 unsets it.")
+
+	setSex = flag.String(
+		"set-sex",
+		"none",
+		"Set the sex of the user, \"male\" or \"female\", used for estimating\n"+
+			"the blood alcohol concentration. An empty string unsets it.")
+
+	setScalePerKg = flag.String(
+		"set-scale-per-kg",
+		"none",
+		"If \"true\", the dose ranges from the source are scaled using the weight\n"+
+			"of the user, compared to 70 kg, when classifying doses.")
+
+	getProfile = flag.Bool(
+		"get-profile",
+		false,
+		"Get the profile of the user, set using the -set-* flags.")
+
+	getBAC = flag.Bool(
+		"get-bac",
+		false,
+		"Estimate the blood alcohol concentration using all alcohol logs in grams\n"+
+			"since the user was last sober. The weight of the user must be set.")
+
+	setPref = flag.String(
+		"set-pref",
+		"none",
+		"Set a preference of the user in the form key=value, for example:\n"+
+			"timezone=Europe/Paris. Checkout -list-prefs for all keys.")
+
+	unsetPref = flag.String(
+		"unset-pref",
+		"none",
+		"Unset a preference of the user, so that the value from the settings file\n"+
+			"or the default is used again.")
+
+	getPref = flag.String(
+		"get-pref",
+		"none",
+		"Get a single preference of the user.")
+
+	listPrefs = flag.Bool(
+		"list-prefs",
+		false,
+		"List all preferences of the user, the ones which aren't set show\n"+
+			"the value which is used instead.")
+
+	usePreset = flag.String(
+		"preset",
+		"none",
+		"Log using a dosing preset of the user, only -dose is needed.\n"+
+			"Other flags like -route take priority over the preset.")
+
+	savePreset = flag.String(
+		"save-preset",
+		"none",
+		"Save a dosing preset with this name, using -drug, -route, -units,\n"+
+			"-perc, -cost and -cost-cur. If -dose isn't set, nothing is logged.")
+
+	listPresets = flag.Bool(
+		"list-presets",
+		false,
+		"List all dosing presets of the user.")
+
+	removePreset = flag.String(
+		"remove-preset",
+		"none",
+		"Remove the dosing preset with this name.")
+
 	getDBDriver = flag.Bool(
 		"get-db-driver",
 		false,
@@ -320,6 +590,12 @@ var (
 			"string is contained, but if it's exactly the same.")
 )
 
+// The environment variables from which the passphrases for
+// the encrypted database are taken, so that they don't end up in the
+// shell history.
+const passphraseEnv string = "GPDPASSPHRASE"
+const newPassphraseEnv string = "GPDNEWPASSPHRASE"
+
 // Print strings properly formatted for the Command Line Interface (CLI) program.
 // This is so that when using the CLI program, the user can better understand
 // where a string is coming from.
@@ -342,6 +618,34 @@ func printErrInfo(errInfo drugdose.ErrorInfo) {
 	} else if errInfo.Action != "" {
 		printCLI(errInfo.Action)
 	}
+	if errInfo.Err == nil {
+		for _, warn := range errInfo.Warnings {
+			printCLI(warn)
+		}
+	}
+}
+
+// Returns true if the standard input is a terminal, so that the user
+// can be asked questions.
+func stdinIsTerminal() bool {
+	stat, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Asks the user a yes or no question in the terminal, anything other than
+// "y" or "yes" is a no, including when nothing can be read.
+func askConfirm(question string) bool {
+	printCLI(question, "[y/N]")
+	reader := bufio.NewReader(os.Stdin)
+	answer, err := reader.ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
 func main() {
@@ -369,6 +673,37 @@ func main() {
 	}
 	defer ctx_cancel()
 
+	gotsetcfg.SetDBPassphrase(os.Getenv(passphraseEnv))
+
+	if *encryptDB {
+		err = gotsetcfg.EncryptDB(os.Getenv(passphraseEnv))
+		if err != nil {
+			printCLI(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *rotatePassphrase {
+		err = gotsetcfg.RotateDBPassphrase(os.Getenv(passphraseEnv), os.Getenv(newPassphraseEnv))
+		if err != nil {
+			printCLI(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *migrateDryRun {
+		db := gotsetcfg.OpenDBConnection(ctx)
+		err = gotsetcfg.MigrateDB(db, ctx, true)
+		db.Close()
+		if err != nil {
+			printCLI(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	gotsetcfg.InitAllDB(ctx)
 
 	if *stopOnDbInit {
@@ -445,7 +780,7 @@ func main() {
 	}
 
 	if *cleanInfo {
-		err := gotsetcfg.CleanInfoTable(db, ctx)
+		err := gotsetcfg.CleanInfoTable(db, ctx, *forUser)
 		if err != nil {
 			printCLI(err)
 			os.Exit(1)
@@ -477,6 +812,172 @@ func main() {
 		}
 	}
 
+	profilePrefs := []struct {
+		key   string
+		value string
+	}{
+		{drugdose.PrefWeight, *setWeight},
+		{drugdose.PrefHeight, *setHeight},
+		{drugdose.PrefAge, *setAge},
+		{drugdose.PrefSex, *setSex},
+		{drugdose.PrefScalePerKg, *setScalePerKg},
+	}
+	for _, elem := range profilePrefs {
+		if elem.value == "none" {
+			continue
+		}
+		var gotErrInfo drugdose.ErrorInfo
+		if elem.value == "0" || elem.value == "" {
+			gotErrInfo = gotsetcfg.UnsetUserPref(db, ctx, nil, *forUser, elem.key)
+		} else {
+			gotErrInfo = gotsetcfg.SetUserPref(db, ctx, nil, *forUser, elem.key, elem.value)
+		}
+		printErrInfo(gotErrInfo)
+	}
+
+	if *getProfile {
+		gotProfileErr := gotsetcfg.GetUserProfile(db, ctx, nil, *forUser)
+		if gotProfileErr.Err != nil {
+			printCLI("Couldn't get the profile because of an error:", gotProfileErr.Err)
+			os.Exit(1)
+		}
+		profile := gotProfileErr.Profile
+		printCLI(fmt.Sprintf("Weight: %g kg ; Height: %g cm ; Age: %d ; Sex: %q ; Scale per kg: %t",
+			profile.WeightKg, profile.HeightCm, profile.Age, profile.Sex, profile.ScalePerKg))
+	}
+
+	if *setPref != "none" {
+		key, value, found := strings.Cut(*setPref, "=")
+		if !found {
+			printCLI("The preference must be in the form key=value, for example: timezone=Europe/Paris")
+			os.Exit(1)
+		}
+		gotErrInfo := gotsetcfg.SetUserPref(db, ctx, nil, *forUser, key, value)
+		printErrInfo(gotErrInfo)
+	}
+
+	if *unsetPref != "none" {
+		gotErrInfo := gotsetcfg.UnsetUserPref(db, ctx, nil, *forUser, *unsetPref)
+		printErrInfo(gotErrInfo)
+	}
+
+	if *getPref != "none" || *listPrefs {
+		var gotPrefsErr drugdose.UserPrefsError
+		if *listPrefs {
+			gotPrefsErr = gotsetcfg.ListUserPrefs(db, ctx, nil, *forUser)
+		} else {
+			gotPrefsErr = gotsetcfg.GetUserPref(db, ctx, nil, *forUser, *getPref)
+		}
+		if gotPrefsErr.Err != nil {
+			printCLI("Couldn't get the preferences because of an error:", gotPrefsErr.Err)
+			os.Exit(1)
+		}
+		for _, elem := range gotPrefsErr.Prefs {
+			isDefault := ""
+			if elem.IsDefault {
+				isDefault = " ; not set"
+			}
+			printCLI(fmt.Sprintf("%s: %q ; type: %s%s", elem.Key, elem.Value, elem.Type, isDefault))
+		}
+	}
+
+	err, gotsetcfg = gotsetcfg.UserConfig(db, ctx, *forUser)
+	if err != nil {
+		printCLI("Couldn't use the preferences of the user because of an error:", err)
+	}
+
+	if *savePreset != "none" {
+		preset := drugdose.DosingPreset{
+			Name:         *savePreset,
+			Username:     *forUser,
+			DrugName:     *drugname,
+			DrugRoute:    *drugroute,
+			DoseUnits:    *drugunits,
+			Perc:         float32(*drugperc),
+			Cost:         float32(*drugcost),
+			CostCurrency: *costCur,
+		}
+		for _, elem := range []*string{&preset.DrugName, &preset.DrugRoute, &preset.DoseUnits} {
+			if *elem == "none" {
+				*elem = ""
+			}
+		}
+		gotErrInfo := gotsetcfg.AddDosingPreset(db, ctx, nil, preset)
+		printErrInfo(gotErrInfo)
+		if gotErrInfo.Err != nil {
+			os.Exit(1)
+		}
+		if *drugargdose == 0 {
+			os.Exit(0)
+		}
+	}
+
+	if *removePreset != "none" {
+		gotErrInfo := gotsetcfg.RemoveDosingPreset(db, ctx, nil, *forUser, *removePreset)
+		printErrInfo(gotErrInfo)
+	}
+
+	if *listPresets {
+		gotPresetsErr := gotsetcfg.GetDosingPresets(db, ctx, nil, *forUser, "")
+		if gotPresetsErr.Err != nil {
+			printCLI("Couldn't get the presets because of an error:", gotPresetsErr.Err)
+			os.Exit(1)
+		}
+		if len(gotPresetsErr.Presets) == 0 {
+			printCLI("No presets for user:", *forUser)
+		}
+		for _, elem := range gotPresetsErr.Presets {
+			printCLI(fmt.Sprintf("Preset: %q ; Drug: %q ; Route: %q ; Units: %q ; "+
+				"Perc: %g ; Cost: %g ; Currency: %q", elem.Name, elem.DrugName, elem.DrugRoute,
+				elem.DoseUnits, elem.Perc, elem.Cost, elem.CostCurrency))
+		}
+	}
+
+	if *usePreset != "none" && *savePreset == "none" {
+		gotPresetsErr := gotsetcfg.GetDosingPresets(db, ctx, nil, *forUser, *usePreset)
+		if gotPresetsErr.Err != nil {
+			printCLI("Couldn't use the preset because of an error:", gotPresetsErr.Err)
+			os.Exit(1)
+		}
+		preset := gotPresetsErr.Presets[0]
+		printCLI("Using preset:", preset.Name)
+		if *drugname == "none" {
+			*drugname = preset.DrugName
+		}
+		if *drugroute == "none" {
+			*drugroute = preset.DrugRoute
+		}
+		if *drugunits == "none" {
+			*drugunits = preset.DoseUnits
+		}
+		if *drugperc == 0 {
+			*drugperc = float64(preset.Perc)
+		}
+		if *drugcost == 0 {
+			*drugcost = float64(preset.Cost)
+		}
+		if *costCur == "" {
+			*costCur = preset.CostCurrency
+		}
+	}
+
+	if *changeLog == false && *drugname != "none" && (*drugroute == "none" || *drugunits == "none") {
+		route, units := *drugroute, *drugunits
+		if route == "none" {
+			route = ""
+		}
+		if units == "none" {
+			units = ""
+		}
+		route, units = gotsetcfg.DefaultRouteUnits(db, ctx, *forUser, route, units)
+		if route != "" {
+			*drugroute = route
+		}
+		if units != "" {
+			*drugunits = units
+		}
+	}
+
 	remembering := false
 	if *drugargdose != 0 && *drugname == "none" && *changeLog == false {
 		gotUserLogsErr := gotsetcfg.RecallDosing(db, ctx, nil, *forUser)
@@ -486,7 +987,7 @@ func main() {
 			os.Exit(1)
 		} else if gotUserLogsErr.UserLogs != nil {
 			remCfg := gotUserLogsErr.UserLogs[0]
-			printCLI("Remembering from config using ID:", remCfg.StartTime)
+			printCLI("Remembering from config using ID:", remCfg.ID)
 			*forUser = remCfg.Username
 			*drugname = remCfg.DrugName
 			*drugroute = remCfg.DrugRoute
@@ -500,6 +1001,49 @@ func main() {
 		printErrInfo(tempErrInfo)
 	}
 
+	if *updateInfoDrug != "none" {
+		err, src := gotsetcfg.InitSource()
+		if err != nil {
+			printCLI(err)
+			os.Exit(1)
+		}
+
+		gotInfoDiffErr := gotsetcfg.UpdateFromSource(db, ctx, nil, *updateInfoDrug, *forUser, src)
+		if gotInfoDiffErr.Err != nil {
+			printCLI(gotInfoDiffErr.Err)
+		} else {
+			gotsetcfg.PrintInfoDiff(gotInfoDiffErr.InfoDiff, false)
+		}
+	}
+
+	if *loadLocalSource {
+		err, src := gotsetcfg.InitSource()
+		if err != nil {
+			printCLI(err)
+			os.Exit(1)
+		}
+
+		localSrc, ok := src.(*drugdose.LocalFileSource)
+		if !ok {
+			printCLI("The configured source isn't:", drugdose.LocalFileName, "; got:", gotsetcfg.UseSource)
+			os.Exit(1)
+		}
+
+		tempErrInfo := gotsetcfg.LoadLocalFileSource(db, ctx, nil, localSrc, *forUser)
+		printErrInfo(tempErrInfo)
+	}
+
+	if *refreshStaleInfo {
+		err, src := gotsetcfg.InitSource()
+		if err != nil {
+			printCLI(err)
+			os.Exit(1)
+		}
+
+		tempErrInfo := gotsetcfg.RefreshStaleInfo(db, ctx, nil, *forUser, src)
+		printErrInfo(tempErrInfo)
+	}
+
 	remAmount := 0
 	revRem := false
 	if *removeOld != 0 {
@@ -517,6 +1061,16 @@ func main() {
 		printErrInfo(tempErrInfo)
 	}
 
+	if *undoLogChanges > 0 {
+		tempErrInfo := gotsetcfg.UndoLogChanges(db, ctx, nil, *forUser, *undoLogChanges)
+		printErrInfo(tempErrInfo)
+	}
+
+	if *purgeHistory {
+		tempErrInfo := gotsetcfg.PurgeLogHistory(db, ctx, nil, *forUser)
+		printErrInfo(tempErrInfo)
+	}
+
 	inputDose := false
 	if *changeLog == false && remembering == false && *getLogs == false &&
 		*dontLog == false && *searchExact == false {
@@ -555,22 +1109,58 @@ func main() {
 	}
 
 	if inputDose == true || *dontLog == true && *drugname != "none" {
-		err, cli := gotsetcfg.InitGraphqlClient()
 		fetchErr := false
-		if err == nil {
-			gotErrInfo := gotsetcfg.FetchFromSource(db, ctx, nil, *drugname, *forUser, cli)
-			if gotErrInfo.Err != nil {
-				fetchErr = true
-				printCLI(gotErrInfo.Err)
+		if gotsetcfg.AutoFetch {
+			err, src := gotsetcfg.InitSource()
+			if err == nil {
+				gotErrInfo := gotsetcfg.FetchFromSource(db, ctx, nil, *drugname, *forUser, src)
+				if gotErrInfo.Err != nil {
+					fetchErr = true
+					printCLI(gotErrInfo.Err)
+				}
+			} else {
+				printCLI(err)
 			}
-		} else {
-			printCLI(err)
 		}
 
 		if *dontLog == false && fetchErr == false {
-			errInfo := gotsetcfg.AddToDoseTable(db, ctx, nil, nil, *forUser, *drugname, *drugroute,
+			var logStart, logEnd int64
+			if *startTime != "none" {
+				err, logStart = gotsetcfg.ParseTimeInput(*startTime)
+				if err != nil {
+					printCLI(err)
+					os.Exit(1)
+				}
+			}
+			if *endTime != "none" {
+				err, logEnd = gotsetcfg.ParseTimeInput(*endTime)
+				if err != nil {
+					printCLI(err)
+					os.Exit(1)
+				}
+			}
+
+			if *noConfirmHeavy == false {
+				err, class := gotsetcfg.GetDoseClass(db, ctx, *forUser, *drugname, *drugroute,
+					float32(*drugargdose), *drugunits, float32(*drugperc))
+				if err == nil && class == drugdose.DoseClassHeavy {
+					printCLI("!!! WARNING: this is a HEAVY dose, above the strong range of the source !!!")
+					printCLI("!!! The risk of negative effects, including overdose, is much higher !!!")
+					if stdinIsTerminal() == false {
+						printCLI("Can't ask for confirmation, the input isn't a terminal. " +
+							"Not logged, add -no-confirm-heavy to log it anyway.")
+						os.Exit(1)
+					}
+					if askConfirm("Are you sure you want to log it?") == false {
+						printCLI("Not logged.")
+						os.Exit(1)
+					}
+				}
+			}
+
+			errInfo := gotsetcfg.AddToDoseTableAt(db, ctx, nil, nil, *forUser, *drugname, *drugroute,
 				float32(*drugargdose), *drugunits, float32(*drugperc),
-				float32(*drugcost), *costCur, true)
+				float32(*drugcost), *costCur, logStart, logEnd, true)
 			printErrInfo(errInfo)
 		} else if *dontLog == true {
 			err, convOutput, convUnit := gotsetcfg.ConvertUnits(db, ctx, *drugname,
@@ -597,6 +1187,30 @@ func main() {
 		printErrInfo(errInfo)
 	}
 
+	if *importLogs != "" {
+		format := drugdose.ImportFormatFromPath(*importLogs)
+		input, err := os.Open(*importLogs)
+		if err != nil {
+			printCLI(err)
+			os.Exit(1)
+		}
+
+		err, rows := gotsetcfg.ReadImportLogs(input, format)
+		input.Close()
+		if err != nil {
+			printCLI(err)
+			os.Exit(1)
+		}
+
+		importErr := gotsetcfg.ImportLogs(db, ctx, nil, rows, *forUser,
+			*importDryRun, *importAllOrNothing)
+		gotsetcfg.PrintImportLogs(importErr, *importDryRun, false)
+		if importErr.Err != nil {
+			printCLI(importErr.Err)
+			os.Exit(1)
+		}
+	}
+
 	// All functions which modify data have finished.
 
 	var gettingLogs bool = false
@@ -623,6 +1237,48 @@ func main() {
 		gettingLogs = true
 	}
 
+	if *getAudit {
+		filter := drugdose.AuditFilter{
+			Username: *forUser,
+		}
+		if *auditAllUsers {
+			filter.Username = ""
+		}
+		if *auditAction != "none" {
+			filter.Action = *auditAction
+		}
+		if *auditFrom != "none" {
+			err, filter.From = gotsetcfg.ParseTimeInput(*auditFrom)
+			if err != nil {
+				printCLI(err)
+				os.Exit(1)
+			}
+		}
+		if *auditTo != "none" {
+			err, filter.To = gotsetcfg.ParseTimeInput(*auditTo)
+			if err != nil {
+				printCLI(err)
+				os.Exit(1)
+			}
+		}
+		if !*noGetLimit {
+			filter.Limit = 100
+		}
+
+		gotAuditErr := gotsetcfg.GetAuditLog(db, ctx, nil, filter)
+		if gotAuditErr.Err != nil {
+			printCLI("Couldn't get the audit log because of an error:", gotAuditErr.Err)
+			os.Exit(1)
+		}
+		if len(gotAuditErr.Entries) == 0 {
+			printCLI("No audit entries found.")
+		}
+		err = gotsetcfg.PrintAuditLog(gotAuditErr.Entries, false)
+		if err != nil {
+			printCLI(err)
+		}
+	}
+
 	if gettingLogs == true {
 		retLogs := gotUserLogsErr.UserLogs
 		gotErr := gotUserLogsErr.Err
@@ -641,6 +1297,33 @@ func main() {
 		}
 	}
 
+	if *exportLogs != "none" {
+		output := os.Stdout
+		if *exportFile != "" {
+			output, err = os.OpenFile(*exportFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				printCLI(err)
+				os.Exit(1)
+			}
+		}
+
+		errInfo := gotsetcfg.ExportLogs(db, ctx, nil, output, *exportLogs, *forUser,
+			*exportFrom, *exportTo, *searchStr, getExact)
+		if *exportFile != "" {
+			err = output.Close()
+			if err != nil && errInfo.Err == nil {
+				errInfo.Err = err
+			}
+			printErrInfo(errInfo)
+		} else if errInfo.Err != nil {
+			// Don't mix anything else with the exported logs.
+			printCLI(errInfo.Err)
+		}
+		if errInfo.Err != nil {
+			os.Exit(1)
+		}
+	}
+
 	if *getLogsCount {
 		gotLogCountErr := gotsetcfg.GetLogsCount(db, ctx, *forUser, nil)
 		err := gotLogCountErr.Err
@@ -668,7 +1351,11 @@ func main() {
 			printCLI("Times couldn't be retrieved because of an error:", err)
 			os.Exit(1)
 		} else {
-			err = gotsetcfg.PrintTimeTill(gotTimeTillErr, false)
+			if *onlyPhase {
+				err = gotsetcfg.PrintPhase(gotTimeTillErr, false)
+			} else {
+				err = gotsetcfg.PrintTimeTill(gotTimeTillErr, false)
+			}
 			if err != nil {
 				printCLI("Couldn't print times because of an error:", err)
 				os.Exit(1)
@@ -676,6 +1363,75 @@ func main() {
 		}
 	}
 
+	if *getActiveTimes {
+		gotActiveTimesErr := gotsetcfg.GetActiveTimes(db, ctx, nil, *forUser)
+		err := gotActiveTimesErr.Err
+		if err != nil {
+			printCLI("Active times couldn't be retrieved because of an error:", err)
+			os.Exit(1)
+		} else {
+			err = gotsetcfg.PrintActiveTimes(gotActiveTimesErr, false)
+			if err != nil {
+				printCLI("Couldn't print active times because of an error:", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if *getBAC {
+		gotBACErr := gotsetcfg.GetBAC(db, ctx, nil, *forUser, 0)
+		err := gotBACErr.Err
+		if err != nil {
+			printCLI("Blood alcohol concentration couldn't be estimated because of an error:", err)
+			os.Exit(1)
+		} else {
+			err = gotsetcfg.PrintBAC(gotBACErr, false)
+			if err != nil {
+				printCLI("Couldn't print blood alcohol concentration because of an error:", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if *getTolerance {
+		gotToleranceErr := gotsetcfg.GetTolerance(db, ctx, nil, *forUser, *drugname, 0)
+		err := gotToleranceErr.Err
+		if err != nil {
+			printCLI("Tolerance couldn't be estimated because of an error:", err)
+			os.Exit(1)
+		}
+
+		location, err := time.LoadLocation(gotsetcfg.Timezone)
+		if err != nil {
+			printCLI(err)
+			os.Exit(1)
+		}
+
+		tol := gotToleranceErr.Tol
+		if tol.Percent == 0 {
+			printCLI(fmt.Sprintf("No tolerance to: %q", tol.DrugName))
+		} else {
+			printCLI(fmt.Sprintf("Tolerance to: %q ; %d%% ; from log: %d ; back to baseline at: %q",
+				tol.DrugName, int(tol.Percent), tol.FromLog.ID,
+				time.Unix(tol.Baseline, 0).In(location).Format("2006-01-02 15:04")))
+		}
+	}
+
+	if *getSessions {
+		gotSessionsErr := gotsetcfg.GetDoseSessions(db, ctx, nil, *forUser, *onlyActive)
+		err := gotSessionsErr.Err
+		if err != nil {
+			printCLI("Sessions couldn't be retrieved because of an error:", err)
+			os.Exit(1)
+		} else {
+			err = gotsetcfg.PrintDoseSessions(gotSessionsErr, false)
+			if err != nil {
+				printCLI("Couldn't print sessions because of an error:", err)
+				os.Exit(1)
+			}
+		}
+	}
+
 	if *getUsers {
 		gotAllUsersErr := gotsetcfg.GetUsers(db, ctx, nil, *forUser)
 		err = gotAllUsersErr.Err
@@ -725,6 +1481,15 @@ func main() {
 	getUniqueNames := false
 	getInfoNames := false
 	useCol := ""
+	if *getStaleInfo {
+		gotStaleErr := gotsetcfg.GetStaleInfo(db, ctx, nil, *forUser)
+		if gotStaleErr.Err != nil {
+			printCLI(gotStaleErr.Err)
+			os.Exit(1)
+		}
+		gotsetcfg.PrintStaleInfo(gotStaleErr.StaleInfo, false)
+	}
+
 	if *getLocalInfoDrugs {
 		getUniqueNames = true
 		getInfoNames = true
@@ -0,0 +1,307 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+const crossToleranceFilename string = "gpd-cross-tolerance.toml"
+const crossToleranceTableName string = "crossToleranceGroups"
+
+// CrossToleranceGroup is a group of substances which share tolerance,
+// so taking one of them causes tolerance to all others.
+type CrossToleranceGroup struct {
+	// The local names of the substances, the same as in the logs.
+	Substances []string
+	// For how many days after a dose there's still tolerance to the others.
+	WindowDays float32
+}
+
+// CrossToleranceConfig is the layout of the cross-tolerance config file,
+// for example:
+//
+//	[Group.Psychedelics]
+//	Substances = ["LSD", "Psilocybin mushrooms", "Mescaline"]
+//	WindowDays = 14
+//
+// Underscores in the group names are replaced with spaces.
+type CrossToleranceConfig struct {
+	Group map[string]CrossToleranceGroup
+}
+
+type CrossTolerance struct {
+	GroupName string
+	// The substance for which the cross-tolerance is checked.
+	DrugName string
+	// The newest log of another substance from the group.
+	FromLog    UserLog
+	WindowDays float32
+	// How many days are left until the window ends.
+	DaysLeft float32
+}
+
+type CrossToleranceError struct {
+	CrossTols []CrossTolerance
+	Username  string
+	Err       error
+}
+
+// GetCrossToleranceConfig reads the cross-tolerance config file, the same way
+// as GetToleranceConfig(), first the source specific one and if it doesn't
+// exist, the global one.
+//
+// source - the source for which to read the config
+func GetCrossToleranceConfig(source string) (error, *CrossToleranceConfig) {
+	const printN string = "GetCrossToleranceConfig()"
+
+	err, file := readSourceOrGlobalConfig(crossToleranceFilename, source)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	crossCfg := CrossToleranceConfig{}
+	err = toml.Unmarshal(file, &crossCfg)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "toml.Unmarshal(): "), err), nil
+	}
+
+	return nil, &crossCfg
+}
+
+// Adds the groups to the table, together with the magic word, so that
+// the table isn't filled again.
+func (cfg *Config) addCrossToleranceGroups(db *sql.DB, ctx context.Context,
+	crossCfg *CrossToleranceConfig) error {
+	const printN string = "addCrossToleranceGroups()"
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	groupStmt, err := tx.Prepare("insert into " + crossToleranceTableName +
+		" (groupName, drugName, windowDays) " +
+		"values(?, ?, ?)")
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Prepare(): ")
+	if err != nil {
+		return err
+	}
+	defer groupStmt.Close()
+
+	_, err = tx.Stmt(groupStmt).Exec(namesMagicWord, namesMagicWord, 0)
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Stmt.Exec(): ")
+	if err != nil {
+		return err
+	}
+
+	for groupName, group := range crossCfg.Group {
+		groupName = strings.ReplaceAll(groupName, "_", " ")
+		if group.WindowDays <= 0 {
+			printName(printN, "Skipping group:", groupName, "; WindowDays must be bigger than 0")
+			continue
+		}
+
+		for _, drug := range group.Substances {
+			_, err = tx.Stmt(groupStmt).Exec(groupName, drug, group.WindowDays)
+			err = handleErrRollbackSeq(err, tx, printN, "tx.Stmt.Exec(): ")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = tx.Commit()
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddToCrossToleranceTable fills the cross-tolerance groups table using
+// the config file, checkout GetCrossToleranceConfig(). Like the names,
+// this is done only once, to reflect changes in the config file, the table
+// must be removed, checkout CleanNamesTables().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+func (cfg *Config) AddToCrossToleranceTable(db *sql.DB, ctx context.Context) error {
+	const printN string = "AddToCrossToleranceTable()"
+
+	ret := checkIfExistsDB(db, ctx,
+		"groupName",
+		crossToleranceTableName,
+		cfg.DBDriver,
+		cfg.DBSettings[cfg.DBDriver].Path,
+		nil,
+		namesMagicWord)
+	if ret {
+		return nil
+	}
+
+	err, crossCfg := GetCrossToleranceConfig(cfg.UseSource)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = cfg.addCrossToleranceGroups(db, ctx, crossCfg)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	printName(printN, "Cross-tolerance groups initialized successfully!")
+
+	return nil
+}
+
+// GetCrossTolerance returns for every group of the substance, every other
+// substance from the group, which was logged within the window of the group,
+// using the newest log of it. The tolerance to the same substance isn't
+// checked here, for that checkout GetTolerance().
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// crossErrChan - the goroutine channel which returns the cross-tolerances
+// and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to check the logs
+//
+// drug - the substance for which to check the cross-tolerance
+//
+// at - the unix time for which to check, only logs before it are used,
+// if 0 the current time is used
+func (cfg *Config) GetCrossTolerance(db *sql.DB, ctx context.Context,
+	crossErrChan chan<- CrossToleranceError, username string, drug string, at int64) CrossToleranceError {
+	const printN string = "GetCrossTolerance()"
+
+	tempCrossErr := CrossToleranceError{
+		CrossTols: nil,
+		Username:  username,
+		Err:       nil,
+	}
+
+	if at == 0 {
+		at = time.Now().Unix()
+	}
+
+	drug = cfg.MatchAndReplace(db, ctx, drug, NameTypeSubstance)
+
+	rows, err := db.QueryContext(ctx, "select a.groupName, a.windowDays, b.drugName from "+
+		crossToleranceTableName+" a join "+crossToleranceTableName+" b "+
+		"on a.groupName = b.groupName where a.drugName = ? and b.drugName <> ?", drug, drug)
+	if err != nil {
+		tempCrossErr.Err = fmt.Errorf("%s%w", sprintName(printN, "db.QueryContext(): "), err)
+		if crossErrChan != nil {
+			crossErrChan <- tempCrossErr
+		}
+		return tempCrossErr
+	}
+	defer rows.Close()
+
+	type groupMember struct {
+		group  string
+		window float32
+		drug   string
+	}
+
+	var members []groupMember
+	for rows.Next() {
+		var tempMember groupMember
+		err = rows.Scan(&tempMember.group, &tempMember.window, &tempMember.drug)
+		if err != nil {
+			tempCrossErr.Err = fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err)
+			if crossErrChan != nil {
+				crossErrChan <- tempCrossErr
+			}
+			return tempCrossErr
+		}
+		members = append(members, tempMember)
+	}
+	rows.Close()
+
+	for _, member := range members {
+		gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, username, false, member.drug, LogDrugNameCol)
+		if gotLogs.Err != nil {
+			if !errors.Is(gotLogs.Err, NoLogsError) {
+				tempCrossErr.Err = fmt.Errorf("%s%w", sprintName(printN), gotLogs.Err)
+				if crossErrChan != nil {
+					crossErrChan <- tempCrossErr
+				}
+				return tempCrossErr
+			}
+			continue
+		}
+
+		var newest UserLog
+		var newestFrom int64
+		for _, elem := range gotLogs.UserLogs {
+			if elem.StartTime >= at {
+				continue
+			}
+
+			from := elem.StartTime
+			if elem.EndTime > from && elem.EndTime < at {
+				from = elem.EndTime
+			}
+
+			if from > newestFrom {
+				newestFrom = from
+				newest = elem
+			}
+		}
+
+		if newestFrom == 0 {
+			continue
+		}
+
+		daysLeft := member.window - float32(at-newestFrom)/(24*60*60)
+		if daysLeft <= 0 {
+			continue
+		}
+
+		tempCrossErr.CrossTols = append(tempCrossErr.CrossTols, CrossTolerance{
+			GroupName:  member.group,
+			DrugName:   drug,
+			FromLog:    newest,
+			WindowDays: member.window,
+			DaysLeft:   daysLeft,
+		})
+	}
+
+	if crossErrChan != nil {
+		crossErrChan <- tempCrossErr
+	}
+	return tempCrossErr
+}
+
+// Returns the warning for a cross-tolerance, so that it can be added to
+// ErrorInfo.Warnings.
+func (cfg *Config) crossToleranceWarning(crossTol CrossTolerance) error {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+
+	return fmt.Errorf("%w: %q ; group: %q ; from log: %d ; drug: %q ; taken at: %s ; days remaining: %.1f",
+		CrossToleranceWarning, crossTol.DrugName, crossTol.GroupName, crossTol.FromLog.ID,
+		crossTol.FromLog.DrugName, time.Unix(crossTol.FromLog.StartTime, 0).In(location).Format("2006-01-02 15:04"),
+		crossTol.DaysLeft)
+}
+
+var CrossToleranceWarning error = errors.New("possible cross-tolerance from a previous dose to")
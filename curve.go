@@ -0,0 +1,323 @@
+package drugdose
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+// IntensityModel turns a single log into a relative intensity over time.
+// It can be replaced by better models, as long as the intensities of
+// different logs of the same drug can be added together.
+type IntensityModel interface {
+	// Intensity returns the relative intensity of the log at the given unix
+	// time. The info has all times in seconds. 1 is the peak of a common
+	// dose, 0 is no effect at all.
+	Intensity(userLog UserLog, info DrugInfo, at int64) float64
+}
+
+// BatemanModel uses the Bateman function, which describes the concentration
+// of a substance after absorption with first-order kinetics and elimination
+// with first-order kinetics. The curve is fitted, so that its maximum is at
+// the end of the come-up and it drops to EndIntensity of the maximum at the
+// end of the total duration. If the total duration is too short for that,
+// the fastest dropping curve is used. The maximum is scaled using the dose
+// compared to the average common dose, if the source has no common range,
+// the light range is used and if there are no ranges at all, the maximum
+// of every dose is 1. Logs with an end time are treated as taken at
+// a constant rate from the start to the end. The curve is fitted only once
+// for the same timings and kept in the model, so the same model should be
+// used for sampling many times.
+type BatemanModel struct {
+	// The relative intensity at the end of the total duration,
+	// if 0, 0.05 is used.
+	EndIntensity float64
+
+	fits     map[batemanFitKey]batemanRates
+	fitsLock sync.Mutex
+}
+
+// Everything the fitted curve depends on.
+type batemanFitKey struct {
+	tmax         float64
+	total        float64
+	endIntensity float64
+}
+
+// IntensityCurve is the intensity of all logs, which can be sampled at any
+// time, checkout GetIntensityCurve().
+type IntensityCurve struct {
+	Model IntensityModel
+	Logs  []UserLog
+	// The info for every log, in the same order, with all times in seconds.
+	Infos []DrugInfo
+}
+
+type IntensitySample struct {
+	// In unix time
+	Time      int64
+	Intensity float64
+}
+
+type IntensityCurveError struct {
+	Curve    *IntensityCurve
+	Username string
+	Err      error
+}
+
+// The rates of absorption and elimination, per second.
+type batemanRates struct {
+	ka float64
+	ke float64
+}
+
+// The Bateman function for a single dose, without scaling.
+func (b batemanRates) bolus(t float64) float64 {
+	if t <= 0 {
+		return 0
+	}
+	return math.Exp(-b.ke*t) - math.Exp(-b.ka*t)
+}
+
+// The integral of bolus() from 0 to t, used for doses taken over time.
+func (b batemanRates) bolusIntegral(t float64) float64 {
+	if t <= 0 {
+		return 0
+	}
+	return (1-math.Exp(-b.ke*t))/b.ke - (1-math.Exp(-b.ka*t))/b.ka
+}
+
+// The limits for the ratio between the rate of absorption and elimination.
+const batemanMinRatio float64 = 1.0001
+const batemanMaxRatio float64 = 1e6
+
+// Finds the rates for which the maximum is at tmax and the curve drops to
+// endIntensity of the maximum at total, both in seconds. The shape of the
+// curve relative to tmax only depends on the ratio between the rates,
+// so only the ratio is searched for, the bigger it is, the slower the
+// curve drops after the maximum.
+func fitBateman(tmax float64, total float64, endIntensity float64) batemanRates {
+	ratesFor := func(ratio float64) batemanRates {
+		ke := math.Log(ratio) / (tmax * (ratio - 1))
+		return batemanRates{ka: ratio * ke, ke: ke}
+	}
+
+	endFor := func(ratio float64) float64 {
+		rates := ratesFor(ratio)
+		return rates.bolus(total) / rates.bolus(tmax)
+	}
+
+	low := math.Log(batemanMinRatio)
+	high := math.Log(batemanMaxRatio)
+	if endFor(math.Exp(low)) >= endIntensity {
+		return ratesFor(math.Exp(low))
+	}
+	if endFor(math.Exp(high)) <= endIntensity {
+		return ratesFor(math.Exp(high))
+	}
+
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+		if endFor(math.Exp(mid)) < endIntensity {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return ratesFor(math.Exp((low + high) / 2))
+}
+
+// Returns the dose which has a maximum intensity of 1.
+func referenceDose(info DrugInfo, dose float32) float32 {
+	if common := getAverage(info.MediumDoseMin, info.MediumDoseMax); common != 0 {
+		return common
+	}
+	if light := getAverage(info.LowDoseMin, info.LowDoseMax); light != 0 {
+		return light
+	}
+	return dose
+}
+
+// Returns the fitted rates from the model, fitting them only the first time.
+func (m *BatemanModel) cachedFit(tmax float64, total float64, endIntensity float64) batemanRates {
+	m.fitsLock.Lock()
+	defer m.fitsLock.Unlock()
+
+	if m.fits == nil {
+		m.fits = map[batemanFitKey]batemanRates{}
+	}
+
+	key := batemanFitKey{tmax: tmax, total: total, endIntensity: endIntensity}
+	rates, exists := m.fits[key]
+	if !exists {
+		rates = fitBateman(tmax, total, endIntensity)
+		m.fits[key] = rates
+	}
+
+	return rates
+}
+
+func (m *BatemanModel) Intensity(userLog UserLog, info DrugInfo, at int64) float64 {
+	tmax := float64(getAverage(info.OnsetMin, info.OnsetMax) + getAverage(info.ComeUpMin, info.ComeUpMax))
+	total := float64(getAverage(info.TotalDurMin, info.TotalDurMax))
+	if tmax <= 0 || total <= 0 || userLog.Dose <= 0 || at <= userLog.StartTime {
+		return 0
+	}
+
+	endIntensity := m.EndIntensity
+	if endIntensity <= 0 {
+		endIntensity = 0.05
+	}
+
+	rates := m.cachedFit(tmax, total, endIntensity)
+	scale := float64(userLog.Dose/referenceDose(info, userLog.Dose)) / rates.bolus(tmax)
+
+	t := float64(at - userLog.StartTime)
+	if userLog.EndTime <= userLog.StartTime {
+		return scale * rates.bolus(t)
+	}
+
+	// Taken at a constant rate, so it's the average of the curves of all
+	// the small doses taken between the start and the end.
+	duration := float64(userLog.EndTime - userLog.StartTime)
+	taken := math.Min(t, duration)
+	return scale * (rates.bolusIntegral(t) - rates.bolusIntegral(t-taken)) / duration
+}
+
+// At returns the sum of the intensities of all logs at the given unix time.
+// Adding the intensities of different drugs isn't very meaningful,
+// for that use DrugAt().
+func (c *IntensityCurve) At(at int64) float64 {
+	var sum float64
+	for i, elem := range c.Logs {
+		sum += c.Model.Intensity(elem, c.Infos[i], at)
+	}
+	return sum
+}
+
+// DrugAt returns the sum of the intensities of all logs of a single drug
+// at the given unix time.
+func (c *IntensityCurve) DrugAt(drug string, at int64) float64 {
+	var sum float64
+	for i, elem := range c.Logs {
+		if elem.DrugName == drug {
+			sum += c.Model.Intensity(elem, c.Infos[i], at)
+		}
+	}
+	return sum
+}
+
+// Sample returns the intensity of all logs from one unix time to another,
+// both included, every step seconds. If drug isn't empty, only the logs
+// of that drug are used.
+func (c *IntensityCurve) Sample(from int64, to int64, step int64, drug string) []IntensitySample {
+	if step <= 0 {
+		return nil
+	}
+
+	var samples []IntensitySample
+	for at := from; at <= to; at += step {
+		tempSample := IntensitySample{Time: at}
+		if drug == "" {
+			tempSample.Intensity = c.At(at)
+		} else {
+			tempSample.Intensity = c.DrugAt(drug, at)
+		}
+		samples = append(samples, tempSample)
+	}
+	return samples
+}
+
+// GetIntensityCurve returns a curve with all logs of a user, which can still
+// have an effect at the given time or later. Logs without info about their
+// drug and route or with different units than the info are skipped.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// curveErrChan - the goroutine channel which returns the curve and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// model - the model to use for every log, if nil BatemanModel is used
+//
+// username - the user for which to get the curve
+//
+// from - the unix time from which the curve will be sampled, logs which
+// have ended before it are skipped
+func (cfg *Config) GetIntensityCurve(db *sql.DB, ctx context.Context,
+	curveErrChan chan<- IntensityCurveError, model IntensityModel,
+	username string, from int64) IntensityCurveError {
+	const printN string = "GetIntensityCurve()"
+
+	tempCurveErr := IntensityCurveError{
+		Curve:    nil,
+		Username: username,
+		Err:      nil,
+	}
+
+	if model == nil {
+		model = &BatemanModel{}
+	}
+
+	gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, username, false, "", "")
+	if gotLogs.Err != nil {
+		tempCurveErr.Err = fmt.Errorf("%s%w", sprintName(printN), gotLogs.Err)
+		if curveErrChan != nil {
+			curveErrChan <- tempCurveErr
+		}
+		return tempCurveErr
+	}
+
+	curve := IntensityCurve{Model: model}
+	gotInfos := map[string]DrugInfo{}
+	for _, elem := range gotLogs.UserLogs {
+		key := elem.DrugName + "\x00" + elem.DrugRoute
+		info, exists := gotInfos[key]
+		if !exists {
+			var err error
+			err, info = cfg.getRouteInfo(db, ctx, elem.DrugName, elem.DrugRoute, username)
+			if err != nil {
+				printNameVerbose(cfg.VerbosePrinting, printN, "Skipping log:", elem.ID, "; error:", err)
+				gotInfos[key] = info
+				continue
+			}
+			cfg.convertToSeconds(db, ctx, info.OnsetUnits, &info.OnsetMin, &info.OnsetMax)
+			cfg.convertToSeconds(db, ctx, info.ComeUpUnits, &info.ComeUpMin, &info.ComeUpMax)
+			cfg.convertToSeconds(db, ctx, info.PeakUnits, &info.PeakMin, &info.PeakMax)
+			cfg.convertToSeconds(db, ctx, info.OffsetUnits, &info.OffsetMin, &info.OffsetMax)
+			cfg.convertToSeconds(db, ctx, info.TotalDurUnits, &info.TotalDurMin, &info.TotalDurMax)
+			gotInfos[key] = info
+		}
+
+		if info.DrugName == "" || info.DoseUnits != elem.DoseUnits || logMaxEnd(elem, info) < from {
+			continue
+		}
+
+		curve.Logs = append(curve.Logs, elem)
+		curve.Infos = append(curve.Infos, info)
+	}
+
+	if len(curve.Logs) == 0 {
+		tempCurveErr.Err = fmt.Errorf("%s%w: %s ; none can have an effect", sprintName(printN),
+			NoLogsError, username)
+		if curveErrChan != nil {
+			curveErrChan <- tempCurveErr
+		}
+		return tempCurveErr
+	}
+
+	tempCurveErr.Curve = &curve
+	if curveErrChan != nil {
+		curveErrChan <- tempCurveErr
+	}
+	return tempCurveErr
+}
@@ -0,0 +1,243 @@
+package drugdose
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+const ActionExportLogs string = "exporting logs completed"
+
+// The formats supported by ExportLogs().
+const ExportFormatCSV string = "csv"
+const ExportFormatJSON string = "json"
+const ExportFormatNDJSON string = "ndjson"
+
+// ExportLog is a single log as written by ExportLogs(). Apart from the
+// fields of UserLog, it contains fields computed from them, so that they
+// don't have to be calculated again when analysing the data.
+type ExportLog struct {
+	UserLog
+	// The start and end time formatted using RFC3339 in the configured
+	// Timezone, End is empty if the log has no end time.
+	Start string
+	End   string
+	// In seconds, 0 if the log has no end time.
+	Duration int64
+}
+
+// Returns the logs with a start time within the given range.
+//
+// from - if not 0, only logs started at or after this unix time are returned
+//
+// to - if not 0, only logs started at or before this unix time are returned
+func filterLogsByTime(userLogs []UserLog, from int64, to int64) []UserLog {
+	var filtered []UserLog
+	for _, elem := range userLogs {
+		if from != 0 && elem.StartTime < from {
+			continue
+		}
+		if to != 0 && elem.StartTime > to {
+			continue
+		}
+		filtered = append(filtered, elem)
+	}
+	return filtered
+}
+
+// Fills in the computed fields for every log.
+func toExportLogs(userLogs []UserLog, location *time.Location) []ExportLog {
+	exportLogs := make([]ExportLog, 0, len(userLogs))
+	for _, elem := range userLogs {
+		tempLog := ExportLog{
+			UserLog:  elem,
+			Start:    time.Unix(elem.StartTime, 0).In(location).Format(time.RFC3339),
+			End:      "",
+			Duration: 0,
+		}
+		if elem.EndTime != 0 {
+			tempLog.End = time.Unix(elem.EndTime, 0).In(location).Format(time.RFC3339)
+			tempLog.Duration = elem.EndTime - elem.StartTime
+		}
+		exportLogs = append(exportLogs, tempLog)
+	}
+	return exportLogs
+}
+
+// The header of the CSV output, in the same order as csvExportRecord().
+func csvExportHeader() []string {
+	return []string{"ID", "StartTime", "EndTime", "Start", "End", "Duration",
+		"Username", "DrugName", "Dose", "DoseUnits", "DrugRoute",
+		"Cost", "CostCurrency"}
+}
+
+func csvExportRecord(elem ExportLog) []string {
+	return []string{
+		strconv.FormatInt(elem.ID, 10),
+		strconv.FormatInt(elem.StartTime, 10),
+		strconv.FormatInt(elem.EndTime, 10),
+		elem.Start,
+		elem.End,
+		strconv.FormatInt(elem.Duration, 10),
+		elem.Username,
+		elem.DrugName,
+		strconv.FormatFloat(float64(elem.Dose), 'f', -1, 32),
+		elem.DoseUnits,
+		elem.DrugRoute,
+		strconv.FormatFloat(float64(elem.Cost), 'f', -1, 32),
+		elem.CostCurrency,
+	}
+}
+
+// WriteExportLogs writes the logs to w using the given format.
+//
+// w - where to write the logs, for example a file or os.Stdout
+//
+// format - ExportFormatCSV, ExportFormatJSON or ExportFormatNDJSON
+//
+// exportLogs - the logs to write
+func WriteExportLogs(w io.Writer, format string, exportLogs []ExportLog) error {
+	const printN string = "WriteExportLogs()"
+
+	if format == ExportFormatCSV {
+		csvW := csv.NewWriter(w)
+		err := csvW.Write(csvExportHeader())
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err)
+		}
+		for _, elem := range exportLogs {
+			err = csvW.Write(csvExportRecord(elem))
+			if err != nil {
+				return fmt.Errorf("%s%w", sprintName(printN), err)
+			}
+		}
+		csvW.Flush()
+		err = csvW.Error()
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err)
+		}
+	} else if format == ExportFormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		err := enc.Encode(exportLogs)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err)
+		}
+	} else if format == ExportFormatNDJSON {
+		// Encode() adds a newline after every value.
+		enc := json.NewEncoder(w)
+		for _, elem := range exportLogs {
+			err := enc.Encode(elem)
+			if err != nil {
+				return fmt.Errorf("%s%w", sprintName(printN), err)
+			}
+		}
+	} else {
+		return fmt.Errorf("%s%w: %q", sprintName(printN), ExportFormatError, format)
+	}
+
+	return nil
+}
+
+// ExportLogs writes all logs of a user, which match the filters, to w.
+// The logs are gotten using GetLogs(), from the oldest to the newest and
+// the computed fields of ExportLog are filled in, using the timezone
+// preference of the user, checkout SetUserPref(). If no logs match, nothing is written and NoLogsError is returned.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// errChannel - the gorouting channel which returns the errors
+// (set to nil if function doesn't need to be concurrent)
+//
+// w - where to write the logs, for example a file or os.Stdout
+//
+// format - ExportFormatCSV, ExportFormatJSON or ExportFormatNDJSON
+//
+// username - the user for which to export the logs
+//
+// from - if not 0, only logs started at or after this unix time are exported
+//
+// to - if not 0, only logs started at or before this unix time are exported
+//
+// search - export only logs matching this string, checkout GetLogs()
+//
+// getExact - if not empty, the column to search, checkout GetLogs()
+func (cfg *Config) ExportLogs(db *sql.DB, ctx context.Context, errChannel chan<- ErrorInfo,
+	w io.Writer, format string, username string, from int64, to int64,
+	search string, getExact string) ErrorInfo {
+	const printN string = "ExportLogs()"
+
+	tempErrInfo := ErrorInfo{
+		Err:      nil,
+		Action:   ActionExportLogs,
+		Username: username,
+	}
+
+	if format != ExportFormatCSV && format != ExportFormatJSON && format != ExportFormatNDJSON {
+		tempErrInfo.Err = fmt.Errorf("%s%w: %q", sprintName(printN), ExportFormatError, format)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	location, err := time.LoadLocation(cfg.userPrefValues(db, ctx, username)[PrefTimezone])
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN, "LoadLocation(): "), err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, username, false, search, getExact)
+	if gotLogs.Err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), gotLogs.Err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	filtered := filterLogsByTime(gotLogs.UserLogs, from, to)
+	if len(filtered) == 0 {
+		tempErrInfo.Err = fmt.Errorf("%s%w: %s ; in the given time range", sprintName(printN),
+			NoLogsError, username)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	err = WriteExportLogs(w, format, toExportLogs(filtered, location))
+	if err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Exported:", len(filtered), "logs ; format:", format,
+		"; user:", username)
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+var ExportFormatError error = errors.New("unknown export format, use csv, json or ndjson")
@@ -5,8 +5,11 @@ go 1.20
 require (
 	github.com/go-sql-driver/mysql v1.7.1
 	github.com/hasura/go-graphql-client v0.10.0
+	github.com/lib/pq v1.10.9
 	github.com/otiai10/copy v1.12.0
 	github.com/pelletier/go-toml/v2 v2.1.0
+	golang.org/x/crypto v0.12.0
+	golang.org/x/sys v0.11.0
 	modernc.org/sqlite v1.25.0
 )
 
@@ -18,7 +21,6 @@ require (
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	golang.org/x/mod v0.12.0 // indirect
-	golang.org/x/sys v0.11.0 // indirect
 	golang.org/x/tools v0.12.0 // indirect
 	lukechampine.com/uint128 v1.3.0 // indirect
 	modernc.org/cc/v3 v3.41.0 // indirect
@@ -6,7 +6,10 @@ import (
 
 type ChannelStructs interface {
 	UserLogsError | DrugNamesError | DrugInfoError |
-		UserSettingError | LogCountError | AllUsersError | ErrorInfo
+		UserSettingError | LogCountError | AllUsersError | StaleInfoError |
+		InfoDiffError | ImportLogsError | ActiveTimesError | DoseSessionsError | IntensityCurveError | ToleranceError |
+		CrossToleranceError | UserProfileError | BACError | UserPrefsError |
+		DosingPresetsError | AuditLogError | ErrorInfo
 }
 
 // AddChannelHandler starts receiving from a channel which it creates, using
@@ -0,0 +1,564 @@
+package drugdose
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+const ActionImportLogs string = "importing logs completed"
+
+// ImportRow is a single log read from an import file, before it's validated.
+// Row is the number of the record in the file, starting from 1, the CSV
+// header isn't counted. If the record couldn't be read, Err is set.
+type ImportRow struct {
+	Row int
+	Log UserLog
+	Err error
+}
+
+// ImportRowError is the error for a single record, which wasn't imported.
+type ImportRowError struct {
+	Row int
+	Err error
+}
+
+type ImportLogsError struct {
+	// How many logs were added to the database, always 0 for a dry run.
+	Imported int
+	// How many logs are valid and would be or were added.
+	Valid     int
+	RowErrors []ImportRowError
+	Username  string
+	Err       error
+}
+
+// ImportFormatFromPath returns the import or export format matching the
+// extension of the given file: ".csv", ".json", ".ndjson" or ".jsonl".
+// If the extension is unknown, an empty string is returned.
+func ImportFormatFromPath(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".csv" {
+		return ExportFormatCSV
+	} else if ext == ".json" {
+		return ExportFormatJSON
+	} else if ext == ".ndjson" || ext == ".jsonl" {
+		return ExportFormatNDJSON
+	}
+	return ""
+}
+
+// Sets the times of the log from the formatted strings, if the unix
+// timestamps aren't set already. This way either can be used in a file.
+// RFC3339 is tried first, then everything accepted by ParseTimeInput(),
+// so times without a time zone are in the configured Timezone.
+func (cfg *Config) importTimes(userLog *UserLog, start string, end string) error {
+	if userLog.StartTime == 0 && start != "" {
+		err, gotTime := cfg.importTime(start)
+		if err != nil {
+			return err
+		}
+		userLog.StartTime = gotTime
+	}
+
+	if userLog.EndTime == 0 && end != "" {
+		err, gotTime := cfg.importTime(end)
+		if err != nil {
+			return err
+		}
+		userLog.EndTime = gotTime
+	}
+
+	return nil
+}
+
+func (cfg *Config) importTime(input string) (error, int64) {
+	gotTime, err := time.Parse(time.RFC3339, input)
+	if err == nil {
+		return nil, gotTime.Unix()
+	}
+
+	return cfg.ParseTimeInput(input)
+}
+
+// Reads a CSV file with a header. The names of the columns are the same as
+// the ones written by ExportLogs(), unknown columns are ignored.
+func (cfg *Config) readImportCSV(r io.Reader) (error, []ImportRow) {
+	const printN string = "readImportCSV()"
+
+	csvR := csv.NewReader(r)
+	csvR.FieldsPerRecord = -1
+
+	header, err := csvR.Read()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.TrimSpace(name)] = i
+	}
+
+	for _, name := range []string{"DrugName", "Dose", "DoseUnits", "DrugRoute"} {
+		if _, exists := cols[name]; !exists {
+			return fmt.Errorf("%s%w: %s", sprintName(printN), ImportMissingColError, name), nil
+		}
+	}
+
+	_, gotStart := cols["Start"]
+	_, gotStartTime := cols["StartTime"]
+	if !gotStart && !gotStartTime {
+		return fmt.Errorf("%s%w: StartTime or Start", sprintName(printN), ImportMissingColError), nil
+	}
+
+	var rows []ImportRow
+	for rowNum := 1; ; rowNum++ {
+		record, err := csvR.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err), nil
+		}
+
+		getCol := func(name string) string {
+			i, exists := cols[name]
+			if !exists || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		getInt := func(name string) int64 {
+			gotStr := getCol(name)
+			if gotStr == "" || err != nil {
+				return 0
+			}
+			var got int64
+			got, err = strconv.ParseInt(gotStr, 10, 64)
+			return got
+		}
+
+		getFloat := func(name string) float32 {
+			gotStr := getCol(name)
+			if gotStr == "" || err != nil {
+				return 0
+			}
+			var got float64
+			got, err = strconv.ParseFloat(gotStr, 32)
+			return float32(got)
+		}
+
+		tempRow := ImportRow{Row: rowNum}
+		tempRow.Log.StartTime = getInt("StartTime")
+		tempRow.Log.EndTime = getInt("EndTime")
+		tempRow.Log.DrugName = getCol("DrugName")
+		tempRow.Log.Dose = getFloat("Dose")
+		tempRow.Log.DoseUnits = getCol("DoseUnits")
+		tempRow.Log.DrugRoute = getCol("DrugRoute")
+		tempRow.Log.Cost = getFloat("Cost")
+		tempRow.Log.CostCurrency = getCol("CostCurrency")
+		if err == nil {
+			err = cfg.importTimes(&tempRow.Log, getCol("Start"), getCol("End"))
+		}
+		tempRow.Err = err
+
+		rows = append(rows, tempRow)
+	}
+
+	return nil, rows
+}
+
+// Reads a JSON array of objects, the keys are the same as the ones written
+// by ExportLogs().
+func (cfg *Config) readImportJSON(r io.Reader) (error, []ImportRow) {
+	const printN string = "readImportJSON()"
+
+	var gotLogs []ExportLog
+	err := json.NewDecoder(r).Decode(&gotLogs)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	rows := make([]ImportRow, 0, len(gotLogs))
+	for i, elem := range gotLogs {
+		tempRow := ImportRow{Row: i + 1, Log: elem.UserLog}
+		tempRow.Err = cfg.importTimes(&tempRow.Log, elem.Start, elem.End)
+		rows = append(rows, tempRow)
+	}
+
+	return nil, rows
+}
+
+// Reads one JSON object per line, empty lines are skipped, but still counted.
+func (cfg *Config) readImportNDJSON(r io.Reader) (error, []ImportRow) {
+	const printN string = "readImportNDJSON()"
+
+	var rows []ImportRow
+	scanner := bufio.NewScanner(r)
+	for rowNum := 1; scanner.Scan(); rowNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var gotLog ExportLog
+		tempRow := ImportRow{Row: rowNum}
+		tempRow.Err = json.Unmarshal([]byte(line), &gotLog)
+		if tempRow.Err == nil {
+			tempRow.Log = gotLog.UserLog
+			tempRow.Err = cfg.importTimes(&tempRow.Log, gotLog.Start, gotLog.End)
+		}
+		rows = append(rows, tempRow)
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	return nil, rows
+}
+
+// ReadImportLogs reads all records from r, without validating them.
+// Records which couldn't be read have ImportRow.Err set, if the whole input
+// can't be read, only the returned error is set.
+//
+// r - where to read the logs from, for example a file
+//
+// format - ExportFormatCSV, ExportFormatJSON or ExportFormatNDJSON,
+// checkout ExportLogs() for the layout of every format
+func (cfg *Config) ReadImportLogs(r io.Reader, format string) (error, []ImportRow) {
+	const printN string = "ReadImportLogs()"
+
+	var err error
+	var rows []ImportRow
+	if format == ExportFormatCSV {
+		err, rows = cfg.readImportCSV(r)
+	} else if format == ExportFormatJSON {
+		err, rows = cfg.readImportJSON(r)
+	} else if format == ExportFormatNDJSON {
+		err, rows = cfg.readImportNDJSON(r)
+	} else {
+		err = fmt.Errorf("%w: %q", ExportFormatError, format)
+	}
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	return nil, rows
+}
+
+// Checks a single log and replaces the names with the local ones, the same
+// way as AddToDoseTable(). A log which is already present for the user is
+// treated as invalid, so importing the same file twice doesn't add anything.
+func (cfg *Config) validateImportLog(db *sql.DB, ctx context.Context,
+	username string, userLog *UserLog) error {
+	if userLog.StartTime <= 0 {
+		return ImportNoStartError
+	}
+
+	if userLog.StartTime > time.Now().Unix() {
+		return StartTimeInFutureError
+	}
+
+	if userLog.EndTime != 0 && userLog.EndTime < userLog.StartTime {
+		return EndBeforeStartError
+	}
+
+	if userLog.Dose <= 0 {
+		return ImportInvalidDoseError
+	}
+
+	userLog.DrugName = cfg.MatchAndReplace(db, ctx, userLog.DrugName, NameTypeSubstance)
+	userLog.DrugRoute = cfg.MatchAndReplace(db, ctx, userLog.DrugRoute, NameTypeRoute)
+	userLog.DoseUnits = cfg.MatchAndReplace(db, ctx, userLog.DoseUnits, NameTypeUnits)
+
+	xtrs := [2]string{xtrastmt("drugRoute", "and"), xtrastmt("doseUnits", "and")}
+	ret := checkIfExistsDB(db, ctx,
+		"drugName", cfg.UseSource,
+		cfg.DBDriver, cfg.DBSettings[cfg.DBDriver].Path,
+		xtrs[:], userLog.DrugName, userLog.DrugRoute, userLog.DoseUnits)
+	if !ret {
+		return fmt.Errorf("%w: %s", ComboInputError,
+			fmt.Sprintf("Drug: %q"+
+				" ; Route: %q"+
+				" ; Units: %q",
+				userLog.DrugName, userLog.DrugRoute, userLog.DoseUnits))
+	}
+
+	if userLog.CostCurrency == "" && userLog.Cost != 0 {
+		userLog.CostCurrency = cfg.userPrefValues(db, ctx, username)[PrefDefaultCurrency]
+	}
+
+	err, exists := cfg.importLogExists(db, ctx, username, *userLog)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ImportDuplicateLogError
+	}
+
+	return nil
+}
+
+// Returns true if the user already has a log with the same start time,
+// drug, route, dose and units.
+func (cfg *Config) importLogExists(db *sql.DB, ctx context.Context,
+	username string, userLog UserLog) (error, bool) {
+	const printN string = "importLogExists()"
+
+	rows, err := db.QueryContext(ctx, "select "+LogDoseCol+" from "+loggingTableName+
+		" where username = ? and "+LogStartTimeCol+" = ? and "+LogDrugNameCol+" = ?"+
+		" and "+LogDrugRouteCol+" = ? and "+LogDoseUnitsCol+" = ?",
+		username, userLog.StartTime, userLog.DrugName, userLog.DrugRoute, userLog.DoseUnits)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.QueryContext(): "), err), false
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dose float32
+		err = rows.Scan(&dose)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err), false
+		}
+		if dose == userLog.Dose {
+			return nil, true
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "rows.Err(): "), err), false
+	}
+
+	return nil, false
+}
+
+// The fields which make two logs the same, used to find duplicates in a file.
+type importLogKey struct {
+	start int64
+	drug  string
+	route string
+	dose  float32
+	units string
+}
+
+// ImportLogs validates and adds logs read using ReadImportLogs() to the
+// dose log table. Unlike AddToDoseTable(), the start and end times are taken
+// from the records. The names are replaced using MatchAndReplace() and every
+// combination of drug, route and units must be present in the info table,
+// nothing is fetched from the source. All logs are added in a single
+// transaction. MaxLogsPerUser is respected, but old logs are never removed
+// automatically, even if AutoRemove is enabled. Records with a start time in
+// the future or which match an existing log of the user, or an earlier record,
+// on the start time, drug, route, dose and units are reported as invalid.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// importErrChan - the goroutine channel used to return how many logs were
+// imported, the errors for every invalid record and the error
+// (set to nil if function doesn't need to be concurrent)
+//
+// rows - the records returned by ReadImportLogs()
+//
+// username - the user to import the logs for, the usernames in the records
+// are ignored
+//
+// dryRun - if true, only validate the records, without adding anything
+//
+// allOrNothing - if true, nothing is added if any record is invalid,
+// if false, the invalid records are skipped and the rest are added
+func (cfg *Config) ImportLogs(db *sql.DB, ctx context.Context,
+	importErrChan chan<- ImportLogsError, rows []ImportRow, username string,
+	dryRun bool, allOrNothing bool) ImportLogsError {
+	const printN string = "ImportLogs()"
+
+	tempImportErr := ImportLogsError{
+		Imported:  0,
+		Valid:     0,
+		RowErrors: nil,
+		Username:  username,
+		Err:       nil,
+	}
+
+	var validLogs []UserLog
+	seenLogs := map[importLogKey]bool{}
+	for _, elem := range rows {
+		err := elem.Err
+		if err == nil {
+			err = cfg.validateImportLog(db, ctx, username, &elem.Log)
+		}
+		if err == nil {
+			key := importLogKey{
+				start: elem.Log.StartTime,
+				drug:  elem.Log.DrugName,
+				route: elem.Log.DrugRoute,
+				dose:  elem.Log.Dose,
+				units: elem.Log.DoseUnits,
+			}
+			if seenLogs[key] {
+				err = ImportDuplicateLogError
+			}
+			seenLogs[key] = true
+		}
+		if err != nil {
+			tempImportErr.RowErrors = append(tempImportErr.RowErrors,
+				ImportRowError{Row: elem.Row, Err: err})
+			continue
+		}
+		validLogs = append(validLogs, elem.Log)
+	}
+	tempImportErr.Valid = len(validLogs)
+
+	if allOrNothing && len(tempImportErr.RowErrors) != 0 {
+		tempImportErr.Err = fmt.Errorf("%s%w: %d", sprintName(printN), ImportInvalidRowsError,
+			len(tempImportErr.RowErrors))
+		if importErrChan != nil {
+			importErrChan <- tempImportErr
+		}
+		return tempImportErr
+	}
+
+	gotLogCountErr := cfg.GetLogsCount(db, ctx, username, nil)
+	if gotLogCountErr.Err != nil {
+		tempImportErr.Err = fmt.Errorf("%s%w", sprintName(printN), gotLogCountErr.Err)
+		if importErrChan != nil {
+			importErrChan <- tempImportErr
+		}
+		return tempImportErr
+	}
+
+	if int64(gotLogCountErr.LogCount)+int64(len(validLogs)) > int64(cfg.MaxLogsPerUser) {
+		tempImportErr.Err = fmt.Errorf("%s: %w: %q ; logs: %d ; importing: %d ; Not importing",
+			sprintName(printN, "User:", username), MaxLogsPerUserError, cfg.MaxLogsPerUser,
+			gotLogCountErr.LogCount, len(validLogs))
+		if importErrChan != nil {
+			importErrChan <- tempImportErr
+		}
+		return tempImportErr
+	}
+
+	if dryRun || len(validLogs) == 0 {
+		if importErrChan != nil {
+			importErrChan <- tempImportErr
+		}
+		return tempImportErr
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		tempImportErr.Err = fmt.Errorf("%s%w", sprintName(printN, "db.BeginTx(): "), err)
+		if importErrChan != nil {
+			importErrChan <- tempImportErr
+		}
+		return tempImportErr
+	}
+
+	stmt, err := tx.Prepare(cfg.insertLogStmt())
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Prepare(): ")
+	if err != nil {
+		tempImportErr.Err = err
+		if importErrChan != nil {
+			importErrChan <- tempImportErr
+		}
+		return tempImportErr
+	}
+	defer stmt.Close()
+
+	var ids []int64
+	for i, elem := range validLogs {
+		elem.Username = username
+		err, elem.ID = cfg.insertLog(ctx, stmt, elem)
+		err = handleErrRollbackSeq(err, tx, printN, "stmt.Exec(): ")
+		if err != nil {
+			tempImportErr.Err = err
+			if importErrChan != nil {
+				importErrChan <- tempImportErr
+			}
+			return tempImportErr
+		}
+		validLogs[i] = elem
+		if elem.ID != 0 {
+			ids = append(ids, elem.ID)
+		}
+	}
+
+	err = cfg.addAuditEntry(ctx, tx, ActionImportLogs, username, ids, nil, validLogs)
+	err = handleErrRollbackSeq(err, tx, printN, "")
+	if err != nil {
+		tempImportErr.Err = err
+		if importErrChan != nil {
+			importErrChan <- tempImportErr
+		}
+		return tempImportErr
+	}
+
+	err = tx.Commit()
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+	if err != nil {
+		tempImportErr.Err = err
+		if importErrChan != nil {
+			importErrChan <- tempImportErr
+		}
+		return tempImportErr
+	}
+
+	tempImportErr.Imported = len(validLogs)
+
+	if importErrChan != nil {
+		importErrChan <- tempImportErr
+	}
+	return tempImportErr
+}
+
+// PrintImportLogs prints how many logs were imported and the errors for
+// all invalid records.
+//
+// importErr - the struct returned from ImportLogs()
+//
+// dryRun - whether ImportLogs() was called as a dry run
+//
+// prefix - whether to add the function name to console output
+func (cfg *Config) PrintImportLogs(importErr ImportLogsError, dryRun bool, prefix bool) {
+	var printN string
+	if prefix == true {
+		printN = "PrintImportLogs()"
+	} else {
+		printN = ""
+	}
+
+	for _, elem := range importErr.RowErrors {
+		printNameF(printN, "Row: %d ; %v\n", elem.Row, elem.Err)
+	}
+
+	if dryRun {
+		printNameF(printN, "Dry run: valid: %d ; invalid: %d ; for user: %q\n",
+			importErr.Valid, len(importErr.RowErrors), importErr.Username)
+	} else {
+		printNameF(printN, "Imported: %d ; invalid: %d ; for user: %q\n",
+			importErr.Imported, len(importErr.RowErrors), importErr.Username)
+	}
+}
+
+var ImportMissingColError error = errors.New("the import file is missing a column")
+var ImportNoStartError error = errors.New("the log has no start time")
+var ImportInvalidDoseError error = errors.New("the dose must be bigger than 0")
+var ImportDuplicateLogError error = errors.New("the log is already present")
+var ImportInvalidRowsError error = errors.New("nothing imported, because of invalid records")
@@ -0,0 +1,531 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+const interactionsFilename string = "gpd-interactions.toml"
+const interactionsTableName string = "interactions"
+
+// The origin of the interactions from the config file, the ones from a source
+// use the name of the source.
+const LocalInteractionsOrigin string = "local"
+
+// InteractionRisk is how risky it is to combine two substances.
+type InteractionRisk int
+
+const (
+	InteractionLowRisk InteractionRisk = iota + 1
+	InteractionCaution
+	InteractionUnsafe
+	InteractionDangerous
+)
+
+func (r InteractionRisk) String() string {
+	switch r {
+	case InteractionLowRisk:
+		return "low risk"
+	case InteractionCaution:
+		return "caution"
+	case InteractionUnsafe:
+		return "unsafe"
+	case InteractionDangerous:
+		return "dangerous"
+	}
+	return fmt.Sprintf("InteractionRisk(%d)", int(r))
+}
+
+type Interaction struct {
+	DrugA string
+	DrugB string
+	Risk  InteractionRisk
+	// LocalInteractionsOrigin or the name of the source.
+	Origin string
+}
+
+// InteractionsList has the substances for every risk, for a single substance
+// in InteractionsConfig.
+type InteractionsList struct {
+	LowRisk   []string
+	Caution   []string
+	Unsafe    []string
+	Dangerous []string
+}
+
+// InteractionsConfig is the layout of the interactions config file,
+// for example:
+//
+//	[Substance.MDMA]
+//	Dangerous = ["Tramadol"]
+//	Caution = ["Alcohol"]
+//
+// Every pair has to be written only once, the order of the substances doesn't
+// matter. Underscores in the names of the substances which are keys,
+// are replaced with spaces, the same as for the names configs.
+type InteractionsConfig struct {
+	Substance map[string]InteractionsList
+}
+
+// GetInteractionsConfig reads the interactions config file, the same way
+// as GetToleranceConfig(), first the source specific one and if it doesn't
+// exist, the global one.
+//
+// source - the source for which to read the config
+func GetInteractionsConfig(source string) (error, *InteractionsConfig) {
+	const printN string = "GetInteractionsConfig()"
+
+	err, file := readSourceOrGlobalConfig(interactionsFilename, source)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	interCfg := InteractionsConfig{}
+	err = toml.Unmarshal(file, &interCfg)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "toml.Unmarshal(): "), err), nil
+	}
+
+	return nil, &interCfg
+}
+
+// Replaces the interactions of the origin in the table. If drug is empty,
+// all interactions of the origin are replaced and the magic word is added,
+// so that the table isn't filled again, otherwise only the interactions
+// where the drug is DrugA are replaced. When a pair is present more than
+// once, the highest risk is kept. Like the table, the pairs are compared
+// without considering the case.
+func (cfg *Config) storeInteractions(db *sql.DB, ctx context.Context,
+	origin string, drug string, interactions []Interaction) error {
+	const printN string = "storeInteractions()"
+
+	type pairKey struct {
+		drugA string
+		drugB string
+	}
+
+	highest := map[pairKey]InteractionRisk{}
+	var pairs []pairKey
+	var pairNames []pairKey
+	for _, elem := range interactions {
+		key := pairKey{strings.ToLower(elem.DrugA), strings.ToLower(elem.DrugB)}
+		risk, exists := highest[key]
+		if !exists {
+			pairs = append(pairs, key)
+			pairNames = append(pairNames, pairKey{elem.DrugA, elem.DrugB})
+		}
+		if elem.Risk > risk {
+			highest[key] = elem.Risk
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	if drug == "" {
+		_, err = tx.Exec("delete from "+interactionsTableName+" where origin = ?", origin)
+	} else {
+		_, err = tx.Exec("delete from "+interactionsTableName+" where origin = ? and drugA = ?",
+			origin, drug)
+	}
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Exec(): ")
+	if err != nil {
+		return err
+	}
+
+	interStmt, err := tx.Prepare("insert into " + interactionsTableName +
+		" (drugA, drugB, risk, origin) " +
+		"values(?, ?, ?, ?)")
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Prepare(): ")
+	if err != nil {
+		return err
+	}
+	defer interStmt.Close()
+
+	if drug == "" {
+		_, err = tx.Stmt(interStmt).Exec(namesMagicWord, namesMagicWord, 0, origin)
+		err = handleErrRollbackSeq(err, tx, printN, "tx.Stmt.Exec(): ")
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, elem := range pairs {
+		_, err = tx.Stmt(interStmt).Exec(pairNames[i].drugA, pairNames[i].drugB, highest[elem], origin)
+		err = handleErrRollbackSeq(err, tx, printN, "tx.Stmt.Exec(): ")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	err = handleErrRollbackSeq(err, tx, printN, "tx.Commit(): ")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddToInteractionsTable fills the interactions table using the config file,
+// checkout GetInteractionsConfig(). Like the names, this is done only once.
+// The interactions from the source are added when fetching a substance,
+// if the source implements InteractionSource.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// overwrite - if true, the interactions from the config file are replaced,
+// even if they were already added, the ones from the source are kept
+func (cfg *Config) AddToInteractionsTable(db *sql.DB, ctx context.Context, overwrite bool) error {
+	const printN string = "AddToInteractionsTable()"
+
+	if !overwrite {
+		ret := checkIfExistsDB(db, ctx,
+			"drugA",
+			interactionsTableName,
+			cfg.DBDriver,
+			cfg.DBSettings[cfg.DBDriver].Path,
+			nil,
+			namesMagicWord)
+		if ret {
+			return nil
+		}
+	}
+
+	err, interCfg := GetInteractionsConfig(cfg.UseSource)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	var interactions []Interaction
+	for drugA, list := range interCfg.Substance {
+		drugA = strings.ReplaceAll(drugA, "_", " ")
+		risks := []struct {
+			risk  InteractionRisk
+			drugs []string
+		}{
+			{InteractionLowRisk, list.LowRisk},
+			{InteractionCaution, list.Caution},
+			{InteractionUnsafe, list.Unsafe},
+			{InteractionDangerous, list.Dangerous},
+		}
+		for _, elem := range risks {
+			for _, drugB := range elem.drugs {
+				interactions = append(interactions,
+					Interaction{drugA, drugB, elem.risk, LocalInteractionsOrigin})
+			}
+		}
+	}
+
+	err = cfg.storeInteractions(db, ctx, LocalInteractionsOrigin, "", interactions)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	printName(printN, "Interactions initialized successfully!")
+
+	return nil
+}
+
+// Stores the interactions of the substance from the source, if the source
+// implements InteractionSource. Errors are only printed, since the info
+// for the substance can be used without them.
+func (cfg *Config) fetchSourceInteractions(db *sql.DB, ctx context.Context,
+	src Source, drugname string) {
+	const printN string = "fetchSourceInteractions()"
+
+	interSrc, ok := src.(InteractionSource)
+	if !ok {
+		return
+	}
+
+	err, fetched := interSrc.FetchInteractions(ctx, drugname)
+	if err != nil {
+		printNameVerbose(cfg.VerbosePrinting, printN, "No interactions for:", drugname, "; error:", err)
+		return
+	}
+
+	// The source can use other names than the local ones and can return
+	// similar substances as well. Only the interactions of the substance
+	// itself are kept and all are stored using the local names, so that
+	// storeInteractions() replaces them using the same name next time.
+	localNames := map[string]string{}
+	localName := func(name string) string {
+		local, exists := localNames[name]
+		if !exists {
+			local = cfg.MatchAndReplace(db, ctx, name, NameTypeSubstance)
+			localNames[name] = local
+		}
+		return local
+	}
+
+	var interactions []Interaction
+	for _, elem := range fetched {
+		if !strings.EqualFold(localName(elem.DrugA), drugname) {
+			continue
+		}
+		elem.DrugA = drugname
+		elem.DrugB = localName(elem.DrugB)
+		interactions = append(interactions, elem)
+	}
+
+	err = cfg.storeInteractions(db, ctx, cfg.UseSource, drugname, interactions)
+	if err != nil {
+		printName(printN, "Couldn't store interactions for:", drugname, "; error:", err)
+	}
+}
+
+// Returns the interaction between two substances, which must be the local
+// names. Nil is returned if there's none.
+func (cfg *Config) getInteraction(db *sql.DB, ctx context.Context,
+	drugA string, drugB string) (error, *Interaction) {
+	rows, err := db.QueryContext(ctx, "select drugA, drugB, risk, origin from "+interactionsTableName+
+		" where (drugA = ? and drugB = ?) or (drugA = ? and drugB = ?)", drugA, drugB, drugB, drugA)
+	if err != nil {
+		return err, nil
+	}
+	defer rows.Close()
+
+	var got *Interaction
+	for rows.Next() {
+		var tempInter Interaction
+		err = rows.Scan(&tempInter.DrugA, &tempInter.DrugB, &tempInter.Risk, &tempInter.Origin)
+		if err != nil {
+			return err, nil
+		}
+
+		if got == nil || got.Origin != LocalInteractionsOrigin &&
+			(tempInter.Origin == LocalInteractionsOrigin || tempInter.Risk > got.Risk) {
+			got = &tempInter
+		}
+	}
+
+	return rows.Err(), got
+}
+
+// GetInteraction returns the interaction between two substances. If it's
+// present in the config file, it's used, otherwise the highest risk from
+// the sources is used. Nil is returned if there's no information about
+// the pair, which doesn't mean it's safe!
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// drugA - the name of the first substance
+//
+// drugB - the name of the second substance
+func (cfg *Config) GetInteraction(db *sql.DB, ctx context.Context,
+	drugA string, drugB string) (error, *Interaction) {
+	const printN string = "GetInteraction()"
+
+	drugA = cfg.MatchAndReplace(db, ctx, drugA, NameTypeSubstance)
+	drugB = cfg.MatchAndReplace(db, ctx, drugB, NameTypeSubstance)
+
+	err, interaction := cfg.getInteraction(db, ctx, drugA, drugB)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	return nil, interaction
+}
+
+// Returns the longest maximum total duration of all substances in the info
+// table in seconds, no log can be active for longer than it.
+func (cfg *Config) longestTotalDur(db *sql.DB, ctx context.Context) (error, int64) {
+	const printN string = "longestTotalDur()"
+
+	rows, err := db.QueryContext(ctx, "select distinct totalDurMax, totalDurUnits from "+
+		cfg.UseSource+" where totalDurMax > 0")
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "db.QueryContext(): "), err), 0
+	}
+	defer rows.Close()
+
+	type totalDur struct {
+		max   float32
+		units string
+	}
+
+	var durs []totalDur
+	for rows.Next() {
+		var tempDur totalDur
+		err = rows.Scan(&tempDur.max, &tempDur.units)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN, "rows.Scan(): "), err), 0
+		}
+		durs = append(durs, tempDur)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "rows.Err(): "), err), 0
+	}
+	rows.Close()
+
+	var longest float32
+	for _, elem := range durs {
+		cfg.convertToSeconds(db, ctx, elem.units, &elem.max)
+		if elem.max > longest {
+			longest = elem.max
+		}
+	}
+
+	return nil, int64(longest)
+}
+
+// Returns the newest log of every substance, which is still active at
+// the given unix time, using the maximum total duration from the source.
+// Logs without a total duration are never active. Only the logs which
+// started or ended within the longest total duration before the time are
+// read, instead of the whole history of the user.
+func (cfg *Config) activeLogsAt(db *sql.DB, ctx context.Context,
+	username string, at int64) (error, []UserLog) {
+	const printN string = "activeLogsAt()"
+
+	err, longest := cfg.longestTotalDur(db, ctx)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	if longest == 0 {
+		return nil, nil
+	}
+
+	err, userLogs := cfg.getLogsBetween(db, ctx, username, at-longest, at)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	gotInfos := map[string]DrugInfo{}
+	seenDrugs := map[string]bool{}
+	var active []UserLog
+	for _, elem := range userLogs {
+		if seenDrugs[elem.DrugName] {
+			continue
+		}
+
+		key := elem.DrugName + "\x00" + elem.DrugRoute
+		info, exists := gotInfos[key]
+		if !exists {
+			err, gotInfo := cfg.getRouteInfo(db, ctx, elem.DrugName, elem.DrugRoute, username)
+			if err != nil {
+				printNameVerbose(cfg.VerbosePrinting, printN, "No info for log:", elem.ID, "; error:", err)
+			} else {
+				cfg.convertToSeconds(db, ctx, gotInfo.TotalDurUnits,
+					&gotInfo.TotalDurMin, &gotInfo.TotalDurMax)
+			}
+			info = gotInfo
+			gotInfos[key] = info
+		}
+
+		if logMaxEnd(elem, info) > at {
+			seenDrugs[elem.DrugName] = true
+			active = append(active, elem)
+		}
+	}
+
+	return nil, active
+}
+
+// Returns the warnings for all active logs which interact with the drug,
+// so that they can be added to ErrorInfo.Warnings.
+func (cfg *Config) activeInteractionWarnings(db *sql.DB, ctx context.Context,
+	username string, drug string, at int64) []error {
+	const printN string = "activeInteractionWarnings()"
+
+	err, activeLogs := cfg.activeLogsAt(db, ctx, username, at)
+	if err != nil {
+		printNameVerbose(cfg.VerbosePrinting, printN, "Couldn't get active logs:", err)
+		return nil
+	}
+
+	var warnings []error
+	for _, elem := range activeLogs {
+		if elem.DrugName == drug {
+			continue
+		}
+
+		err, interaction := cfg.getInteraction(db, ctx, drug, elem.DrugName)
+		if err != nil {
+			printNameVerbose(cfg.VerbosePrinting, printN, "Couldn't get interaction:", err)
+			continue
+		}
+
+		interWarn := interactionWarning(interaction, drug, elem)
+		if interWarn != nil {
+			warnings = append(warnings, interWarn)
+		}
+	}
+
+	return warnings
+}
+
+// Returns the warnings for every pair of different substances in the logs,
+// the logs must be the newest log of every substance.
+func (cfg *Config) pairInteractionWarnings(db *sql.DB, ctx context.Context, userLogs []UserLog) []error {
+	const printN string = "pairInteractionWarnings()"
+
+	sorted := make([]UserLog, len(userLogs))
+	copy(sorted, userLogs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime < sorted[j].StartTime
+	})
+
+	var warnings []error
+	for i := 0; i < len(sorted); i++ {
+		for o := i + 1; o < len(sorted); o++ {
+			if sorted[i].DrugName == sorted[o].DrugName {
+				continue
+			}
+
+			err, interaction := cfg.getInteraction(db, ctx, sorted[o].DrugName, sorted[i].DrugName)
+			if err != nil {
+				printNameVerbose(cfg.VerbosePrinting, printN, "Couldn't get interaction:", err)
+				continue
+			}
+
+			interWarn := interactionWarning(interaction, sorted[o].DrugName, sorted[i])
+			if interWarn != nil {
+				warnings = append(warnings, interWarn)
+			}
+		}
+	}
+
+	return warnings
+}
+
+// Returns the warning for an interaction of the drug with an active log,
+// nil is returned if there's no interaction or it's low risk.
+func interactionWarning(interaction *Interaction, drug string, activeLog UserLog) error {
+	if interaction == nil || interaction.Risk < InteractionCaution {
+		return nil
+	}
+
+	useErr := InteractionWarning
+	if interaction.Risk >= InteractionUnsafe {
+		useErr = DangerousInteractionWarning
+	}
+
+	return fmt.Errorf("%w: %s ; drug: %q ; active log: %d ; active drug: %q ; from: %s",
+		useErr, interaction.Risk, drug, activeLog.ID, activeLog.DrugName, interaction.Origin)
+}
+
+var InteractionWarning error = errors.New("the combination with an active log is rated as")
+var DangerousInteractionWarning error = errors.New("WARNING: the combination with an active log " +
+	"can cause serious harm, it's rated as")
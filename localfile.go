@@ -0,0 +1,368 @@
+package drugdose
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// The name of the local file source, used for UseSource in the settings file
+// and for the name of the info table.
+const LocalFileName string = "localfile"
+
+const ActionLoadLocalFileSource string = "loading from local file source completed"
+
+// LocalFileData is the layout of every file used by the local file source.
+// For TOML every substance is a [[Substance]] table, for JSON it's an object
+// with a "Substance" array. The names of the keys are the same as the
+// names of the fields in the DrugInfo struct, TimeOfFetch is ignored.
+type LocalFileData struct {
+	Substance []DrugInfo
+}
+
+// LocalFileSource implements the Source interface using local files instead
+// of a remote API, which is useful when there's no Internet connection.
+// The address set in the sources config file for this source is a path to
+// a single .toml or .json file or to a directory containing such files.
+type LocalFileSource struct {
+	path string
+	subs []DrugInfo
+}
+
+func initLocalFileSource(cfg *Config, srcCfg SourceConfig) (error, Source) {
+	const printN string = "initLocalFileSource()"
+
+	err, src := NewLocalFileSource(srcCfg.API_ADDRESS)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	printNameVerbose(cfg.VerbosePrinting, printN, "Loaded:", len(src.subs), "records from:", src.path)
+
+	return nil, src
+}
+
+// NewLocalFileSource reads and validates all substances from the given path.
+// All files are read at once, if any of them contains invalid data, an error
+// is returned and the source can't be used until the data is fixed.
+//
+// path - a single .toml or .json file or a directory containing such files,
+// files with other extensions in the directory are ignored
+func NewLocalFileSource(path string) (error, *LocalFileSource) {
+	const printN string = "NewLocalFileSource()"
+
+	if path == "" || path == "none" {
+		return fmt.Errorf("%s%w", sprintName(printN), LocalFilePathEmptyError), nil
+	}
+
+	fileInfo, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), LocalFileNoFilesError, path), nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	var files []string
+	if fileInfo.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err), nil
+		}
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if entry.IsDir() == false && (ext == ".toml" || ext == ".json") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+		sort.Strings(files)
+	} else {
+		files = append(files, path)
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), LocalFileNoFilesError, path), nil
+	}
+
+	src := LocalFileSource{
+		path: path,
+		subs: nil,
+	}
+
+	// Used to find the same substance and route in more than one place.
+	seen := map[string]string{}
+
+	for _, file := range files {
+		err, gotData := readLocalFileData(file)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err), nil
+		}
+
+		for i, sub := range gotData.Substance {
+			where := fmt.Sprintf("%s: Substance[%d] (%q ; %q)", file, i, sub.DrugName, sub.DrugRoute)
+
+			err = validateDrugInfo(sub)
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", sprintName(printN), where, err), nil
+			}
+
+			key := strings.ToLower(sub.DrugName) + "\x00" + strings.ToLower(sub.DrugRoute)
+			if prev, exists := seen[key]; exists {
+				return fmt.Errorf("%s%s: %w: %s", sprintName(printN), where,
+					LocalFileDuplicateError, prev), nil
+			}
+			seen[key] = where
+
+			sub.TimeOfFetch = 0
+			src.subs = append(src.subs, sub)
+		}
+	}
+
+	if len(src.subs) == 0 {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), StructSliceEmpty, path), nil
+	}
+
+	return nil, &src
+}
+
+func readLocalFileData(file string) (error, LocalFileData) {
+	const printN string = "readLocalFileData()"
+
+	gotData := LocalFileData{}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), gotData
+	}
+
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == ".json" {
+		err = json.Unmarshal(content, &gotData)
+		if err != nil {
+			return fmt.Errorf("%s%s: %w", sprintName(printN, "json.Unmarshal(): "), file, err), gotData
+		}
+	} else if ext == ".toml" {
+		err = toml.Unmarshal(content, &gotData)
+		if err != nil {
+			return fmt.Errorf("%s%s: %w", sprintName(printN, "toml.Unmarshal(): "), file, err), gotData
+		}
+	} else {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), LocalFileFormatError, file), gotData
+	}
+
+	return nil, gotData
+}
+
+// Check if the values in a DrugInfo struct make sense, so that they can be
+// used for the calculations done with the info table.
+func validateDrugInfo(sub DrugInfo) error {
+	if sub.DrugName == "" {
+		return fmt.Errorf("%w: %s", InvalidDrugInfoError, "empty DrugName")
+	}
+
+	if sub.DrugRoute == "" {
+		return fmt.Errorf("%w: %s", InvalidDrugInfoError, "empty DrugRoute")
+	}
+
+	if sub.DoseUnits == "" {
+		return fmt.Errorf("%w: %s", InvalidDrugInfoError, "empty DoseUnits")
+	}
+
+	type minMax struct {
+		name  string
+		min   float32
+		max   float32
+		units *string
+	}
+
+	doses := []minMax{
+		{"LowDose", sub.LowDoseMin, sub.LowDoseMax, nil},
+		{"MediumDose", sub.MediumDoseMin, sub.MediumDoseMax, nil},
+		{"HighDose", sub.HighDoseMin, sub.HighDoseMax, nil},
+		{"Onset", sub.OnsetMin, sub.OnsetMax, &sub.OnsetUnits},
+		{"ComeUp", sub.ComeUpMin, sub.ComeUpMax, &sub.ComeUpUnits},
+		{"Peak", sub.PeakMin, sub.PeakMax, &sub.PeakUnits},
+		{"Offset", sub.OffsetMin, sub.OffsetMax, &sub.OffsetUnits},
+		{"TotalDur", sub.TotalDurMin, sub.TotalDurMax, &sub.TotalDurUnits},
+	}
+
+	if sub.Threshold < 0 {
+		return fmt.Errorf("%w: %s", InvalidDrugInfoError, "negative Threshold")
+	}
+
+	for _, v := range doses {
+		if v.min < 0 || v.max < 0 {
+			return fmt.Errorf("%w: negative %s", InvalidDrugInfoError, v.name)
+		}
+
+		if v.max != 0 && v.min > v.max {
+			return fmt.Errorf("%w: %sMin is bigger than %sMax", InvalidDrugInfoError, v.name, v.name)
+		}
+
+		if v.units != nil && (v.min != 0 || v.max != 0) {
+			if *v.units != "minutes" && *v.units != "hours" {
+				return fmt.Errorf("%w: %sUnits must be \"minutes\" or \"hours\", got: %q",
+					InvalidDrugInfoError, v.name, *v.units)
+			}
+		}
+	}
+
+	if sub.TotalDurMax == 0 {
+		return fmt.Errorf("%w: %s", InvalidDrugInfoError, "TotalDurMax is not set")
+	}
+
+	return nil
+}
+
+// FetchSubstance returns all routes for a substance from the local files.
+// The name is matched without considering the case.
+//
+// ctx - not used, present to satisfy the Source interface
+//
+// drugname - the substance to get information about
+func (src *LocalFileSource) FetchSubstance(ctx context.Context, drugname string) (error, []DrugInfo) {
+	const printN string = "LocalFileSource.FetchSubstance()"
+
+	var infoDrug []DrugInfo
+	for _, sub := range src.subs {
+		if strings.EqualFold(sub.DrugName, drugname) {
+			infoDrug = append(infoDrug, sub)
+		}
+	}
+
+	if len(infoDrug) == 0 {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), LocalFileNoSubstanceError, drugname), nil
+	}
+
+	return nil, infoDrug
+}
+
+// Routes returns the names of all routes present in the local files for
+// a given substance.
+//
+// ctx - not used, present to satisfy the Source interface
+//
+// drugname - the substance to get the routes for
+func (src *LocalFileSource) Routes(ctx context.Context, drugname string) (error, []string) {
+	const printN string = "LocalFileSource.Routes()"
+
+	err, infoDrug := src.FetchSubstance(ctx, drugname)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	var routes []string
+	for i := 0; i < len(infoDrug); i++ {
+		routes = append(routes, infoDrug[i].DrugRoute)
+	}
+
+	return nil, routes
+}
+
+// Describe returns a short description of the local file source.
+func (src *LocalFileSource) Describe() string {
+	return fmt.Sprintf("Local files at: %s ; records: %d", src.path, len(src.subs))
+}
+
+// Substances returns a copy of all records read from the local files.
+func (src *LocalFileSource) Substances() []DrugInfo {
+	subs := make([]DrugInfo, len(src.subs))
+	copy(subs, src.subs)
+	return subs
+}
+
+// LoadLocalFileSource adds all substances from the local file source to
+// the currently configured info table. Substances already present in the
+// table are skipped, checkout RemoveSingleDrugInfo() if they need to be
+// replaced.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// errChannel - the gorouting channel which returns the errors
+// (set to nil if function doesn't need to be concurrent)
+//
+// src - the source returned by NewLocalFileSource() or InitSource()
+//
+// username - the user requesting the load
+func (cfg *Config) LoadLocalFileSource(db *sql.DB, ctx context.Context,
+	errChannel chan<- ErrorInfo, src *LocalFileSource, username string) ErrorInfo {
+	const printN string = "LoadLocalFileSource()"
+
+	tempErrInfo := ErrorInfo{
+		Err:      nil,
+		Action:   ActionLoadLocalFileSource,
+		Username: username,
+	}
+
+	if src == nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w: %s", sprintName(printN), NoValidSourceSel, LocalFileName)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	var addSubs []DrugInfo
+	skipped := map[string]bool{}
+	for _, sub := range src.subs {
+		if skipped[strings.ToLower(sub.DrugName)] {
+			continue
+		}
+
+		ret := checkIfExistsDB(db, ctx,
+			"drugName",
+			cfg.UseSource,
+			cfg.DBDriver,
+			cfg.DBSettings[cfg.DBDriver].Path,
+			nil,
+			sub.DrugName)
+		if ret {
+			printNameVerbose(cfg.VerbosePrinting, printN, "Already in info table, skipping:", sub.DrugName)
+			skipped[strings.ToLower(sub.DrugName)] = true
+			continue
+		}
+
+		addSubs = append(addSubs, sub)
+	}
+
+	if len(addSubs) == 0 {
+		printName(printN, "Nothing new to add from:", src.path)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	gotErrInfo := cfg.AddToInfoTable(db, ctx, nil, addSubs, username)
+	if gotErrInfo.Err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), gotErrInfo.Err)
+		if errChannel != nil {
+			errChannel <- tempErrInfo
+		}
+		return tempErrInfo
+	}
+
+	printName(printN, "Added:", len(addSubs), "records from:", src.path, "; to info table:", cfg.UseSource)
+
+	if errChannel != nil {
+		errChannel <- tempErrInfo
+	}
+	return tempErrInfo
+}
+
+var LocalFilePathEmptyError error = errors.New("the path for the local file source is empty")
+var LocalFileNoFilesError error = errors.New("no .toml or .json files found for the local file source")
+var LocalFileFormatError error = errors.New("the local file source only supports .toml and .json files")
+var LocalFileDuplicateError error = errors.New("the same substance and route is already present at")
+var LocalFileNoSubstanceError error = errors.New("substance not present in the local file source")
+var InvalidDrugInfoError error = errors.New("invalid drug info")
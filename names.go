@@ -89,6 +89,27 @@ func GetNamesConfig(nameType string, source string) (error, *SubstanceName) {
 	return nil, &subName
 }
 
+// Reads a config file from the source specific names directory and if it
+// doesn't exist there, from the global names directory.
+func readSourceOrGlobalConfig(filename string, source string) (error, []byte) {
+	err, setdir := InitSettingsDir()
+	if err != nil {
+		return err, nil
+	}
+
+	path := setdir + "/" + allNamesConfigsDir + "/" + sourceNamesDir + "/" + source + "/" + filename
+	file, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		path = setdir + "/" + allNamesConfigsDir + "/" + filename
+		file, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err, nil
+	}
+
+	return nil, file
+}
+
 func namesTables(nameType string) (error, string) {
 	const printN string = "namesTables()"
 
@@ -218,7 +239,8 @@ func (cfg *Config) AddToNamesTable(db *sql.DB, ctx context.Context,
 	return nil
 }
 
-// Calls AddToNamesTable() for all nameType.
+// Calls AddToNamesTable() for all nameType, AddToCrossToleranceTable() and
+// AddToInteractionsTable().
 //
 // overwrite - force overwrite of tables, it will not remove
 // the old config files, that must be done manually, if they're not removed
@@ -259,6 +281,16 @@ func (cfg *Config) AddToAllNamesTables(db *sql.DB, ctx context.Context,
 		}
 	}
 
+	err := cfg.AddToCrossToleranceTable(db, ctx)
+	if err != nil && errors.Is(err, fs.ErrNotExist) == false {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = cfg.AddToInteractionsTable(db, ctx, overwrite)
+	if err != nil && errors.Is(err, fs.ErrNotExist) == false {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,176 @@
+package drugdose
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// The name under which the PostgreSQL wrapper driver is registered for the
+// sql module. The user only needs to set DBDriver to PostgresDriver, this
+// name is used internally when opening a connection.
+const postgresSQLDriver string = "gpd-postgres"
+
+// The collation used for case insensitive columns in PostgreSQL. It's created
+// by InitAllDBTables() if it doesn't exist. It needs PostgreSQL 12 or newer
+// built with ICU support.
+const postgresNoCase string = "gpd_nocase"
+
+func init() {
+	sql.Register(postgresSQLDriver, postgresDriver{})
+}
+
+// All queries in this package use "?" for placeholders, which PostgreSQL
+// doesn't understand. This driver wraps the lib/pq driver and rewrites the
+// placeholders to "$1", "$2" and etc. before the queries reach the server.
+type postgresDriver struct{}
+
+func (d postgresDriver) Open(name string) (driver.Conn, error) {
+	conn, err := pq.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &postgresConn{conn}, nil
+}
+
+type postgresConn struct {
+	driver.Conn
+}
+
+func (c *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rewritePlaceholders(query))
+}
+
+func (c *postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return pc.PrepareContext(ctx, rewritePlaceholders(query))
+	}
+	return c.Prepare(query)
+}
+
+func (c *postgresConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return bc.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *postgresConn) QueryContext(ctx context.Context, query string,
+	args []driver.NamedValue) (driver.Rows, error) {
+	if qc, ok := c.Conn.(driver.QueryerContext); ok {
+		return qc.QueryContext(ctx, rewritePlaceholders(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *postgresConn) ExecContext(ctx context.Context, query string,
+	args []driver.NamedValue) (driver.Result, error) {
+	if ec, ok := c.Conn.(driver.ExecerContext); ok {
+		return ec.ExecContext(ctx, rewritePlaceholders(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *postgresConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *postgresConn) ResetSession(ctx context.Context) error {
+	if sr, ok := c.Conn.(driver.SessionResetter); ok {
+		return sr.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *postgresConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// Replace every "?" placeholder with "$1", "$2" and etc. Question marks
+// inside of quoted strings and identifiers are left as they are.
+func rewritePlaceholders(query string) string {
+	if strings.IndexByte(query, '?') == -1 {
+		return query
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(query) + 16)
+
+	var quote byte
+	count := 0
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			sb.WriteByte(ch)
+			continue
+		}
+
+		switch ch {
+		case '\'', '"':
+			quote = ch
+			sb.WriteByte(ch)
+		case '?':
+			count++
+			sb.WriteString("$" + strconv.Itoa(count))
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+
+	return sb.String()
+}
+
+// Returns the name of the driver registered for the sql module, which is
+// the same as DBDriver, except for PostgreSQL.
+func (cfg *Config) sqlDriverName() string {
+	if cfg.DBDriver == PostgresDriver {
+		return postgresSQLDriver
+	}
+	return cfg.DBDriver
+}
+
+// Returns the collation to use for all case insensitive columns,
+// depending on the configured driver.
+func (cfg *Config) caseInsensitive() string {
+	if cfg.DBDriver == SqliteDriver {
+		return " COLLATE NOCASE "
+	} else if cfg.DBDriver == PostgresDriver {
+		return " COLLATE " + postgresNoCase + " "
+	}
+	// MySQL/MariaDB is case insensitive by default.
+	return " "
+}
+
+// Returns a case insensitive "like" comparison with a placeholder for
+// the given column. PostgreSQL doesn't support "like" with nondeterministic
+// collations and doesn't cast numbers to text automatically.
+func (cfg *Config) likeStmt(col string) string {
+	if cfg.DBDriver == PostgresDriver {
+		return "cast(" + col + " as text) collate \"default\" ilike ?"
+	}
+	return col + " like ?"
+}
+
+// Creates the collation used for case insensitive columns in PostgreSQL.
+func (cfg *Config) initPostgresCollation(db *sql.DB, ctx context.Context) error {
+	if cfg.DBDriver != PostgresDriver {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, "create collation if not exists "+postgresNoCase+
+		" (provider = icu, locale = 'und-u-ks-level2', deterministic = false)")
+	return err
+}
@@ -0,0 +1,240 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+// The valid values for the sex of the user, used for estimating
+// the blood alcohol concentration.
+const SexMale string = "male"
+const SexFemale string = "female"
+
+// The local name of alcohol, the same as in the units conversions config.
+const alcoholDrugName string = "Alcohol"
+
+// The weight for which the dose ranges of the sources are meant,
+// checkout ScaleDoseRanges().
+const referenceWeightKg float32 = 70
+
+// How much the blood alcohol concentration drops every hour, in percent.
+const alcoholEliminationPerHour float64 = 0.015
+
+// UserProfile is the body of the user, stored in the user preferences,
+// checkout SetUserPref(). Values which are 0 or empty aren't set.
+type UserProfile struct {
+	WeightKg float32
+	HeightCm float32
+	Age      int
+	// SexMale, SexFemale or empty
+	Sex string
+	// If true, the dose ranges are scaled using the weight,
+	// checkout ScaleDoseRanges()
+	ScalePerKg bool
+}
+
+type UserProfileError struct {
+	Profile  *UserProfile
+	Username string
+	Err      error
+}
+
+// GetUserProfile returns the profile of a user from the user preferences.
+// If the user has no preferences, an empty profile is returned.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// profileErrChan - the goroutine channel which returns the profile
+// and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to get the profile
+func (cfg *Config) GetUserProfile(db *sql.DB, ctx context.Context,
+	profileErrChan chan<- UserProfileError, username string) UserProfileError {
+	const printN string = "GetUserProfile()"
+
+	tempProfileErr := UserProfileError{
+		Profile:  nil,
+		Username: username,
+		Err:      nil,
+	}
+
+	err, prefs := cfg.getUserPrefs(db, ctx, username)
+	if err != nil {
+		tempProfileErr.Err = fmt.Errorf("%s%w", sprintName(printN), err)
+		if profileErrChan != nil {
+			profileErrChan <- tempProfileErr
+		}
+		return tempProfileErr
+	}
+
+	// The values are checked when set, so they can be parsed without errors.
+	profile := UserProfile{}
+	for _, elem := range prefs {
+		if elem.IsDefault {
+			continue
+		}
+		switch elem.Key {
+		case PrefWeight:
+			weight, _ := strconv.ParseFloat(elem.Value, 32)
+			profile.WeightKg = float32(weight)
+		case PrefHeight:
+			height, _ := strconv.ParseFloat(elem.Value, 32)
+			profile.HeightCm = float32(height)
+		case PrefAge:
+			profile.Age, _ = strconv.Atoi(elem.Value)
+		case PrefSex:
+			profile.Sex = elem.Value
+		case PrefScalePerKg:
+			profile.ScalePerKg, _ = strconv.ParseBool(elem.Value)
+		}
+	}
+
+	tempProfileErr.Profile = &profile
+	if profileErrChan != nil {
+		profileErrChan <- tempProfileErr
+	}
+	return tempProfileErr
+}
+
+// ScaleDoseRanges returns the info with all dose ranges scaled using
+// the weight, compared to a reference weight of 70 kg. This is only
+// a rough adjustment, most substances don't scale linearly with weight.
+//
+// info - the information for the drug and route
+//
+// weightKg - the weight of the user, if 0 nothing is scaled
+func ScaleDoseRanges(info DrugInfo, weightKg float32) DrugInfo {
+	if weightKg <= 0 {
+		return info
+	}
+
+	scale := weightKg / referenceWeightKg
+	info.Threshold *= scale
+	info.LowDoseMin *= scale
+	info.LowDoseMax *= scale
+	info.MediumDoseMin *= scale
+	info.MediumDoseMax *= scale
+	info.HighDoseMin *= scale
+	info.HighDoseMax *= scale
+
+	return info
+}
+
+// Returns the info with the dose ranges scaled using the weight of the user,
+// if it's enabled in the profile of the user.
+func (cfg *Config) userDoseRanges(db *sql.DB, ctx context.Context,
+	username string, info DrugInfo) DrugInfo {
+	const printN string = "userDoseRanges()"
+
+	gotProfileErr := cfg.GetUserProfile(db, ctx, nil, username)
+	if gotProfileErr.Err != nil {
+		printNameVerbose(cfg.VerbosePrinting, printN, gotProfileErr.Err)
+		return info
+	}
+
+	if !gotProfileErr.Profile.ScalePerKg {
+		return info
+	}
+
+	return ScaleDoseRanges(info, gotProfileErr.Profile.WeightKg)
+}
+
+// WidmarkFactor returns the ratio of the alcohol in the body to the alcohol
+// in the blood, used in the Widmark formula. When the height is known,
+// it's calculated from the total body water using the Watson formula, which
+// for men needs the age too. Otherwise the constants from Widmark are used,
+// 0.68 for men and 0.55 for women, if the sex isn't known, the average.
+//
+// profile - the profile of the user
+func WidmarkFactor(profile UserProfile) float64 {
+	weight := float64(profile.WeightKg)
+	height := float64(profile.HeightCm)
+	age := float64(profile.Age)
+
+	if weight > 0 && height > 0 {
+		var bodyWater float64
+		if profile.Sex == SexMale && age > 0 {
+			bodyWater = 2.447 - 0.09516*age + 0.1074*height + 0.3362*weight
+		} else if profile.Sex == SexFemale {
+			bodyWater = -2.097 + 0.1069*height + 0.2466*weight
+		}
+		if bodyWater > 0 {
+			// Blood is about 80% water.
+			return bodyWater / (0.8 * weight)
+		}
+	}
+
+	if profile.Sex == SexMale {
+		return 0.68
+	} else if profile.Sex == SexFemale {
+		return 0.55
+	}
+	return (0.68 + 0.55) / 2
+}
+
+// EstimateBAC returns the blood alcohol concentration in percent
+// (grams per 100 ml), using the Widmark formula. It's the same as
+// the per mille value divided by 10.
+//
+// profile - the profile of the user, the weight must be set
+//
+// grams - the amount of pure alcohol, checkout convMl2Grams()
+//
+// hours - the hours since the alcohol was taken, the concentration drops
+// by 0.015% every hour, if 0 the highest possible concentration is returned
+func EstimateBAC(profile UserProfile, grams float32, hours float64) (error, float64) {
+	const printN string = "EstimateBAC()"
+
+	if profile.WeightKg <= 0 {
+		return fmt.Errorf("%s%w", sprintName(printN), NoWeightError), 0
+	}
+
+	bac := float64(grams)/(WidmarkFactor(profile)*float64(profile.WeightKg)*1000)*100 -
+		alcoholEliminationPerHour*hours
+	if bac < 0 {
+		bac = 0
+	}
+
+	return nil, bac
+}
+
+// Returns the estimate for a dose of alcohol, so that it can be added to
+// ErrorInfo.Warnings, nil is returned if it's not alcohol in grams or
+// the weight of the user isn't known.
+func (cfg *Config) bacWarning(db *sql.DB, ctx context.Context, username string,
+	drug string, dose float32, units string) error {
+	const printN string = "bacWarning()"
+
+	if drug != alcoholDrugName || units != "g" {
+		return nil
+	}
+
+	gotProfileErr := cfg.GetUserProfile(db, ctx, nil, username)
+	if gotProfileErr.Err != nil {
+		printNameVerbose(cfg.VerbosePrinting, printN, gotProfileErr.Err)
+		return nil
+	}
+
+	err, bac := EstimateBAC(*gotProfileErr.Profile, dose, 0)
+	if err != nil {
+		printNameVerbose(cfg.VerbosePrinting, printN, err)
+		return nil
+	}
+
+	return fmt.Errorf("%w: %.3f%% ; from: %g g", BACEstimateWarning, bac, dose)
+}
+
+var NoWeightError error = errors.New("the weight of the user isn't set")
+var BACEstimateWarning error = errors.New("estimated highest blood alcohol concentration " +
+	"from this dose alone")
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"reflect"
 	"time"
 
 	"github.com/hasura/go-graphql-client"
@@ -75,6 +76,62 @@ type PsychonautwikiSubstance []struct {
 	}
 }
 
+type PsychonautwikiInteractions []struct {
+	Name string
+
+	DangerousInteractions []struct {
+		Name string
+	}
+
+	UnsafeInteractions []struct {
+		Name string
+	}
+
+	UncertainInteractions []struct {
+		Name string
+	}
+}
+
+// The name of the source, used for UseSource in the settings file and for
+// the name of the info table.
+const PsychonautwikiName string = "psychonautwiki"
+
+// PsychonautwikiSource implements the Source interface using the
+// Psychonautwiki GraphQL API. Use InitSource() when Psychonautwiki is the
+// configured source or NewPsychonautwikiSource() if the client has to be
+// created manually.
+type PsychonautwikiSource struct {
+	cfg     *Config
+	client  graphql.Client
+	address string
+}
+
+// NewPsychonautwikiSource returns the Psychonautwiki source using an already
+// initialised GraphQL client.
+//
+// client - the initialised structure for the graphql client,
+// best done using InitGraphqlClient(), but can be done manually if needed
+func (cfg *Config) NewPsychonautwikiSource(client graphql.Client) *PsychonautwikiSource {
+	return &PsychonautwikiSource{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+func initPsychonautwikiSource(cfg *Config, srcCfg SourceConfig) (error, Source) {
+	const printN string = "initPsychonautwikiSource()"
+
+	err, client := cfg.newGraphqlClient(srcCfg.API_ADDRESS)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	src := cfg.NewPsychonautwikiSource(client)
+	src.address = srcCfg.API_ADDRESS
+
+	return nil, src
+}
+
 // Used to initialise the GraphQL struct, using the source address from
 // the drugdose Config struct.
 //
@@ -82,13 +139,22 @@ type PsychonautwikiSubstance []struct {
 func (cfg *Config) InitGraphqlClient() (error, graphql.Client) {
 	const printN string = "InitGraphqlClient()"
 
-	client := graphql.Client{}
-
-	if !cfg.AutoFetch {
-		printNameVerbose(cfg.VerbosePrinting, printN, "Automatic fetching is disabled, returning.")
-		return nil, client
+	gotsrcData := GetSourceData()
+	if gotsrcData == nil {
+		return errors.New(sprintName(printN, "GetSourceData() returned nil, returning.")), graphql.Client{}
 	}
 
+	return cfg.newGraphqlClient(gotsrcData[cfg.UseSource].API_ADDRESS)
+}
+
+func (cfg *Config) newGraphqlClient(api string) (error, graphql.Client) {
+	const printN string = "newGraphqlClient()"
+
+	client := graphql.Client{}
+
+	// The client is always created, even when AutoFetch is disabled, since
+	// the source can still be used explicitly, for example by RefreshInfo().
+	// Only FetchFromSource() checks AutoFetch.
 	var proxy func(*http.Request) (*url.URL, error) = nil
 	if cfg.ProxyURL != "" && cfg.ProxyURL != "none" {
 		goturl, err := url.Parse(cfg.ProxyURL)
@@ -109,21 +175,197 @@ func (cfg *Config) InitGraphqlClient() (error, graphql.Client) {
 	httpClient := http.Client{
 		Transport: CustomTransport,
 	}
-	gotsrcData := GetSourceData()
-	if gotsrcData == nil {
-		return errors.New(sprintName(printN, "GetSourceData() returned nil, returning.")), client
-	}
-	api := gotsrcData[cfg.UseSource].API_ADDRESS
 	apiURL := "https://" + api
 	client_new := graphql.NewClient(apiURL, &httpClient)
 	return nil, *client_new
 }
 
+// Returns an error if the client was never initialised, for example when
+// the source was created using an empty graphql.Client{}, since querying
+// with it would panic.
+func (src *PsychonautwikiSource) checkClient() error {
+	if reflect.ValueOf(src.client).IsZero() {
+		return PsychonautwikiNoClientError
+	}
+	return nil
+}
+
+// FetchSubstance queries Psychonautwiki for a given substance and returns
+// the information for all routes. Nothing is stored in the database,
+// checkout FetchFromSource() for that.
+//
+// ctx - context to be passed to the query
+//
+// drugname - the substance to get information about
+func (src *PsychonautwikiSource) FetchSubstance(ctx context.Context, drugname string) (error, []DrugInfo) {
+	const printN string = "PsychonautwikiSource.FetchSubstance()"
+
+	verbose := false
+	if src.cfg != nil {
+		verbose = src.cfg.VerbosePrinting
+	}
+
+	// This is the graphql query for Psychonautwiki.
+	// The way it works is, the full query is generated
+	// using the PsychonautwikiSubstance struct.
+	var query struct {
+		PsychonautwikiSubstance `graphql:"substances(query: $dn)"`
+	}
+
+	// Since the query has to be a string, the module has provided
+	// an argument allowing to map a variable to the string.
+	variables := map[string]interface{}{
+		"dn": drugname,
+	}
+
+	err := src.checkClient()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	err = src.client.Query(ctx, &query, variables)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "client.Query(): "), err), nil
+	}
+
+	if len(query.PsychonautwikiSubstance) == 0 {
+		return fmt.Errorf("%s%w", sprintName(printN), PsychonautwikiEmptyResp), nil
+	}
+
+	InfoDrug := []DrugInfo{}
+
+	subs := query.PsychonautwikiSubstance
+	for i := 0; i < len(subs); i++ {
+		if len(subs[i].Roas) == 0 {
+			return fmt.Errorf("%s%w: %+v", sprintName(printN), NoROAForSubs, subs[i]), nil
+		}
+
+		for o := 0; o < len(subs[i].Roas); o++ {
+			printNameVerbose(verbose, printN, "From source:", PsychonautwikiName, "; Substance:", subs[i].Name,
+				"; Route:", subs[i].Roas[o])
+
+			tempInfoDrug := DrugInfo{}
+
+			tempInfoDrug.DrugName = subs[i].Name
+			tempInfoDrug.DrugRoute = subs[i].Roas[o].Name
+			tempInfoDrug.Threshold = float32(subs[i].Roas[o].Dose.Threshold)
+			tempInfoDrug.LowDoseMin = float32(subs[i].Roas[o].Dose.Light.Min)
+			tempInfoDrug.LowDoseMax = float32(subs[i].Roas[o].Dose.Light.Max)
+			tempInfoDrug.MediumDoseMin = float32(subs[i].Roas[o].Dose.Common.Min)
+			tempInfoDrug.MediumDoseMax = float32(subs[i].Roas[o].Dose.Common.Max)
+			tempInfoDrug.HighDoseMin = float32(subs[i].Roas[o].Dose.Strong.Min)
+			tempInfoDrug.HighDoseMax = float32(subs[i].Roas[o].Dose.Strong.Max)
+			tempInfoDrug.DoseUnits = subs[i].Roas[o].Dose.Units
+			tempInfoDrug.OnsetMin = float32(subs[i].Roas[o].Duration.Onset.Min)
+			tempInfoDrug.OnsetMax = float32(subs[i].Roas[o].Duration.Onset.Max)
+			tempInfoDrug.OnsetUnits = subs[i].Roas[o].Duration.Onset.Units
+			tempInfoDrug.ComeUpMin = float32(subs[i].Roas[o].Duration.Comeup.Min)
+			tempInfoDrug.ComeUpMax = float32(subs[i].Roas[o].Duration.Comeup.Max)
+			tempInfoDrug.ComeUpUnits = subs[i].Roas[o].Duration.Comeup.Units
+			tempInfoDrug.PeakMin = float32(subs[i].Roas[o].Duration.Peak.Min)
+			tempInfoDrug.PeakMax = float32(subs[i].Roas[o].Duration.Peak.Max)
+			tempInfoDrug.PeakUnits = subs[i].Roas[o].Duration.Peak.Units
+			tempInfoDrug.OffsetMin = float32(subs[i].Roas[o].Duration.Offset.Min)
+			tempInfoDrug.OffsetMax = float32(subs[i].Roas[o].Duration.Offset.Max)
+			tempInfoDrug.OffsetUnits = subs[i].Roas[o].Duration.Offset.Units
+			tempInfoDrug.TotalDurMin = float32(subs[i].Roas[o].Duration.Total.Min)
+			tempInfoDrug.TotalDurMax = float32(subs[i].Roas[o].Duration.Total.Max)
+			tempInfoDrug.TotalDurUnits = subs[i].Roas[o].Duration.Total.Units
+
+			InfoDrug = append(InfoDrug, tempInfoDrug)
+		}
+	}
+
+	return nil, InfoDrug
+}
+
+// Routes returns the names of all routes Psychonautwiki has information about
+// for a given substance.
+//
+// ctx - context to be passed to the query
+//
+// drugname - the substance to get the routes for
+func (src *PsychonautwikiSource) Routes(ctx context.Context, drugname string) (error, []string) {
+	const printN string = "PsychonautwikiSource.Routes()"
+
+	err, infoDrug := src.FetchSubstance(ctx, drugname)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	var routes []string
+	for i := 0; i < len(infoDrug); i++ {
+		routes = append(routes, infoDrug[i].DrugRoute)
+	}
+
+	return nil, routes
+}
+
+// FetchInteractions queries Psychonautwiki for the interactions of a given
+// substance. Psychonautwiki rates them as dangerous, unsafe or uncertain,
+// uncertain is stored as InteractionCaution.
+//
+// ctx - context to be passed to the query
+//
+// drugname - the substance to get the interactions for
+func (src *PsychonautwikiSource) FetchInteractions(ctx context.Context, drugname string) (error, []Interaction) {
+	const printN string = "PsychonautwikiSource.FetchInteractions()"
+
+	var query struct {
+		PsychonautwikiInteractions `graphql:"substances(query: $dn)"`
+	}
+
+	variables := map[string]interface{}{
+		"dn": drugname,
+	}
+
+	err := src.checkClient()
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	err = src.client.Query(ctx, &query, variables)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "client.Query(): "), err), nil
+	}
+
+	if len(query.PsychonautwikiInteractions) == 0 {
+		return fmt.Errorf("%s%w", sprintName(printN), PsychonautwikiEmptyResp), nil
+	}
+
+	var interactions []Interaction
+	for _, subs := range query.PsychonautwikiInteractions {
+		for _, elem := range subs.DangerousInteractions {
+			interactions = append(interactions, Interaction{subs.Name, elem.Name, InteractionDangerous, PsychonautwikiName})
+		}
+		for _, elem := range subs.UnsafeInteractions {
+			interactions = append(interactions, Interaction{subs.Name, elem.Name, InteractionUnsafe, PsychonautwikiName})
+		}
+		for _, elem := range subs.UncertainInteractions {
+			interactions = append(interactions, Interaction{subs.Name, elem.Name, InteractionCaution, PsychonautwikiName})
+		}
+	}
+
+	return nil, interactions
+}
+
+// Describe returns a short description of the Psychonautwiki source.
+func (src *PsychonautwikiSource) Describe() string {
+	address := src.address
+	if address == "" {
+		address = PsychonautwikiAddress
+	}
+	return "Psychonautwiki GraphQL API at: https://" + address
+}
+
 // FetchPsyWiki gets information from Psychonautwiki about a given substance
 // and stores it in the local info table. The table is determined by the
 // source chosen in the Config struct. The name of the table is the same as the
 // name of the source, in this case "psychonautwiki".
 //
+// It's the same as using FetchFromSource() with the source returned by
+// NewPsychonautwikiSource().
+//
 // db - open database connection
 //
 // ctx - context to be passed to sql queries
@@ -148,131 +390,9 @@ func (cfg *Config) FetchPsyWiki(db *sql.DB, ctx context.Context,
 		Username: username,
 	}
 
-	if !cfg.AutoFetch {
-		printNameVerbose(cfg.VerbosePrinting, printN, "Automatic fetching is disabled, returning.")
-		if errChannel != nil {
-			errChannel <- tempErrInfo
-		}
-		return tempErrInfo
-	}
-
-	drugname = cfg.MatchAndReplace(db, ctx, drugname, NameTypeSubstance)
-
-	ret := checkIfExistsDB(db, ctx,
-		"drugName",
-		"psychonautwiki",
-		cfg.DBDriver,
-		cfg.DBSettings[cfg.DBDriver].Path,
-		nil,
-		drugname)
-	if ret {
-		printNameVerbose(cfg.VerbosePrinting, printN, "Drug already in DB, returning. No need to fetch anything from Psychonautwiki.")
-		if errChannel != nil {
-			errChannel <- tempErrInfo
-		}
-		return tempErrInfo
-	}
-
-	xtraTxt := ""
-	if cfg.ProxyURL != "" && cfg.ProxyURL != "none" {
-		xtraTxt += " ; configured proxy: " + fmt.Sprintf("%q", cfg.ProxyURL)
-	}
-	printNameF(printN, "Fetching from source: %q ; substance: %q%s\n", cfg.UseSource, drugname, xtraTxt)
-
-	// This is the graphql query for Psychonautwiki.
-	// The way it works is, the full query is generated
-	// using the PsychonautwikiSubstance struct.
-	var query struct {
-		PsychonautwikiSubstance `graphql:"substances(query: $dn)"`
-	}
-
-	// Since the query has to be a string, the module has provided
-	// an argument allowing to map a variable to the string.
-	variables := map[string]interface{}{
-		"dn": drugname,
-	}
-
-	err := client.Query(ctx, &query, variables)
-	if err != nil {
-		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN, "client.Query(): "), err)
-		if errChannel != nil {
-			errChannel <- tempErrInfo
-		}
-		return tempErrInfo
-	}
-
-	InfoDrug := []DrugInfo{}
-
-	if len(query.PsychonautwikiSubstance) != 0 {
-		subs := query.PsychonautwikiSubstance
-		for i := 0; i < len(subs); i++ {
-			if len(subs[i].Roas) != 0 {
-				for o := 0; o < len(subs[i].Roas); o++ {
-					printNameVerbose(cfg.VerbosePrinting, printN, "From source:", cfg.UseSource, "; Substance:", subs[i].Name,
-						"; Route:", subs[i].Roas[o])
-
-					tempInfoDrug := DrugInfo{}
-
-					tempInfoDrug.DrugName = subs[i].Name
-					tempInfoDrug.DrugRoute = subs[i].Roas[o].Name
-					tempInfoDrug.Threshold = float32(subs[i].Roas[o].Dose.Threshold)
-					tempInfoDrug.LowDoseMin = float32(subs[i].Roas[o].Dose.Light.Min)
-					tempInfoDrug.LowDoseMax = float32(subs[i].Roas[o].Dose.Light.Max)
-					tempInfoDrug.MediumDoseMin = float32(subs[i].Roas[o].Dose.Common.Min)
-					tempInfoDrug.MediumDoseMax = float32(subs[i].Roas[o].Dose.Common.Max)
-					tempInfoDrug.HighDoseMin = float32(subs[i].Roas[o].Dose.Strong.Min)
-					tempInfoDrug.HighDoseMax = float32(subs[i].Roas[o].Dose.Strong.Max)
-					tempInfoDrug.DoseUnits = subs[i].Roas[o].Dose.Units
-					tempInfoDrug.OnsetMin = float32(subs[i].Roas[o].Duration.Onset.Min)
-					tempInfoDrug.OnsetMax = float32(subs[i].Roas[o].Duration.Onset.Max)
-					tempInfoDrug.OnsetUnits = subs[i].Roas[o].Duration.Onset.Units
-					tempInfoDrug.ComeUpMin = float32(subs[i].Roas[o].Duration.Comeup.Min)
-					tempInfoDrug.ComeUpMax = float32(subs[i].Roas[o].Duration.Comeup.Max)
-					tempInfoDrug.ComeUpUnits = subs[i].Roas[o].Duration.Comeup.Units
-					tempInfoDrug.PeakMin = float32(subs[i].Roas[o].Duration.Peak.Min)
-					tempInfoDrug.PeakMax = float32(subs[i].Roas[o].Duration.Peak.Max)
-					tempInfoDrug.PeakUnits = subs[i].Roas[o].Duration.Peak.Units
-					tempInfoDrug.OffsetMin = float32(subs[i].Roas[o].Duration.Offset.Min)
-					tempInfoDrug.OffsetMax = float32(subs[i].Roas[o].Duration.Offset.Max)
-					tempInfoDrug.OffsetUnits = subs[i].Roas[o].Duration.Offset.Units
-					tempInfoDrug.TotalDurMin = float32(subs[i].Roas[o].Duration.Total.Min)
-					tempInfoDrug.TotalDurMax = float32(subs[i].Roas[o].Duration.Total.Max)
-					tempInfoDrug.TotalDurUnits = subs[i].Roas[o].Duration.Total.Units
-
-					InfoDrug = append(InfoDrug, tempInfoDrug)
-				}
-			} else {
-				tempErrInfo.Err = fmt.Errorf("%s%w: %+v", sprintName(printN), NoROAForSubs, subs[i])
-				if errChannel != nil {
-					errChannel <- tempErrInfo
-				}
-				return tempErrInfo
-			}
-		}
-
-		if len(InfoDrug) != 0 {
-			errInfo := cfg.AddToInfoTable(db, ctx, nil, InfoDrug, username)
-			err := errInfo.Err
-			if err != nil {
-				tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), err)
-				if errChannel != nil {
-					errChannel <- tempErrInfo
-				}
-				return tempErrInfo
-			}
-		} else {
-			tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), StructSliceEmpty)
-			if errChannel != nil {
-				errChannel <- tempErrInfo
-			}
-			return tempErrInfo
-		}
-	} else {
-		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), PsychonautwikiEmptyResp)
-		if errChannel != nil {
-			errChannel <- tempErrInfo
-		}
-		return tempErrInfo
+	gotErrInfo := cfg.FetchFromSource(db, ctx, nil, drugname, username, cfg.NewPsychonautwikiSource(client))
+	if gotErrInfo.Err != nil {
+		tempErrInfo.Err = fmt.Errorf("%s%w", sprintName(printN), gotErrInfo.Err)
 	}
 
 	if errChannel != nil {
@@ -288,3 +408,5 @@ var NoROAForSubs error = errors.New("no route of administration for substance")
 var StructSliceEmpty error = errors.New("struct slice is empty, nothing added to DB")
 
 var PsychonautwikiEmptyResp error = errors.New("Psychonautwiki returned nothing")
+
+var PsychonautwikiNoClientError error = errors.New("the GraphQL client for Psychonautwiki isn't initialised")
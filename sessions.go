@@ -0,0 +1,238 @@
+package drugdose
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+// DoseSession is a group of logs with the same drug, route and units,
+// where every log was taken before the previous ones have ended,
+// so every log after the first one is a redose.
+type DoseSession struct {
+	DrugName  string
+	DrugRoute string
+	DoseUnits string
+	// From the oldest to the newest.
+	Logs []UserLog
+	// The sum of the doses of all logs.
+	TotalDose float32
+	// The amount of logs after the first one.
+	Redoses int
+	// The class of TotalDose, checkout ClassifyDose()
+	Class DoseClass
+	// In unix time, the start of the first log and when the last one is
+	// expected to end, using the maximum total duration from the source.
+	Start int64
+	End   int64
+}
+
+type DoseSessionsError struct {
+	// From the oldest to the newest.
+	Sessions []DoseSession
+	Username string
+	Err      error
+}
+
+// Returns when a log ends at the latest, the info must be in seconds.
+// If there's no total duration, only the time of dosing is used.
+func logMaxEnd(userLog UserLog, info DrugInfo) int64 {
+	end := userLog.StartTime
+	if userLog.EndTime > end {
+		end = userLog.EndTime
+	}
+	return end + int64(info.TotalDurMax)
+}
+
+// Groups the logs into sessions, the logs can be in any order.
+// The info for every drug is gotten once and used for all its logs.
+func (cfg *Config) groupSessions(db *sql.DB, ctx context.Context, username string,
+	userLogs []UserLog) []DoseSession {
+	const printN string = "groupSessions()"
+
+	sorted := make([]UserLog, len(userLogs))
+	copy(sorted, userLogs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime < sorted[j].StartTime
+	})
+
+	type sessionKey struct {
+		drug  string
+		route string
+		units string
+	}
+
+	gotInfos := map[sessionKey]DrugInfo{}
+	openSessions := map[sessionKey]int{}
+	var sessions []DoseSession
+	for _, elem := range sorted {
+		key := sessionKey{elem.DrugName, elem.DrugRoute, elem.DoseUnits}
+
+		info, exists := gotInfos[key]
+		if !exists {
+			err, gotInfo := cfg.getRouteInfo(db, ctx, elem.DrugName, elem.DrugRoute, username)
+			if err != nil {
+				printNameVerbose(cfg.VerbosePrinting, printN, "No info for log:", elem.ID, "; error:", err)
+			} else {
+				cfg.convertToSeconds(db, ctx, gotInfo.TotalDurUnits,
+					&gotInfo.TotalDurMin, &gotInfo.TotalDurMax)
+			}
+			info = gotInfo
+			gotInfos[key] = info
+		}
+
+		i, open := openSessions[key]
+		if open && elem.StartTime <= sessions[i].End {
+			sessions[i].Logs = append(sessions[i].Logs, elem)
+			sessions[i].TotalDose += elem.Dose
+			sessions[i].Redoses++
+			end := logMaxEnd(elem, info)
+			if end > sessions[i].End {
+				sessions[i].End = end
+			}
+		} else {
+			sessions = append(sessions, DoseSession{
+				DrugName:  elem.DrugName,
+				DrugRoute: elem.DrugRoute,
+				DoseUnits: elem.DoseUnits,
+				Logs:      []UserLog{elem},
+				TotalDose: elem.Dose,
+				Redoses:   0,
+				Start:     elem.StartTime,
+				End:       logMaxEnd(elem, info),
+			})
+			i = len(sessions) - 1
+			openSessions[key] = i
+		}
+
+		if info.DoseUnits == elem.DoseUnits {
+			sessions[i].Class = ClassifyDose(info, sessions[i].TotalDose)
+		}
+	}
+
+	return sessions
+}
+
+// GetDoseSessions returns all logs of a user grouped into sessions,
+// checkout DoseSession. The redoses and the class of the cumulative dose
+// can be used to notice when too much has been taken in a short time.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// sessionsErrChan - the goroutine channel which returns the sessions
+// and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to get the sessions
+//
+// onlyActive - if true, returns only the sessions which haven't ended yet
+func (cfg *Config) GetDoseSessions(db *sql.DB, ctx context.Context,
+	sessionsErrChan chan<- DoseSessionsError, username string, onlyActive bool) DoseSessionsError {
+	const printN string = "GetDoseSessions()"
+
+	tempSessionsErr := DoseSessionsError{
+		Sessions: nil,
+		Username: username,
+		Err:      nil,
+	}
+
+	gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, username, false, "", "")
+	if gotLogs.Err != nil {
+		tempSessionsErr.Err = fmt.Errorf("%s%w", sprintName(printN), gotLogs.Err)
+		if sessionsErrChan != nil {
+			sessionsErrChan <- tempSessionsErr
+		}
+		return tempSessionsErr
+	}
+
+	curTime := time.Now().Unix()
+	for _, elem := range cfg.groupSessions(db, ctx, username, gotLogs.UserLogs) {
+		if onlyActive && elem.End <= curTime {
+			continue
+		}
+		tempSessionsErr.Sessions = append(tempSessionsErr.Sessions, elem)
+	}
+
+	if len(tempSessionsErr.Sessions) == 0 {
+		tempSessionsErr.Err = fmt.Errorf("%s%w: %s ; no sessions", sprintName(printN),
+			NoLogsError, username)
+	}
+
+	if sessionsErrChan != nil {
+		sessionsErrChan <- tempSessionsErr
+	}
+	return tempSessionsErr
+}
+
+// Returns the session which contains the log, the session is nil if
+// the log isn't found.
+func (cfg *Config) sessionForLog(db *sql.DB, ctx context.Context,
+	username string, useLog UserLog) (error, *DoseSession) {
+	gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, username, false, useLog.DrugName, LogDrugNameCol)
+	if gotLogs.Err != nil {
+		return gotLogs.Err, nil
+	}
+
+	for _, session := range cfg.groupSessions(db, ctx, username, gotLogs.UserLogs) {
+		for _, elem := range session.Logs {
+			if elem.ID == useLog.ID {
+				return nil, &session
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// Prints a single session, used by PrintDoseSessions() and PrintTimeTill().
+func printDoseSession(printN string, session DoseSession, location *time.Location) {
+	printNameF(printN, "Drug: %q ; Route: %q ; Doses: %d ; Redoses: %d\n",
+		session.DrugName, session.DrugRoute, len(session.Logs), session.Redoses)
+	printNameF(printN, "Total: %g %s ; Class: %s\n",
+		session.TotalDose, session.DoseUnits, session.Class)
+	printNameF(printN, "Start: %q ; Approx. Max End: %q\n",
+		time.Unix(session.Start, 0).In(location),
+		time.Unix(session.End, 0).In(location))
+	for _, elem := range session.Logs {
+		printNameF(printN, "\tID: %d ; Start: %q ; Dose: %g %s\n",
+			elem.ID, time.Unix(elem.StartTime, 0).In(location), elem.Dose, elem.DoseUnits)
+	}
+}
+
+// PrintDoseSessions prints the sessions gotten using GetDoseSessions().
+//
+// sessionsErr - the struct returned from GetDoseSessions()
+//
+// prefix - if true, adds the function name to every print
+func (cfg *Config) PrintDoseSessions(sessionsErr DoseSessionsError, prefix bool) error {
+	var printN string
+	if prefix == true {
+		printN = "PrintDoseSessions()"
+	} else {
+		printN = ""
+	}
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		err = fmt.Errorf("%s%w", sprintName(printN, "LoadLocation: "), err)
+		return err
+	}
+
+	for i, elem := range sessionsErr.Sessions {
+		if i != 0 {
+			fmt.Println()
+		}
+		printDoseSession(printN, elem, location)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Source is implemented by everything that can provide general information
+// about substances, like dosages and timings for every route of
+// administration. The name under which a source is registered is the same
+// name used for UseSource in the settings file and for the key in the
+// sources config file (gpd-sources.toml).
+type Source interface {
+	// FetchSubstance returns the information about all routes of
+	// administration for a single substance. The returned slice is what
+	// gets stored in the info table, so it shouldn't be empty if there's
+	// no error.
+	FetchSubstance(ctx context.Context, drugname string) (error, []DrugInfo)
+
+	// Routes returns the names of all routes of administration, which the
+	// source has information about for a single substance.
+	Routes(ctx context.Context, drugname string) (error, []string)
+
+	// Describe returns a short human readable description of the source.
+	Describe() string
+}
+
+// InteractionSource can be implemented by a source which also has information
+// about interactions between substances. It's optional, when a source
+// implements it, the interactions are stored every time a substance is
+// fetched, checkout GetInteraction().
+type InteractionSource interface {
+	// FetchInteractions returns all known interactions of a single substance
+	// with other substances. DrugA of every interaction is the substance.
+	FetchInteractions(ctx context.Context, drugname string) (error, []Interaction)
+}
+
+// SourceInitFunc is the function used to create a new Source. It's called
+// by InitSource() with the Config struct and the data from the sources config
+// file for the configured source.
+type SourceInitFunc func(cfg *Config, srcCfg SourceConfig) (error, Source)
+
+// All sources which can be chosen with UseSource in the settings file.
+// Sources present in this package are added here, others need to use
+// RegisterSource().
+var sourcesRegistry = map[string]SourceInitFunc{
+	PsychonautwikiName: initPsychonautwikiSource,
+	LocalFileName:      initLocalFileSource,
+}
+var sourcesRegistryLock sync.RWMutex
+
+// RegisterSource adds a new source, which can then be chosen by setting
+// UseSource in the settings file to the same name. This allows using a source
+// implemented outside of this package. It should be called before
+// InitSource().
+//
+// name - the name of the source, it's also used as the name of the info table
+// in the database, so keep it simple, for example "mysource"
+//
+// initSrc - the function which returns the initialised Source
+func RegisterSource(name string, initSrc SourceInitFunc) error {
+	const printN string = "RegisterSource()"
+
+	if name == "" || name == "none" {
+		return fmt.Errorf("%s%w", sprintName(printN), EmptySourceNameError)
+	}
+
+	if initSrc == nil {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), NilSourceInitError, name)
+	}
+
+	sourcesRegistryLock.Lock()
+	defer sourcesRegistryLock.Unlock()
+
+	_, exists := sourcesRegistry[name]
+	if exists {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), SourceAlreadyRegisteredError, name)
+	}
+
+	sourcesRegistry[name] = initSrc
+
+	return nil
+}
+
+// RegisteredSources returns the names of all sources which can be used,
+// sorted alphabetically.
+func RegisteredSources() []string {
+	sourcesRegistryLock.RLock()
+	defer sourcesRegistryLock.RUnlock()
+
+	var names []string
+	for name := range sourcesRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// InitSource returns the initialised Source for the source set with UseSource
+// in the Config struct. It uses the data for the source from the sources
+// config file, so make sure it's initialised, checkout InitSourceSettings().
+func (cfg *Config) InitSource() (error, Source) {
+	const printN string = "InitSource()"
+
+	sourcesRegistryLock.RLock()
+	initSrc, exists := sourcesRegistry[cfg.UseSource]
+	sourcesRegistryLock.RUnlock()
+	if !exists {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), NoValidSourceSel, cfg.UseSource), nil
+	}
+
+	gotsrcData := GetSourceData()
+	srcCfg, exists := gotsrcData[cfg.UseSource]
+	if !exists {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), NoSourceConfigError, cfg.UseSource), nil
+	}
+
+	printNameVerbose(cfg.VerbosePrinting,
+		printN, "Using source from settings.toml:", cfg.UseSource)
+	printNameVerbose(cfg.VerbosePrinting,
+		printN, "Got address from sources.toml:", srcCfg.API_ADDRESS)
+
+	err, src := initSrc(cfg, srcCfg)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	return nil, src
+}
+
+var EmptySourceNameError error = errors.New("the source name is empty")
+var NilSourceInitError error = errors.New("the source init function is nil")
+var SourceAlreadyRegisteredError error = errors.New("a source with this name is already registered")
+var NoSourceConfigError error = errors.New("no configuration for source in the sources file")
@@ -0,0 +1,744 @@
+package drugdose
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+	sqlite "modernc.org/sqlite"
+	"modernc.org/sqlite/vfs"
+)
+
+// When DBSettings.sqlite.Encrypt is true, the database file on disk is
+// encrypted as a whole using AES-256-GCM with a key derived from a passphrase
+// using scrypt. While the database is open, it's kept decrypted only in
+// memory and after every change it's encrypted again and written to disk.
+//
+// The layout of the file is: encMagic ; salt ; nonce ; encrypted database
+const encMagic string = "GPDENC01"
+const encSaltLen int = 16
+const encKeyLen int = 32
+
+// The scrypt parameters, changing them makes old files unreadable!
+const encScryptN int = 1 << 15
+const encScryptR int = 8
+const encScryptP int = 1
+
+// Every SQLite file starts with this.
+const sqliteHeader string = "SQLite format 3\x00"
+
+// Used to give every in memory database an unique name.
+var encMemDBCount atomic.Int64
+
+// SetDBPassphrase sets the passphrase used to decrypt and encrypt the
+// SQLite database, when DBSettings.sqlite.Encrypt is true in the settings
+// file. It has to be set before calling InitAllDB() or OpenDBConnection().
+// The passphrase is never written to the settings file.
+//
+// passphrase - the passphrase to derive the encryption key from
+func (cfg *Config) SetDBPassphrase(passphrase string) {
+	cfg.dbPassphrase = passphrase
+}
+
+// Returns true if the database needs to be decrypted to be used.
+func (cfg *Config) dbIsEncrypted() bool {
+	return cfg.DBDriver == SqliteDriver && cfg.DBSettings[cfg.DBDriver].Encrypt
+}
+
+// Derive the key used for encrypting the database.
+func deriveDBKey(passphrase string, salt []byte) (error, []byte) {
+	const printN string = "deriveDBKey()"
+
+	if passphrase == "" {
+		return fmt.Errorf("%s%w", sprintName(printN), EmptyPassphraseError), nil
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, encScryptN, encScryptR, encScryptP, encKeyLen)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	return nil, key
+}
+
+// Returns the contents of an encrypted database file.
+func encryptDBData(plain []byte, key []byte, salt []byte) (error, []byte) {
+	const printN string = "encryptDBData()"
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	header := make([]byte, 0, len(encMagic)+len(salt)+len(nonce))
+	header = append(header, encMagic...)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+
+	// The header is authenticated as well, so that the salt can't be changed.
+	return nil, gcm.Seal(header, nonce, plain, header)
+}
+
+// Returns the decrypted database and the salt used for the key.
+func decryptDBData(data []byte, passphrase string) (error, []byte, []byte, []byte) {
+	const printN string = "decryptDBData()"
+
+	if bytes.HasPrefix(data, []byte(sqliteHeader)) {
+		return fmt.Errorf("%s%w", sprintName(printN), DBNotEncryptedError), nil, nil, nil
+	}
+
+	if !bytes.HasPrefix(data, []byte(encMagic)) || len(data) < len(encMagic)+encSaltLen {
+		return fmt.Errorf("%s%w", sprintName(printN), InvalidEncryptedDBError), nil, nil, nil
+	}
+
+	salt := data[len(encMagic) : len(encMagic)+encSaltLen]
+
+	err, key := deriveDBKey(passphrase, salt)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil, nil, nil
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil, nil, nil
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil, nil, nil
+	}
+
+	headerLen := len(encMagic) + encSaltLen + gcm.NonceSize()
+	if len(data) < headerLen {
+		return fmt.Errorf("%s%w", sprintName(printN), InvalidEncryptedDBError), nil, nil, nil
+	}
+
+	nonce := data[len(encMagic)+encSaltLen : headerLen]
+	plain, err := gcm.Open(nil, nonce, data[headerLen:], data[:headerLen])
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), WrongPassphraseError), nil, nil, nil
+	}
+
+	return nil, plain, key, bytes.Clone(salt)
+}
+
+// Writes the file to a temporary file first and then replaces the old one,
+// so that the database isn't lost if writing fails midway.
+func writeFileAtomic(path string, data []byte) error {
+	const printN string = "writeFileAtomic()"
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+	tmpPath := tmpFile.Name()
+
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	err2 := tmpFile.Close()
+	if err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0600)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	return nil
+}
+
+// EncryptDB converts an existing plaintext SQLite database to an encrypted
+// one using the given passphrase. Afterwards Encrypt has to be set to true
+// in DBSettings.sqlite in the settings file, for the database to be used.
+// The database can't be opened while converting it.
+//
+// passphrase - the passphrase to derive the encryption key from
+func (cfg *Config) EncryptDB(passphrase string) error {
+	const printN string = "EncryptDB()"
+
+	path := cfg.DBSettings[SqliteDriver].Path
+
+	err, lockFile := lockEncDB(path)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+	defer unlockEncDB(lockFile)
+
+	plain, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	if bytes.HasPrefix(plain, []byte(encMagic)) {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), DBAlreadyEncryptedError, path)
+	}
+
+	if len(plain) != 0 && !bytes.HasPrefix(plain, []byte(sqliteHeader)) {
+		return fmt.Errorf("%s%w: %s", sprintName(printN), InvalidEncryptedDBError, path)
+	}
+
+	salt := make([]byte, encSaltLen)
+	_, err = io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err, key := deriveDBKey(passphrase, salt)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err, data := encryptDBData(plain, key, salt)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = writeFileAtomic(path, data)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	printName(printN, "Encrypted database:", path)
+
+	return nil
+}
+
+// RotateDBPassphrase encrypts an already encrypted SQLite database using
+// a new passphrase. A new salt is generated as well. The database can't
+// be opened while changing the passphrase.
+//
+// oldPassphrase - the passphrase currently used for the database
+//
+// newPassphrase - the passphrase to use from now on
+func (cfg *Config) RotateDBPassphrase(oldPassphrase string, newPassphrase string) error {
+	const printN string = "RotateDBPassphrase()"
+
+	path := cfg.DBSettings[SqliteDriver].Path
+
+	err, lockFile := lockEncDB(path)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+	defer unlockEncDB(lockFile)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err, plain, _, _ := decryptDBData(data, oldPassphrase)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	salt := make([]byte, encSaltLen)
+	_, err = io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err, key := deriveDBKey(newPassphrase, salt)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err, data = encryptDBData(plain, key, salt)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = writeFileAtomic(path, data)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	printName(printN, "Changed passphrase for database:", path)
+
+	return nil
+}
+
+// The connector used by OpenDBConnection() for an encrypted database.
+// All connections use the same in memory database, which is filled with the
+// decrypted data when the first connection is made. The "anchor" connection
+// keeps the in memory database alive until the connector is closed.
+// The database file is locked from the first connection until the connector
+// is closed, so that no other process can use it, checkout lockEncDB().
+type encSqliteConnector struct {
+	path       string
+	passphrase string
+	memDSN     string
+	key        []byte
+	salt       []byte
+	anchor     driver.Conn
+	lockFile   *os.File
+	loadErr    error
+	loadOnce   sync.Once
+	saveLock   sync.Mutex
+	// True when the last change couldn't be written to disk.
+	unsaved bool
+}
+
+func (cfg *Config) newEncSqliteConnector() *encSqliteConnector {
+	params := strings.TrimPrefix(cfg.DBSettings[SqliteDriver].Parameters, "?")
+	if params != "" {
+		params = "&" + params
+	}
+
+	return &encSqliteConnector{
+		path:       cfg.DBSettings[SqliteDriver].Path,
+		passphrase: cfg.dbPassphrase,
+		memDSN: fmt.Sprintf("file:/gpd-enc-%d?vfs=memdb%s",
+			encMemDBCount.Add(1), params),
+	}
+}
+
+func (c *encSqliteConnector) load() error {
+	const printN string = "encSqliteConnector.load()"
+
+	err, lockFile := lockEncDB(c.path)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = c.loadLocked()
+	if err != nil {
+		unlockEncDB(lockFile)
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	c.lockFile = lockFile
+
+	return nil
+}
+
+// Read and decrypt the database, after the lock has been taken.
+func (c *encSqliteConnector) loadLocked() error {
+	const printN string = "encSqliteConnector.loadLocked()"
+
+	data, err := os.ReadFile(c.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	var plain []byte
+	if len(data) != 0 {
+		err, plain, c.key, c.salt = decryptDBData(data, c.passphrase)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err)
+		}
+	} else {
+		c.salt = make([]byte, encSaltLen)
+		_, err = io.ReadFull(rand.Reader, c.salt)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err)
+		}
+
+		err, c.key = deriveDBKey(c.passphrase, c.salt)
+		if err != nil {
+			return fmt.Errorf("%s%w", sprintName(printN), err)
+		}
+	}
+
+	drv := &sqlite.Driver{}
+	anchor, err := drv.Open(c.memDSN)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	if len(plain) != 0 {
+		err = restoreToMemDB(drv, plain, c.memDSN)
+		if err != nil {
+			anchor.Close()
+			return fmt.Errorf("%s%w", sprintName(printN), err)
+		}
+	}
+
+	c.anchor = anchor
+
+	return nil
+}
+
+// A read only file system holding only the decrypted database, so that
+// SQLite can read it through modernc.org/sqlite/vfs without it ever being
+// written to disk.
+type encPlainFS struct {
+	plain []byte
+}
+
+type encPlainFile struct {
+	*bytes.Reader
+	size int64
+}
+
+type encPlainFileInfo struct {
+	size int64
+}
+
+func (f encPlainFS) Open(name string) (fs.File, error) {
+	if name != encPlainName {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &encPlainFile{Reader: bytes.NewReader(f.plain), size: int64(len(f.plain))}, nil
+}
+
+func (f *encPlainFile) Stat() (fs.FileInfo, error) { return encPlainFileInfo{size: f.size}, nil }
+func (f *encPlainFile) Close() error               { return nil }
+
+func (fi encPlainFileInfo) Name() string       { return encPlainName }
+func (fi encPlainFileInfo) Size() int64        { return fi.size }
+func (fi encPlainFileInfo) Mode() fs.FileMode  { return 0400 }
+func (fi encPlainFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi encPlainFileInfo) IsDir() bool        { return false }
+func (fi encPlainFileInfo) Sys() any           { return nil }
+
+// The name of the decrypted database in encPlainFS.
+const encPlainName string = "gpd.db"
+
+// Copy the decrypted database to the shared in memory database.
+func restoreToMemDB(drv *sqlite.Driver, plain []byte, memDSN string) error {
+	vfsName, plainFS, err := vfs.New(encPlainFS{plain: plain})
+	if err != nil {
+		return err
+	}
+	defer plainFS.Close()
+
+	tmpConn, err := drv.Open("file:" + encPlainName + "?vfs=" + vfsName + "&mode=ro")
+	if err != nil {
+		return err
+	}
+	defer tmpConn.Close()
+
+	backuper, ok := tmpConn.(interface {
+		NewBackup(string) (*sqlite.Backup, error)
+	})
+	if !ok {
+		return SqliteNoSerializeError
+	}
+
+	bck, err := backuper.NewBackup(memDSN)
+	if err != nil {
+		return err
+	}
+
+	// Step() returns true while there are still pages left to copy.
+	for more := true; more; {
+		more, err = bck.Step(-1)
+		if err != nil {
+			bck.Finish()
+			return err
+		}
+	}
+
+	return bck.Finish()
+}
+
+// Encrypt the in memory database and write it to disk.
+func (c *encSqliteConnector) save(conn driver.Conn) error {
+	c.saveLock.Lock()
+	defer c.saveLock.Unlock()
+
+	err := c.saveLocked(conn)
+	c.unsaved = err != nil
+	return err
+}
+
+func (c *encSqliteConnector) saveLocked(conn driver.Conn) error {
+	const printN string = "encSqliteConnector.saveLocked()"
+
+	ctx := context.Background()
+
+	ser, ok := conn.(interface{ Serialize() ([]byte, error) })
+	execer, ok2 := conn.(driver.ExecerContext)
+	queryer, ok3 := conn.(driver.QueryerContext)
+	if !ok || !ok2 || !ok3 {
+		return fmt.Errorf("%s%w", sprintName(printN), SqliteNoSerializeError)
+	}
+
+	// Keep a read lock, so that other connections can't change the database
+	// while it's being copied.
+	_, err := execer.ExecContext(ctx, "begin", nil)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	rows, err := queryer.QueryContext(ctx, "select count(*) from sqlite_schema", nil)
+	if err == nil {
+		rows.Next(make([]driver.Value, 1))
+		rows.Close()
+	}
+
+	var plain []byte
+	if err == nil {
+		plain, err = ser.Serialize()
+	}
+
+	_, err2 := execer.ExecContext(ctx, "commit", nil)
+	if err == nil {
+		err = err2
+	}
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err, data := encryptDBData(plain, c.key, c.salt)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	err = writeFileAtomic(c.path, data)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err)
+	}
+
+	return nil
+}
+
+// Called after a change was already made to the in memory database, so it
+// can't fail anymore. If writing to disk fails, the error is only printed,
+// the database is written again with the next change or when it's closed.
+func (c *encSqliteConnector) saveAfterChange(conn driver.Conn) {
+	const printN string = "encSqliteConnector.saveAfterChange()"
+
+	err := c.save(conn)
+	if err != nil {
+		printName(printN, "The change is kept in memory, but couldn't be written to disk:", err)
+	}
+}
+
+func (c *encSqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.loadOnce.Do(func() {
+		c.loadErr = c.load()
+	})
+	if c.loadErr != nil {
+		return nil, c.loadErr
+	}
+
+	conn, err := c.Driver().Open(c.memDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encSqliteConn{Conn: conn, connector: c}, nil
+}
+
+func (c *encSqliteConnector) Driver() driver.Driver {
+	return &sqlite.Driver{}
+}
+
+// Called by sql.DB.Close(), frees the in memory database and releases the
+// lock. If the last change couldn't be written to disk, it's tried once more
+// and EncDBNotSavedError is returned if it fails again.
+func (c *encSqliteConnector) Close() error {
+	const printN string = "encSqliteConnector.Close()"
+
+	if c.anchor == nil {
+		return nil
+	}
+
+	c.saveLock.Lock()
+	unsaved := c.unsaved
+	c.saveLock.Unlock()
+
+	var saveErr error
+	if unsaved {
+		saveErr = c.save(c.anchor)
+		if saveErr != nil {
+			saveErr = fmt.Errorf("%s%w: %s: %w", sprintName(printN), EncDBNotSavedError, c.path, saveErr)
+		}
+	}
+
+	err := c.anchor.Close()
+	unlockEncDB(c.lockFile)
+	if saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// Wraps a connection to the in memory database, so that the database is
+// written to disk after every change. Changes in a transaction are written
+// after the commit, changes outside of a transaction right after they're made.
+type encSqliteConn struct {
+	driver.Conn
+	connector *encSqliteConnector
+	inTx      bool
+}
+
+func (c *encSqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *encSqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var st driver.Stmt
+	var err error
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		st, err = pc.PrepareContext(ctx, query)
+	} else {
+		st, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &encSqliteStmt{Stmt: st, conn: c}, nil
+}
+
+func (c *encSqliteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = bc.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return &encSqliteTx{Tx: tx, conn: c}, nil
+}
+
+func (c *encSqliteConn) QueryContext(ctx context.Context, query string,
+	args []driver.NamedValue) (driver.Rows, error) {
+	if qc, ok := c.Conn.(driver.QueryerContext); ok {
+		return qc.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *encSqliteConn) ExecContext(ctx context.Context, query string,
+	args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	res, err := ec.ExecContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c.saveIfNoTx()
+	return res, nil
+}
+
+func (c *encSqliteConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *encSqliteConn) saveIfNoTx() {
+	if c.inTx {
+		return
+	}
+	c.connector.saveAfterChange(c.Conn)
+}
+
+type encSqliteTx struct {
+	driver.Tx
+	conn *encSqliteConn
+}
+
+func (t *encSqliteTx) Commit() error {
+	t.conn.inTx = false
+	err := t.Tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	// The commit succeeded, even if the database can't be written to disk.
+	t.conn.connector.saveAfterChange(t.conn.Conn)
+	return nil
+}
+
+func (t *encSqliteTx) Rollback() error {
+	t.conn.inTx = false
+	return t.Tx.Rollback()
+}
+
+type encSqliteStmt struct {
+	driver.Stmt
+	conn *encSqliteConn
+}
+
+func (s *encSqliteStmt) Exec(args []driver.Value) (driver.Result, error) {
+	res, err := s.Stmt.Exec(args)
+	if err != nil {
+		return nil, err
+	}
+	s.conn.saveIfNoTx()
+	return res, nil
+}
+
+func (s *encSqliteStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ec, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		values := make([]driver.Value, len(args))
+		for i := range args {
+			values[i] = args[i].Value
+		}
+		return s.Exec(values)
+	}
+
+	res, err := ec.ExecContext(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	s.conn.saveIfNoTx()
+	return res, nil
+}
+
+func (s *encSqliteStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if qc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return qc.QueryContext(ctx, args)
+	}
+
+	values := make([]driver.Value, len(args))
+	for i := range args {
+		values[i] = args[i].Value
+	}
+	return s.Stmt.Query(values)
+}
+
+var EmptyPassphraseError error = errors.New("the passphrase for the encrypted database is empty")
+var WrongPassphraseError error = errors.New("can't decrypt the database, wrong passphrase or damaged file")
+var DBNotEncryptedError error = errors.New("the database isn't encrypted, checkout EncryptDB()")
+var DBAlreadyEncryptedError error = errors.New("the database is already encrypted")
+var InvalidEncryptedDBError error = errors.New("the file isn't an encrypted or a SQLite database")
+var SqliteNoSerializeError error = errors.New("the SQLite driver doesn't support serializing")
+var EncDBLockedError error = errors.New("the encrypted database is used by another process")
+var EncDBNotSavedError error = errors.New("the last changes couldn't be written to the encrypted database")
@@ -0,0 +1,58 @@
+package drugdose
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// The encrypted database is read into memory when it's opened and the whole
+// file is written again after every change, so two processes using it at
+// the same time would overwrite each other's changes. To avoid that, a lock
+// file next to the database is locked for as long as the database is open.
+const encLockSuffix string = ".lock"
+
+// How long to wait for another process to close the database, before giving up.
+const encLockTimeout time.Duration = 5 * time.Second
+const encLockRetry time.Duration = 100 * time.Millisecond
+
+// Lock the encrypted database at the given path, waiting for up to
+// encLockTimeout if another process has it open. The lock is released by
+// closing the returned file, checkout unlockEncDB().
+func lockEncDB(path string) (error, *os.File) {
+	const printN string = "lockEncDB()"
+
+	lockFile, err := os.OpenFile(path+encLockSuffix, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	deadline := time.Now().Add(encLockTimeout)
+	for {
+		err, locked := tryLockFile(lockFile)
+		if err != nil {
+			lockFile.Close()
+			return fmt.Errorf("%s%w", sprintName(printN), err), nil
+		}
+
+		if locked {
+			return nil, lockFile
+		}
+
+		if time.Now().After(deadline) {
+			lockFile.Close()
+			return fmt.Errorf("%s%w: %s", sprintName(printN), EncDBLockedError, path), nil
+		}
+
+		time.Sleep(encLockRetry)
+	}
+}
+
+// Release the lock taken by lockEncDB(). The lock file itself is kept,
+// removing it could let two processes lock different files.
+func unlockEncDB(lockFile *os.File) error {
+	if lockFile == nil {
+		return nil
+	}
+	return lockFile.Close()
+}
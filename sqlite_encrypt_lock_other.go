@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd || windows)
+
+package drugdose
+
+import (
+	"os"
+)
+
+// File locking isn't supported on this platform, so the encrypted database
+// isn't protected from being used by two processes at the same time.
+func tryLockFile(file *os.File) (error, bool) {
+	return nil, true
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package drugdose
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Try to take an exclusive lock on the file without waiting.
+// False is returned if another process already holds the lock.
+func tryLockFile(file *os.File) (error, bool) {
+	err := unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return nil, false
+	} else if err != nil {
+		return err, false
+	}
+	return nil, true
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package drugdose
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Try to take an exclusive lock on the file without waiting.
+// False is returned if another process already holds the lock.
+func tryLockFile(file *os.File) (error, bool) {
+	overlapped := windows.Overlapped{}
+	err := windows.LockFileEx(windows.Handle(file.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, &overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return nil, false
+	} else if err != nil {
+		return err, false
+	}
+	return nil, true
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"time"
 
 	"database/sql"
@@ -15,6 +16,55 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// Phase is the part of the experience a log is in, the phases are in the
+// order they happen.
+type Phase int
+
+const (
+	// The dose was logged, but the adjusted start time hasn't been reached,
+	// for example when drinking slowly.
+	PhaseNotStarted Phase = iota
+	PhaseOnset
+	PhaseComeup
+	PhasePeak
+	PhaseOffset
+	// After the offset, until the total duration has passed.
+	PhaseAfterEffects
+	PhaseFinished
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseNotStarted:
+		return "not started"
+	case PhaseOnset:
+		return "onset"
+	case PhaseComeup:
+		return "come-up"
+	case PhasePeak:
+		return "peak"
+	case PhaseOffset:
+		return "offset"
+	case PhaseAfterEffects:
+		return "after-effects"
+	case PhaseFinished:
+		return "finished"
+	}
+	return fmt.Sprintf("Phase(%d)", int(p))
+}
+
+// PhaseTimes is when a single phase starts and ends, in unix time,
+// using the minimum, average and maximum durations from the source.
+type PhaseTimes struct {
+	Phase    Phase
+	StartMin int64
+	StartAvg int64
+	StartMax int64
+	EndMin   int64
+	EndAvg   int64
+	EndMax   int64
+}
+
 type TimeTill struct {
 	// In seconds
 	//
@@ -45,12 +95,29 @@ type TimeTill struct {
 	// In unix time
 	StartDose int64
 	EnDose    int64
+	// The current phase, using the average durations.
+	Phase Phase
+	// The times for every phase from onset to after-effects, a phase
+	// without information from the source starts and ends at the same time.
+	PhaseTimes []PhaseTimes
+}
+
+type ActiveTimesError struct {
+	// Sorted by how far in the experience every log is, checkout GetActiveTimes()
+	TimeTills []TimeTillError
+	// The interactions between the active logs, checkout GetInteraction()
+	Warnings []error
+	Username string
+	Err      error
 }
 
 type TimeTillError struct {
 	TimeT    *TimeTill
 	Username string
 	Err      error
+	// The session the log is part of, set only by GetTimes(), nil if it
+	// couldn't be gotten, checkout DoseSession
+	Session *DoseSession
 	// Bellow is extra information only needed internally
 	useLog        UserLog
 	approxEnd     int64
@@ -89,6 +156,75 @@ func getAverage(first float32, second float32) float32 {
 	return 0
 }
 
+// Calculates the start and end of every phase, one after the other,
+// beginning from the adjusted start time. The info has to be in seconds.
+// The after-effects last until the total duration has passed.
+func calcPhaseTimes(start int64, info DrugInfo) []PhaseTimes {
+	durations := [][2]float32{
+		{info.OnsetMin, info.OnsetMax},
+		{info.ComeUpMin, info.ComeUpMax},
+		{info.PeakMin, info.PeakMax},
+		{info.OffsetMin, info.OffsetMax},
+	}
+
+	phaseTimes := make([]PhaseTimes, 0, len(durations)+1)
+	endMin, endAvg, endMax := start, start, start
+	for i, elem := range durations {
+		tempPhase := PhaseTimes{
+			Phase:    PhaseOnset + Phase(i),
+			StartMin: endMin,
+			StartAvg: endAvg,
+			StartMax: endMax,
+		}
+		endMin += int64(elem[0])
+		endAvg += int64(getAverage(elem[0], elem[1]))
+		endMax += int64(elem[1])
+		tempPhase.EndMin = endMin
+		tempPhase.EndAvg = endAvg
+		tempPhase.EndMax = endMax
+		phaseTimes = append(phaseTimes, tempPhase)
+	}
+
+	afterEffects := PhaseTimes{
+		Phase:    PhaseAfterEffects,
+		StartMin: endMin,
+		StartAvg: endAvg,
+		StartMax: endMax,
+		EndMin:   start + int64(info.TotalDurMin),
+		EndAvg:   start + int64(getAverage(info.TotalDurMin, info.TotalDurMax)),
+		EndMax:   start + int64(info.TotalDurMax),
+	}
+	// The total duration can be shorter than all phases together,
+	// then there are no after-effects.
+	if afterEffects.EndMin < afterEffects.StartMin {
+		afterEffects.EndMin = afterEffects.StartMin
+	}
+	if afterEffects.EndAvg < afterEffects.StartAvg {
+		afterEffects.EndAvg = afterEffects.StartAvg
+	}
+	if afterEffects.EndMax < afterEffects.StartMax {
+		afterEffects.EndMax = afterEffects.StartMax
+	}
+	phaseTimes = append(phaseTimes, afterEffects)
+
+	return phaseTimes
+}
+
+// Returns the phase at the given time, using the average times.
+func currentPhase(start int64, phaseTimes []PhaseTimes, curTime int64) Phase {
+	if curTime < start {
+		return PhaseNotStarted
+	}
+
+	for _, elem := range phaseTimes {
+		if curTime < elem.EndAvg {
+			return elem.Phase
+		}
+	}
+
+	return PhaseFinished
+}
+
 func calcTimeTill(timetill *int64, diff int64, average ...float32) {
 	*timetill = 0
 	var total float32 = 0
@@ -100,55 +236,20 @@ func calcTimeTill(timetill *int64, diff int64, average ...float32) {
 	}
 }
 
-// GetTimes returns the times till reaching a specific point of the experience.
-// The points are defined in the TimeTill struct. PrintTimeTill() can be used
-// to output the information gathered in this function to the terminal.
-//
-// db - open database connection
+// Calculates the times for a single log, using the info for all routes of
+// the logged drug. The returned error isn't wrapped, so that the caller can
+// decide what to do with it.
 //
-// ctx - context to be passed to sql queries
-//
-// timeTillErrChan - the goroutine channel which returns the TimeTill struct
-// and an error
-// (set to nil if function doesn't need to be concurrent)
-//
-// username - the user for which to get the information
-//
-// getid - if 0 gives information about the last log, a specific ID can be
-// passed to get the times for that log
-func (cfg *Config) GetTimes(db *sql.DB, ctx context.Context,
-	timeTillErrChan chan<- TimeTillError, username string, getid int64) TimeTillError {
-	const printN string = "GetTimes()"
+// curTime - the unix time to which the times are relative
+func (cfg *Config) calcLogTimes(db *sql.DB, ctx context.Context, username string,
+	useLog UserLog, gotInfo []DrugInfo, curTime int64) TimeTillError {
 
 	tempTimeTillErr := TimeTillError{
 		Err:      nil,
-		Username: "",
+		Username: username,
 		TimeT:    nil,
 	}
 
-	gotLogs := cfg.GetLogs(db, ctx, nil, 1, getid, username, true, "none", "")
-	if gotLogs.Err != nil {
-		tempTimeTillErr.Err = fmt.Errorf("%s%w", sprintName(printN), gotLogs.Err)
-		if timeTillErrChan != nil {
-			timeTillErrChan <- tempTimeTillErr
-		}
-		return tempTimeTillErr
-	}
-
-	useLog := gotLogs.UserLogs[0]
-
-	gotDrugInfoErr := cfg.GetLocalInfo(db, ctx, nil, useLog.DrugName, username)
-	gotInfo := gotDrugInfoErr.DrugI
-	err := gotDrugInfoErr.Err
-	if err != nil {
-		err = fmt.Errorf("%s%w", sprintName(printN), err)
-		tempTimeTillErr.Err = err
-		if timeTillErrChan != nil {
-			timeTillErrChan <- tempTimeTillErr
-		}
-		return tempTimeTillErr
-	}
-
 	gotInfoNum := -1
 	for i := 0; i < len(gotInfo); i++ {
 		if gotInfo[i].DrugRoute == useLog.DrugRoute {
@@ -158,33 +259,22 @@ func (cfg *Config) GetTimes(db *sql.DB, ctx context.Context,
 	}
 
 	if gotInfoNum == -1 {
-		tempTimeTillErr.Err = fmt.Errorf("%s%w", sprintName(printN), LoggedRouteInfoError)
-		if timeTillErrChan != nil {
-			timeTillErrChan <- tempTimeTillErr
-		}
+		tempTimeTillErr.Err = LoggedRouteInfoError
 		return tempTimeTillErr
 	}
 
 	gotInfoProper := gotInfo[gotInfoNum]
 
 	if gotInfoProper.DoseUnits != useLog.DoseUnits {
-		tempTimeTillErr.Err = fmt.Errorf("%s%w: %s ; info table units: %s",
-			sprintName(printN), LoggedUnitsInfoError,
-			useLog.DoseUnits, gotInfoProper.DoseUnits)
-		if timeTillErrChan != nil {
-			timeTillErrChan <- tempTimeTillErr
-		}
+		tempTimeTillErr.Err = fmt.Errorf("%w: %s ; info table units: %s",
+			LoggedUnitsInfoError, useLog.DoseUnits, gotInfoProper.DoseUnits)
 		return tempTimeTillErr
 	}
 
 	// No need to do further calculation, because if the source is correct,
 	// in theory almost no effect should be accomplished with this dosage.
 	if gotInfoProper.Threshold != 0 && useLog.Dose < gotInfoProper.Threshold {
-		tempTimeTillErr.Err = fmt.Errorf("%s%w: %s", sprintName(printN),
-			DoseBelowThresholdError, "will not calculate times")
-		if timeTillErrChan != nil {
-			timeTillErrChan <- tempTimeTillErr
-		}
+		tempTimeTillErr.Err = fmt.Errorf("%w: %s", DoseBelowThresholdError, "will not calculate times")
 		return tempTimeTillErr
 	}
 
@@ -209,7 +299,6 @@ func (cfg *Config) GetTimes(db *sql.DB, ctx context.Context,
 		&gotInfoProper.TotalDurMin,
 		&gotInfoProper.TotalDurMax)
 
-	curTime := time.Now().Unix()
 	var useLoggedTime int64
 
 	lightAvg := getAverage(gotInfoProper.LowDoseMin, gotInfoProper.LowDoseMax)
@@ -299,9 +388,11 @@ func (cfg *Config) GetTimes(db *sql.DB, ctx context.Context,
 	timeTill.StartDose = useLog.StartTime
 	timeTill.EnDose = useLog.EndTime
 
+	timeTill.PhaseTimes = calcPhaseTimes(useLoggedTime, gotInfoProper)
+	timeTill.Phase = currentPhase(useLoggedTime, timeTill.PhaseTimes, curTime)
+
 	var approxEnd int64 = useLoggedTime + int64(totalAvg)
 
-	tempTimeTillErr.Username = username
 	tempTimeTillErr.TimeT = &timeTill
 	tempTimeTillErr.useLog = useLog
 	tempTimeTillErr.approxEnd = approxEnd
@@ -312,12 +403,298 @@ func (cfg *Config) GetTimes(db *sql.DB, ctx context.Context,
 	tempTimeTillErr.offsetAvg = offsetAvg
 	tempTimeTillErr.totalAvg = totalAvg
 	tempTimeTillErr.gotInfoProper = gotInfoProper
+	return tempTimeTillErr
+}
+
+// GetTimes returns the times till reaching a specific point of the experience.
+// The points are defined in the TimeTill struct. PrintTimeTill() can be used
+// to output the information gathered in this function to the terminal.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// timeTillErrChan - the goroutine channel which returns the TimeTill struct
+// and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to get the information
+//
+// getid - if 0 gives information about the last log, a specific ID can be
+// passed to get the times for that log
+func (cfg *Config) GetTimes(db *sql.DB, ctx context.Context,
+	timeTillErrChan chan<- TimeTillError, username string, getid int64) TimeTillError {
+	const printN string = "GetTimes()"
+
+	tempTimeTillErr := TimeTillError{
+		Err:      nil,
+		Username: "",
+		TimeT:    nil,
+	}
+
+	gotLogs := cfg.GetLogs(db, ctx, nil, 1, getid, username, true, "none", "")
+	if gotLogs.Err != nil {
+		tempTimeTillErr.Err = fmt.Errorf("%s%w", sprintName(printN), gotLogs.Err)
+		if timeTillErrChan != nil {
+			timeTillErrChan <- tempTimeTillErr
+		}
+		return tempTimeTillErr
+	}
+
+	useLog := gotLogs.UserLogs[0]
+
+	gotDrugInfoErr := cfg.GetLocalInfo(db, ctx, nil, useLog.DrugName, username)
+	gotInfo := gotDrugInfoErr.DrugI
+	err := gotDrugInfoErr.Err
+	if err != nil {
+		err = fmt.Errorf("%s%w", sprintName(printN), err)
+		tempTimeTillErr.Err = err
+		if timeTillErrChan != nil {
+			timeTillErrChan <- tempTimeTillErr
+		}
+		return tempTimeTillErr
+	}
+
+	tempTimeTillErr = cfg.calcLogTimes(db, ctx, username, useLog, gotInfo, time.Now().Unix())
+	if tempTimeTillErr.Err != nil {
+		tempTimeTillErr.Err = fmt.Errorf("%s%w", sprintName(printN), tempTimeTillErr.Err)
+		if timeTillErrChan != nil {
+			timeTillErrChan <- tempTimeTillErr
+		}
+		return tempTimeTillErr
+	}
+
+	// The session is only extra information, so the times are still returned
+	// without it.
+	err, session := cfg.sessionForLog(db, ctx, username, useLog)
+	if err != nil {
+		printNameVerbose(cfg.VerbosePrinting, printN, "Couldn't get the session for log:",
+			useLog.ID, "; error:", err)
+	} else {
+		tempTimeTillErr.Session = session
+	}
+
 	if timeTillErrChan != nil {
 		timeTillErrChan <- tempTimeTillErr
 	}
 	return tempTimeTillErr
 }
 
+// GetActiveTimes returns the times for every log of a user, which hasn't
+// ended yet. A log has ended when its maximum total duration from the source
+// has passed, so that nothing which might still be active is missed.
+// The times are calculated the same way as in GetTimes(). Logs which can't
+// be used, for example because they're below the threshold or the route isn't
+// in the info table are skipped. The logs are sorted from the ones which are
+// the earliest in the experience to the latest, same ones by start time.
+// The interactions between the newest active logs of different substances
+// are returned in ActiveTimesError.Warnings, checkout GetInteraction().
+// If no logs are active, NoLogsError is returned.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// activeTimesErrChan - the goroutine channel which returns the times for
+// all active logs and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to get the information
+func (cfg *Config) GetActiveTimes(db *sql.DB, ctx context.Context,
+	activeTimesErrChan chan<- ActiveTimesError, username string) ActiveTimesError {
+	const printN string = "GetActiveTimes()"
+
+	tempActiveTimesErr := ActiveTimesError{
+		TimeTills: nil,
+		Username:  username,
+		Err:       nil,
+	}
+
+	gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, username, true, "", "")
+	if gotLogs.Err != nil {
+		tempActiveTimesErr.Err = fmt.Errorf("%s%w", sprintName(printN), gotLogs.Err)
+		if activeTimesErrChan != nil {
+			activeTimesErrChan <- tempActiveTimesErr
+		}
+		return tempActiveTimesErr
+	}
+
+	curTime := time.Now().Unix()
+	gotInfos := map[string][]DrugInfo{}
+	for _, useLog := range gotLogs.UserLogs {
+		if useLog.StartTime > curTime {
+			continue
+		}
+
+		gotInfo, exists := gotInfos[useLog.DrugName]
+		if !exists {
+			gotDrugInfoErr := cfg.GetLocalInfo(db, ctx, nil, useLog.DrugName, username)
+			if gotDrugInfoErr.Err != nil {
+				printNameVerbose(cfg.VerbosePrinting, printN, "Skipping log:", useLog.ID,
+					"; error:", gotDrugInfoErr.Err)
+			}
+			gotInfo = gotDrugInfoErr.DrugI
+			gotInfos[useLog.DrugName] = gotInfo
+		}
+		if len(gotInfo) == 0 {
+			continue
+		}
+
+		gotTimeTillErr := cfg.calcLogTimes(db, ctx, username, useLog, gotInfo, curTime)
+		if gotTimeTillErr.Err != nil {
+			printNameVerbose(cfg.VerbosePrinting, printN, "Skipping log:", useLog.ID,
+				"; error:", gotTimeTillErr.Err)
+			continue
+		}
+
+		if gotTimeTillErr.TimeT.TotalCompleteMax >= 1 {
+			continue
+		}
+
+		tempActiveTimesErr.TimeTills = append(tempActiveTimesErr.TimeTills, gotTimeTillErr)
+	}
+
+	if len(tempActiveTimesErr.TimeTills) == 0 {
+		tempActiveTimesErr.Err = fmt.Errorf("%s%w: %s ; none are active", sprintName(printN),
+			NoLogsError, username)
+		if activeTimesErrChan != nil {
+			activeTimesErrChan <- tempActiveTimesErr
+		}
+		return tempActiveTimesErr
+	}
+
+	timeTills := tempActiveTimesErr.TimeTills
+	sort.SliceStable(timeTills, func(i, j int) bool {
+		first := timeTills[i].TimeT.Phase
+		second := timeTills[j].TimeT.Phase
+		if first != second {
+			return first < second
+		}
+		return timeTills[i].useLog.StartTime < timeTills[j].useLog.StartTime
+	})
+
+	seenDrugs := map[string]bool{}
+	var newestLogs []UserLog
+	for _, elem := range gotLogs.UserLogs {
+		if seenDrugs[elem.DrugName] {
+			continue
+		}
+		for _, timeTill := range timeTills {
+			if timeTill.useLog.ID == elem.ID {
+				seenDrugs[elem.DrugName] = true
+				newestLogs = append(newestLogs, elem)
+				break
+			}
+		}
+	}
+	tempActiveTimesErr.Warnings = cfg.pairInteractionWarnings(db, ctx, newestLogs)
+
+	if activeTimesErrChan != nil {
+		activeTimesErrChan <- tempActiveTimesErr
+	}
+	return tempActiveTimesErr
+}
+
+// PrintActiveTimes prints a short summary for every log gotten using
+// GetActiveTimes(), to see all of them at once. For all the details of
+// a single log, use PrintTimeTill().
+//
+// activeTimesErr - the struct returned from GetActiveTimes()
+//
+// prefix - if true, adds the function name to every print
+func (cfg *Config) PrintActiveTimes(activeTimesErr ActiveTimesError, prefix bool) error {
+	var printN string
+	if prefix == true {
+		printN = "PrintActiveTimes()"
+	} else {
+		printN = ""
+	}
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		err = fmt.Errorf("%s%w", sprintName(printN, "LoadLocation: "), err)
+		return err
+	}
+
+	printName(printN, "Warning: All data in here is approximations based on averages.")
+	printName(printN, "Please don't let that influence the experience too much!")
+
+	toMinutes := func(seconds int64) int {
+		return int(math.Round(float64(seconds) / 60))
+	}
+
+	for _, elem := range activeTimesErr.TimeTills {
+		timeTill := elem.TimeT
+		useLog := elem.useLog
+
+		fmt.Println()
+		printNameF(printN, "ID: %d ; Drug: %q ; Dose: %g %s ; Route: %q\n",
+			useLog.ID, useLog.DrugName, useLog.Dose, useLog.DoseUnits, useLog.DrugRoute)
+		printNameF(printN, "Phase: %s\n", phaseSummary(timeTill, location))
+		printNameF(printN, "Start Dose: %q ; Approx. End: %q\n",
+			time.Unix(useLog.StartTime, 0).In(location),
+			time.Unix(elem.approxEnd, 0).In(location))
+		printNameF(printN, "Minutes until: Onset: %d ; Comeup: %d ; Peak: %d ; Offset: %d ; Total: %d\n",
+			toMinutes(timeTill.TimeTillOnset), toMinutes(timeTill.TimeTillComeup),
+			toMinutes(timeTill.TimeTillPeak), toMinutes(timeTill.TimeTillOffset),
+			toMinutes(timeTill.TimeTillTotal))
+		printNameF(printN, "Completed: %d%% (average) ; Min: %d%% ; Max: %d%%\n",
+			int(timeTill.TotalCompleteAvg*100),
+			int(timeTill.TotalCompleteMin*100),
+			int(timeTill.TotalCompleteMax*100))
+	}
+
+	if len(activeTimesErr.Warnings) != 0 {
+		fmt.Println()
+		printName(printN, "Interactions between the active logs:")
+		for _, elem := range activeTimesErr.Warnings {
+			printName(printN, elem)
+		}
+	}
+
+	return nil
+}
+
+// Returns the current phase and until when it lasts on average,
+// for example: "peak ; until: 21:15 (average)"
+func phaseSummary(timeTill *TimeTill, location *time.Location) string {
+	for _, elem := range timeTill.PhaseTimes {
+		if timeTill.Phase == PhaseNotStarted {
+			return fmt.Sprintf("%s ; onset from: %s (average)", timeTill.Phase,
+				time.Unix(elem.StartAvg, 0).In(location).Format("15:04"))
+		}
+		if elem.Phase == timeTill.Phase {
+			return fmt.Sprintf("%s ; until: %s (average)", timeTill.Phase,
+				time.Unix(elem.EndAvg, 0).In(location).Format("15:04"))
+		}
+	}
+	return timeTill.Phase.String()
+}
+
+// PrintPhase prints only a single line with the current phase from the
+// information gotten using GetTimes(), for example to be shown in a status bar.
+//
+// timeTillErr - the struct returned from GetTimes()
+//
+// prefix - if true, adds the function name to every print
+func (cfg *Config) PrintPhase(timeTillErr TimeTillError, prefix bool) error {
+	var printN string
+	if prefix == true {
+		printN = "PrintPhase()"
+	} else {
+		printN = ""
+	}
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		err = fmt.Errorf("%s%w", sprintName(printN, "LoadLocation: "), err)
+		return err
+	}
+
+	printName(printN, phaseSummary(timeTillErr.TimeT, location))
+	return nil
+}
+
 // PrintTimeTill prints the information gotten using GetTimes() to the terminal.
 //
 // timeTillErr - the struct returned from GetTimes()
@@ -372,7 +749,8 @@ func (cfg *Config) PrintTimeTill(timeTillErr TimeTillError, prefix bool) error {
 	printNameF(printN, "Drug:\t%q\n", useLog.DrugName)
 	printNameF(printN, "Dose:\t%f\n", useLog.Dose)
 	printNameF(printN, "Units:\t%q\n", useLog.DoseUnits)
-	printNameF(printN, "Route:\t%q\n\n", useLog.DrugRoute)
+	printNameF(printN, "Route:\t%q\n", useLog.DrugRoute)
+	printNameF(printN, "Phase:\t%s\n\n", phaseSummary(timeTill, location))
 
 	printName(printN, "=== Time left in minutes until ===")
 
@@ -418,6 +796,27 @@ func (cfg *Config) PrintTimeTill(timeTillErr TimeTillError, prefix bool) error {
 		int(timeTill.TotalCompleteMax*100),
 		int(math.Round(float64(gotInfoProper.TotalDurMax)/60)))
 
+	if timeTillErr.Session != nil && timeTillErr.Session.Redoses != 0 {
+		printName(printN, "=== Session with redoses ===")
+		printDoseSession(printN, *timeTillErr.Session, location)
+	}
+
+	printName(printN, "=== Phases from start to end ===")
+
+	clock := func(unixTime int64) string {
+		return time.Unix(unixTime, 0).In(location).Format("15:04")
+	}
+
+	for _, elem := range timeTill.PhaseTimes {
+		if elem.StartMax == elem.EndMax {
+			continue
+		}
+		printNameF(printN, "%s:\t%s - %s (average) ; Min: %s - %s ; Max: %s - %s\n",
+			elem.Phase, clock(elem.StartAvg), clock(elem.EndAvg),
+			clock(elem.StartMin), clock(elem.EndMin),
+			clock(elem.StartMax), clock(elem.EndMax))
+	}
+
 	return nil
 }
 
@@ -0,0 +1,127 @@
+package drugdose
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The layouts accepted by ParseTimeInput() for a date and time,
+// without a time zone they are in the configured Timezone.
+var timeInputLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// The layouts accepted by ParseTimeInput() for only a time of day.
+var clockInputLayouts = []string{
+	"15:04:05",
+	"15:04",
+}
+
+// Parses a duration like "30m", "1h30m" or "2d", days aren't supported
+// by time.ParseDuration(), so they're handled separately.
+func parseAgoDuration(input string) (error, time.Duration) {
+	if strings.HasSuffix(input, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(input, "d"), 64)
+		if err != nil {
+			return err, 0
+		}
+		return nil, time.Duration(days * float64(24*time.Hour))
+	}
+
+	dur, err := time.ParseDuration(input)
+	if err != nil {
+		return err, 0
+	}
+	return nil, dur
+}
+
+// Does the work for ParseTimeInput(), the current time is given so that
+// the result doesn't depend on when it's called.
+func parseTimeInput(input string, location *time.Location, now time.Time) (error, int64) {
+	input = strings.TrimSpace(input)
+	now = now.In(location)
+
+	if input == "now" {
+		return nil, now.Unix()
+	}
+
+	if unixTime, err := strconv.ParseInt(input, 10, 64); err == nil {
+		return nil, unixTime
+	}
+
+	if strings.HasSuffix(input, " ago") {
+		err, dur := parseAgoDuration(strings.TrimSpace(strings.TrimSuffix(input, " ago")))
+		if err != nil || dur < 0 {
+			return fmt.Errorf("%w: %q", TimeInputError, input), 0
+		}
+		return nil, now.Add(-dur).Unix()
+	}
+
+	for _, layout := range timeInputLayouts {
+		gotTime, err := time.ParseInLocation(layout, input, location)
+		if err == nil {
+			return nil, gotTime.Unix()
+		}
+	}
+
+	for _, layout := range clockInputLayouts {
+		gotTime, err := time.ParseInLocation(layout, input, location)
+		if err != nil {
+			continue
+		}
+		gotTime = time.Date(now.Year(), now.Month(), now.Day(),
+			gotTime.Hour(), gotTime.Minute(), gotTime.Second(), 0, location)
+		// Only a time was given, so it's the last time that time of day
+		// was reached, for example 23:00 at 01:00 is yesterday.
+		if gotTime.After(now) {
+			gotTime = gotTime.AddDate(0, 0, -1)
+		}
+		return nil, gotTime.Unix()
+	}
+
+	return fmt.Errorf("%w: %q", TimeInputError, input), 0
+}
+
+// ParseTimeInput converts a time given by a person to a unix timestamp.
+// The accepted inputs are:
+//
+// "now" - the current time
+//
+// a unix timestamp, for example "1700000000"
+//
+// a duration before now, for example "30m ago", "1h30m ago" or "2d ago"
+//
+// a time of day, for example "21:15" or "21:15:30", if it's after the current
+// time, the one from yesterday is used
+//
+// a date and time, for example "2023-11-14 21:15" or RFC3339
+// like "2023-11-14T21:15:00+01:00"
+//
+// Everything without an explicit time zone is in the configured Timezone.
+//
+// input - the time to parse
+func (cfg *Config) ParseTimeInput(input string) (error, int64) {
+	const printN string = "ParseTimeInput()"
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "LoadLocation(): "), err), 0
+	}
+
+	err, gotTime := parseTimeInput(input, location, time.Now())
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), 0
+	}
+
+	return nil, gotTime
+}
+
+var TimeInputError error = errors.New("unknown time input, use for example: now, 30m ago, " +
+	"21:15, 2006-01-02 15:04 or RFC3339")
@@ -0,0 +1,228 @@
+package drugdose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+
+	"database/sql"
+	// MySQL driver needed for sql module
+	_ "github.com/go-sql-driver/mysql"
+	// SQLite driver needed for sql module
+	_ "modernc.org/sqlite"
+)
+
+const toleranceFilename string = "gpd-tolerance.toml"
+
+// ToleranceDecay is how fast the tolerance to a substance goes away after
+// a dose, in days. Right after a dose the tolerance is full (100%), after
+// HalfDays it's 50% and after FullDays it's back to baseline (0%).
+type ToleranceDecay struct {
+	HalfDays float32
+	FullDays float32
+}
+
+// ToleranceConfig is the layout of the tolerance config file, for example:
+//
+//	[Substance.LSD]
+//	HalfDays = 6
+//	FullDays = 14
+//
+// The names of the substances are the local names, the same as in the logs.
+type ToleranceConfig struct {
+	Substance map[string]ToleranceDecay
+}
+
+type Tolerance struct {
+	DrugName string
+	// From 0 to 100, the highest tolerance from all previous doses.
+	Percent float32
+	// The unix time when the tolerance is expected to be back at baseline,
+	// 0 if there's no tolerance.
+	Baseline int64
+	// The log which causes the highest tolerance.
+	FromLog UserLog
+	Decay   ToleranceDecay
+}
+
+type ToleranceError struct {
+	Tol      *Tolerance
+	Username string
+	Err      error
+}
+
+// GetToleranceConfig reads the tolerance config file. The source specific
+// file is in the same directory as the source specific names, if it doesn't
+// exist, the global one is used, which is in the same directory as the
+// global names, checkout GetNamesConfig().
+//
+// source - the source for which to read the config
+func GetToleranceConfig(source string) (error, *ToleranceConfig) {
+	const printN string = "GetToleranceConfig()"
+
+	err, file := readSourceOrGlobalConfig(toleranceFilename, source)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN), err), nil
+	}
+
+	tolCfg := ToleranceConfig{}
+	err = toml.Unmarshal(file, &tolCfg)
+	if err != nil {
+		return fmt.Errorf("%s%w", sprintName(printN, "toml.Unmarshal(): "), err), nil
+	}
+
+	return nil, &tolCfg
+}
+
+// Returns the tolerance from a single dose, from 0 to 1, days after it.
+// It decreases linearly from full to half and from half to baseline.
+func toleranceAfter(decay ToleranceDecay, days float64) float64 {
+	half := float64(decay.HalfDays)
+	full := float64(decay.FullDays)
+	if days < 0 || days >= full {
+		return 0
+	}
+	if days <= half {
+		return 1 - 0.5*days/half
+	}
+	return 0.5 * (1 - (days-half)/(full-half))
+}
+
+// Returns the estimated tolerance from the logs at the given unix time.
+// Only logs before it are used, a log with an end time causes tolerance from
+// its end.
+func estimateTolerance(drug string, decay ToleranceDecay, userLogs []UserLog, at int64) Tolerance {
+	tol := Tolerance{
+		DrugName: drug,
+		Decay:    decay,
+	}
+
+	var highest float64
+	for _, elem := range userLogs {
+		if elem.StartTime >= at {
+			continue
+		}
+
+		from := elem.StartTime
+		if elem.EndTime > from && elem.EndTime < at {
+			from = elem.EndTime
+		}
+
+		days := float64(at-from) / (24 * 60 * 60)
+		got := toleranceAfter(decay, days)
+		if got <= 0 {
+			continue
+		}
+
+		if got > highest {
+			highest = got
+			tol.FromLog = elem
+		}
+
+		baseline := from + int64(float64(decay.FullDays)*24*60*60)
+		if baseline > tol.Baseline {
+			tol.Baseline = baseline
+		}
+	}
+
+	tol.Percent = float32(highest * 100)
+	return tol
+}
+
+// GetTolerance estimates the tolerance of a user to a substance at the given
+// time, using all previous doses. The decay periods are read using
+// GetToleranceConfig(). The tolerance after a dose is full, it's halved
+// after ToleranceDecay.HalfDays and gone after ToleranceDecay.FullDays.
+// When there were a few doses, the highest tolerance from them is used,
+// the tolerance from different doses doesn't add up. This is only a rough
+// estimate, tolerance depends on many more things than just time.
+//
+// db - open database connection
+//
+// ctx - context to be passed to sql queries
+//
+// toleranceErrChan - the goroutine channel which returns the tolerance
+// and an error
+// (set to nil if function doesn't need to be concurrent)
+//
+// username - the user for which to estimate the tolerance
+//
+// drug - the substance for which to estimate the tolerance
+//
+// at - the unix time for which to estimate the tolerance, if 0 the current
+// time is used
+func (cfg *Config) GetTolerance(db *sql.DB, ctx context.Context,
+	toleranceErrChan chan<- ToleranceError, username string, drug string, at int64) ToleranceError {
+	const printN string = "GetTolerance()"
+
+	tempToleranceErr := ToleranceError{
+		Tol:      nil,
+		Username: username,
+		Err:      nil,
+	}
+
+	if at == 0 {
+		at = time.Now().Unix()
+	}
+
+	drug = cfg.MatchAndReplace(db, ctx, drug, NameTypeSubstance)
+
+	err, tolCfg := GetToleranceConfig(cfg.UseSource)
+	if err != nil {
+		tempToleranceErr.Err = fmt.Errorf("%s%w: %w", sprintName(printN), NoToleranceInfoError, err)
+		if toleranceErrChan != nil {
+			toleranceErrChan <- tempToleranceErr
+		}
+		return tempToleranceErr
+	}
+
+	decay, exists := tolCfg.Substance[drug]
+	if !exists || decay.HalfDays <= 0 || decay.FullDays <= decay.HalfDays {
+		tempToleranceErr.Err = fmt.Errorf("%s%w: %q ; half and full days must be set and full "+
+			"must be bigger than half", sprintName(printN), NoToleranceInfoError, drug)
+		if toleranceErrChan != nil {
+			toleranceErrChan <- tempToleranceErr
+		}
+		return tempToleranceErr
+	}
+
+	gotLogs := cfg.GetLogs(db, ctx, nil, 0, 0, username, false, drug, LogDrugNameCol)
+	if gotLogs.Err != nil && !errors.Is(gotLogs.Err, NoLogsError) {
+		tempToleranceErr.Err = fmt.Errorf("%s%w", sprintName(printN), gotLogs.Err)
+		if toleranceErrChan != nil {
+			toleranceErrChan <- tempToleranceErr
+		}
+		return tempToleranceErr
+	}
+
+	tol := estimateTolerance(drug, decay, gotLogs.UserLogs, at)
+	tempToleranceErr.Tol = &tol
+
+	if toleranceErrChan != nil {
+		toleranceErrChan <- tempToleranceErr
+	}
+	return tempToleranceErr
+}
+
+// Returns the warning for the tolerance, so that it can be added to
+// ErrorInfo.Warnings, nil is returned if there's no tolerance.
+func (cfg *Config) toleranceWarning(tol *Tolerance) error {
+	if tol == nil || tol.Percent <= 0 {
+		return nil
+	}
+
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+
+	return fmt.Errorf("%w: %q ; %d%% ; from log: %d ; back to baseline at: %s",
+		ToleranceWarning, tol.DrugName, int(tol.Percent), tol.FromLog.ID,
+		time.Unix(tol.Baseline, 0).In(location).Format("2006-01-02 15:04"))
+}
+
+var NoToleranceInfoError error = errors.New("no tolerance information for the substance")
+var ToleranceWarning error = errors.New("estimated tolerance from previous doses to")